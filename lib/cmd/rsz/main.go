@@ -0,0 +1,290 @@
+// rsz 通过标准输入输出收发 ZMODEM 的命令行工具，与 lrzsz 的 rz/sz 兼容
+//
+// 用法：
+//
+//	rsz sz [选项] 文件...   发送文件（对方运行 rz，或终端自动接收）
+//	rsz rz [选项]           接收文件到当前目录（对方运行 sz）
+//
+// 把可执行文件链接或复制为 rz、sz 时可以省略子命令。与 lrzsz 互通测试：
+//
+//	socat EXEC:'rsz sz a.txt' EXEC:'rz -y'
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/term"
+
+	"github.com/ishell/lib/modules/zmodem"
+)
+
+// 退出码
+const (
+	exitOK      = 0 // 所有文件都已传输（或按选项跳过）
+	exitFailed  = 1 // 会话出错或有文件失败
+	exitUsage   = 2 // 参数错误
+	exitPartial = 3 // 会话正常结束，但有文件被对方跳过
+)
+
+// config 命令行选项
+type config struct {
+	escape    bool
+	resume    bool
+	overwrite bool
+	protect   bool
+	rename    bool
+	keep      bool
+	md5       bool
+	quiet     bool
+	verbose   bool
+	charset   string
+	trace     string
+}
+
+func main() {
+	os.Exit(run(os.Args))
+}
+
+func run(args []string) int {
+	cmd := strings.TrimSuffix(filepath.Base(args[0]), ".exe")
+	rest := args[1:]
+	if cmd != "rz" && cmd != "sz" {
+		if len(rest) == 0 {
+			usage(os.Stderr)
+			return exitUsage
+		}
+		cmd, rest = rest[0], rest[1:]
+	}
+
+	var cfg config
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	boolFlag(fs, &cfg.escape, "e", "escape", false)
+	boolFlag(fs, &cfg.resume, "r", "resume", false)
+	boolFlag(fs, &cfg.overwrite, "y", "overwrite", false)
+	boolFlag(fs, &cfg.protect, "p", "protect", false)
+	boolFlag(fs, &cfg.rename, "E", "rename", false)
+	boolFlag(fs, &cfg.keep, "k", "keep-partial", false)
+	boolFlag(fs, &cfg.quiet, "q", "quiet", false)
+	boolFlag(fs, &cfg.verbose, "v", "verbose", false)
+	fs.BoolVar(&cfg.md5, "md5", false, "")
+	fs.StringVar(&cfg.charset, "charset", "", "")
+	fs.StringVar(&cfg.trace, "trace", "", "")
+	var binary bool // lrzsz 的 -b/-8：本工具总是以二进制传输，接受后忽略
+	boolFlag(fs, &binary, "b", "binary", false)
+	fs.BoolVar(&binary, "8", false, "")
+
+	if err := fs.Parse(expandShortFlags(rest, "eryEpkqvb8")); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			usage(os.Stdout)
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd, err)
+		usage(os.Stderr)
+		return exitUsage
+	}
+
+	opts := zmodem.Options{EscapeControl: cfg.escape, MD5: cfg.md5, Trace: cfg.trace}
+	if cfg.charset != "" {
+		if err := opts.RemoteCharset.UnmarshalText([]byte(cfg.charset)); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", cmd, err)
+			return exitUsage
+		}
+	}
+
+	switch cmd {
+	case "sz":
+		if fs.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, "sz: 需要指定要发送的文件")
+			return exitUsage
+		}
+		opts.Resume = cfg.resume
+		opts.Clobber = cfg.overwrite
+		return send(cfg, opts, fs.Args())
+	case "rz":
+		if fs.NArg() != 0 {
+			fmt.Fprintln(os.Stderr, "rz: 不接受文件参数，文件名由发送方决定")
+			return exitUsage
+		}
+		return receive(cfg, opts)
+	default:
+		fmt.Fprintf(os.Stderr, "rsz: 未知的命令 %q\n", cmd)
+		usage(os.Stderr)
+		return exitUsage
+	}
+}
+
+// send 发送 paths 中的文件
+func send(cfg config, opts zmodem.Options, paths []string) int {
+	files := make([]zmodem.FileSource, 0, len(paths))
+	for _, path := range paths {
+		src, err := zmodem.OpenFileSource(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sz: %v\n", err)
+			for _, f := range files {
+				f.Close()
+			}
+			return exitFailed
+		}
+		files = append(files, src)
+	}
+
+	return transfer(cfg, "sz", func(ctx context.Context, rw io.ReadWriter) ([]zmodem.FileResult, error) {
+		// 与 lrzsz 一样先发送 "rz\r"，使远端 shell 可以自动启动 rz
+		if _, err := io.WriteString(rw, "rz\r"); err != nil {
+			return nil, err
+		}
+		return zmodem.Send(ctx, rw, files, opts)
+	})
+}
+
+// receive 把文件接收到当前目录
+func receive(cfg config, opts zmodem.Options) int {
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rz: %v\n", err)
+		return exitFailed
+	}
+
+	// 与 lrzsz 一致，默认不覆盖已有文件
+	sink := &zmodem.DirSink{Dir: dir, KeepPartial: cfg.keep, Collision: zmodem.CollisionSkip}
+	switch {
+	case cfg.resume:
+		sink.Collision = zmodem.CollisionResume
+		sink.KeepPartial = true
+	case cfg.overwrite:
+		sink.Collision = zmodem.CollisionOverwrite
+	case cfg.rename:
+		sink.Collision = zmodem.CollisionRename
+	case cfg.protect:
+		sink.Collision = zmodem.CollisionSkip
+	}
+
+	return transfer(cfg, "rz", func(ctx context.Context, rw io.ReadWriter) ([]zmodem.FileResult, error) {
+		return zmodem.Receive(ctx, rw, sink, opts)
+	})
+}
+
+// transfer 在标准输入输出上运行会话并报告结果
+func transfer(cfg config, cmd string, fn func(ctx context.Context, rw io.ReadWriter) ([]zmodem.FileResult, error)) int {
+	// 终端上运行时需要原始模式，否则行规程会改写控制字符
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: 设置终端原始模式失败: %v\n", cmd, err)
+			return exitFailed
+		}
+		defer term.Restore(fd, state)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}
+	results, err := fn(ctx, rw)
+	return report(cfg, cmd, results, err)
+}
+
+// report 把每个文件的结果写到标准错误输出，返回退出码
+func report(cfg config, cmd string, results []zmodem.FileResult, err error) int {
+	code := exitOK
+	for _, r := range results {
+		switch {
+		case r.Completed:
+			if cfg.verbose {
+				line := fmt.Sprintf("%s: %s: %d 字节 sha256=%s", cmd, r.Name, r.Transferred, r.SHA256)
+				if r.MD5 != "" {
+					line += " md5=" + r.MD5
+				}
+				fmt.Fprintln(os.Stderr, line)
+			}
+		case r.Skipped && cmd == "rz":
+			// 本端按选项跳过（已存在同名文件、文件名不安全等）
+			if !cfg.quiet {
+				reason := "已存在同名文件"
+				if r.Err != nil {
+					reason = r.Err.Error()
+				}
+				fmt.Fprintf(os.Stderr, "rz: %s: 已跳过: %s\n", r.Name, reason)
+			}
+		case r.Skipped:
+			if !cfg.quiet {
+				fmt.Fprintf(os.Stderr, "sz: %s: 对方跳过了该文件\n", r.Name)
+			}
+			if code == exitOK {
+				code = exitPartial
+			}
+		default:
+			if !cfg.quiet {
+				fmt.Fprintf(os.Stderr, "%s: %s: 传输失败: %v\n", cmd, r.Name, r.Err)
+			}
+			code = exitFailed
+		}
+	}
+	if err != nil {
+		if !cfg.quiet {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", cmd, err)
+		}
+		code = exitFailed
+	}
+	return code
+}
+
+// boolFlag 注册同一个布尔选项的短名称和长名称
+func boolFlag(fs *flag.FlagSet, p *bool, short, long string, value bool) {
+	fs.BoolVar(p, short, value, "")
+	fs.BoolVar(p, long, value, "")
+}
+
+// expandShortFlags 把合写的短选项（如 lrzsz 常用的 -be）拆成 -b -e，只处理 letters 中的布尔选项
+func expandShortFlags(args []string, letters string) []string {
+	out := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			return append(out, args[i:]...)
+		}
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && !strings.Contains(arg, "=") &&
+			strings.Trim(arg[1:], letters) == "" {
+			for _, c := range arg[1:] {
+				out = append(out, "-"+string(c))
+			}
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, `用法:
+  rsz sz [选项] 文件...   通过标准输入输出发送文件
+  rsz rz [选项]           通过标准输入输出接收文件到当前目录
+  （链接为 sz、rz 时可以省略子命令）
+
+选项:
+  -e, --escape        转义所有控制字符
+  -r, --resume        sz: 请求对方续传；rz: 从保留的 .part 文件续传
+  -y, --overwrite     sz: 要求对方覆盖已有文件；rz: 覆盖已有文件
+  -E, --rename        rz: 已有同名文件时添加序号另存
+  -p, --protect       rz: 已有同名文件时跳过（默认）
+  -k, --keep-partial  rz: 传输失败时保留 .part 文件
+  -q, --quiet         不输出错误信息
+  -v, --verbose       输出每个文件的结果和 SHA-256
+      --md5           同时计算 MD5（与 -v 一起输出）
+      --charset NAME  远端文件名的字符集（gbk、big5、shift-jis、latin-1 等）
+      --trace FILE    把会话的输入输出记录到 FILE（见 lib/README.md）
+  -b, -8              兼容 lrzsz，总是以二进制传输
+`)
+}
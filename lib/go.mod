@@ -5,3 +5,10 @@ go 1.21
 // TODO: 集成实际的 Go ZMODEM 库
 // 例如：go get github.com/anyliker/zmodem
 // 或者：go get github.com/xiwh/zmodem
+
+require (
+	golang.org/x/term v0.15.0
+	golang.org/x/text v0.14.0
+)
+
+require golang.org/x/sys v0.15.0 // indirect
@@ -16,105 +16,510 @@ typedef struct {
 typedef struct {
 	int status;      // 0=idle, 1=active, 2=completed, 3=error
 	char* message;   // 错误消息（如果 status=3）
+	int code;        // 错误码（如果 status=3），见 ZMODEM_ERR_*
 } ZmodemStatus;
+
+// 错误码（与 zmodem.ErrorCode 一致，编号只会追加）：返回 int 的函数失败时返回其中之一
+#define ZMODEM_OK 0
+#define ZMODEM_ERR_INVALID_SESSION -1
+#define ZMODEM_ERR_INVALID_ARGUMENT -2
+#define ZMODEM_ERR_NOT_FOUND -3
+#define ZMODEM_ERR_PERMISSION -4
+#define ZMODEM_ERR_DISK_FULL -5
+#define ZMODEM_ERR_IO -6
+#define ZMODEM_ERR_PROTOCOL -7
+#define ZMODEM_ERR_CRC_EXHAUSTED -8
+#define ZMODEM_ERR_PEER_CANCELLED -9
+#define ZMODEM_ERR_TIMEOUT -10
+#define ZMODEM_ERR_CANCELLED -11
+#define ZMODEM_ERR_UNSAFE_PATH -12
+#define ZMODEM_ERR_CONNECTION_CLOSED -13
+#define ZMODEM_ERR_INTERNAL -14
+#define ZMODEM_ERR_TOO_MANY_SESSIONS -15
+
+// Error 结构体（C 兼容）
+typedef struct {
+	int code;        // 错误码，ZMODEM_OK 表示没有错误
+	char* message;   // 错误消息（没有错误时为 NULL）
+} ZmodemError;
+
+// DetailedState 结构体（C 兼容）
+typedef struct {
+	int state;        // 协议状态编号，见 zmodem.State
+	char* name;       // 协议状态名称，如 "sending_data"
+	char* reason;     // 最近一次状态转换的原因，如 "retrying at offset 1024"
+	int64_t position; // 最近一次状态转换时的文件偏移
+} ZmodemDetailedState;
+
+// Trailing 结构体（C 兼容）：会话结束后不属于协议的数据
+typedef struct {
+	uint8_t* data;   // 数据（len 为 0 时为 NULL）
+	int32_t len;     // 数据长度
+} ZmodemTrailing;
+
+// 回调会话：文件数据由宿主通过以下回调提供或消费
+// 回调在调用 ZmodemFeedData/ZmodemGetOutputData/ZmodemCleanup 的线程上同步执行；
+// 调用 ZmodemSetCallbacks 之后，readFn 改由会话专属的线程调用（输出由该线程生成），
+// createFn/writeFn/finishFn 仍在调用 ZmodemFeedData 的线程上执行，但可能与 readFn 不在同一线程。
+// 回调中不能再调用同一会话的任何 Zmodem* 函数
+
+// 读取第 fileIndex 个文件 offset 处的数据，返回读取的字节数（小于 len 表示文件结束），<0 表示出错
+typedef int64_t (*ZmodemReadFunc)(void* userData, int32_t fileIndex, int64_t offset, uint8_t* buf, int32_t len);
+// 收到 ZFILE 时创建写入目标，返回宿主自定义的句柄（>=0），ZMODEM_CREATE_SKIP 表示跳过该文件，其他负值表示出错
+typedef int32_t (*ZmodemCreateFunc)(void* userData, const char* name, int64_t size, int64_t mtime, uint32_t mode);
+// 在 offset 处写入数据，返回 0 表示成功
+typedef int32_t (*ZmodemWriteFunc)(void* userData, int32_t handle, int64_t offset, const uint8_t* buf, int32_t len);
+// 文件结束：commit=1 表示完整收到，应提交；commit=0 表示放弃。返回 0 表示成功
+typedef int32_t (*ZmodemFinishFunc)(void* userData, int32_t handle, int32_t commit);
+
+#define ZMODEM_CREATE_SKIP -2
+
+static inline int64_t callReadFunc(ZmodemReadFunc fn, void* userData, int32_t fileIndex, int64_t offset, uint8_t* buf, int32_t len) {
+	return fn(userData, fileIndex, offset, buf, len);
+}
+
+static inline int32_t callCreateFunc(ZmodemCreateFunc fn, void* userData, const char* name, int64_t size, int64_t mtime, uint32_t mode) {
+	return fn(userData, name, size, mtime, mode);
+}
+
+static inline int32_t callWriteFunc(ZmodemWriteFunc fn, void* userData, int32_t handle, int64_t offset, const uint8_t* buf, int32_t len) {
+	return fn(userData, handle, offset, buf, len);
+}
+
+static inline int32_t callFinishFunc(ZmodemFinishFunc fn, void* userData, int32_t handle, int32_t commit) {
+	return fn(userData, handle, commit);
+}
+
+// 事件回调（ZmodemSetCallbacks）：在该会话专属的线程上依次调用，不会并发；
+// 指针参数只在回调期间有效。为 NULL 的回调不调用
+
+// 有数据需要发给对方（设置后不应再调用 ZmodemGetOutputData）
+typedef void (*ZmodemOutputCallback)(void* userData, int32_t sessionId, const uint8_t* data, int32_t len);
+// 当前文件的进度（最多每 100ms 一次）
+typedef void (*ZmodemProgressCallback)(void* userData, int32_t sessionId, int64_t transferred, int64_t total);
+// 开始传输第 fileIndex 个文件
+typedef void (*ZmodemFileStartCallback)(void* userData, int32_t sessionId, int32_t fileIndex, const char* name, int64_t size);
+// 第 fileIndex 个文件结束：result 为 ZMODEM_FILE_COMPLETED/SKIPPED/FAILED，error 在失败或因故跳过时非 NULL
+typedef void (*ZmodemFileEndCallback)(void* userData, int32_t sessionId, int32_t fileIndex, const char* name, int64_t transferred, int32_t result, const char* error);
+// 会话结束：status 为 2（completed）或 3（error），message 为错误消息（可为 NULL）
+typedef void (*ZmodemFinishCallback)(void* userData, int32_t sessionId, int32_t status, const char* message);
+
+#define ZMODEM_FILE_COMPLETED 0
+#define ZMODEM_FILE_SKIPPED 1
+#define ZMODEM_FILE_FAILED 2
+
+typedef struct {
+	ZmodemOutputCallback onOutput;
+	ZmodemProgressCallback onProgress;
+	ZmodemFileStartCallback onFileStart;
+	ZmodemFileEndCallback onFileEnd;
+	ZmodemFinishCallback onFinish;
+} ZmodemCallbacks;
+
+static inline void callOutputCallback(ZmodemOutputCallback fn, void* userData, int32_t sessionId, const uint8_t* data, int32_t len) {
+	fn(userData, sessionId, data, len);
+}
+
+static inline void callProgressCallback(ZmodemProgressCallback fn, void* userData, int32_t sessionId, int64_t transferred, int64_t total) {
+	fn(userData, sessionId, transferred, total);
+}
+
+static inline void callFileStartCallback(ZmodemFileStartCallback fn, void* userData, int32_t sessionId, int32_t fileIndex, const char* name, int64_t size) {
+	fn(userData, sessionId, fileIndex, name, size);
+}
+
+static inline void callFileEndCallback(ZmodemFileEndCallback fn, void* userData, int32_t sessionId, int32_t fileIndex, const char* name, int64_t transferred, int32_t result, const char* error) {
+	fn(userData, sessionId, fileIndex, name, transferred, result, error);
+}
+
+static inline void callFinishCallback(ZmodemFinishCallback fn, void* userData, int32_t sessionId, int32_t status, const char* message) {
+	fn(userData, sessionId, status, message);
+}
+
+// 日志级别（RollshellSetLogConfig 的 level，以及日志回调的 level 参数）
+#define ROLLSHELL_LOG_DEBUG 0
+#define ROLLSHELL_LOG_INFO 1
+#define ROLLSHELL_LOG_WARN 2
+#define ROLLSHELL_LOG_ERROR 3
+
+// 日志回调：message 只在回调期间有效，不含时间戳和换行
+typedef void (*RollshellLogCallback)(void* userData, int32_t level, const char* message);
+
+static inline void callLogCallback(RollshellLogCallback fn, void* userData, int32_t level, const char* message) {
+	fn(userData, level, message);
+}
 */
 import "C"
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"time"
+	"io"
+	"sync"
 	"unsafe"
 
 	"github.com/ishell/lib/modules/zmodem"
 )
 
+// libVersion 动态库版本，发布构建可以通过 -ldflags "-X main.libVersion=x.y.z" 覆盖
+var libVersion = "1.0.0"
+
+// abiVersion C ABI 版本：删除导出函数、修改已有函数签名或结构体布局时递增
+// 只追加导出函数、结构体末尾字段或错误码不改变 ABI 版本
+const abiVersion = 1
+
+// libCapabilities RollshellLibCapabilities 返回的能力描述
+type libCapabilities struct {
+	Version   string   `json:"version"`
+	ABI       int      `json:"abi"`
+	Protocols []string `json:"protocols"`
+	Features  []string `json:"features"`
+}
+
+// libFeatures 本动态库支持的功能，宿主据此决定绑定哪些导出函数
+var libFeatures = []string{
+	"resume",         // 断点续传（collision 选项为 resume）
+	"batch",          // 一个会话传输多个文件
+	"options",        // ZmodemInitWithOptions
+	"host_io",        // ZmodemInitSendCallback / ZmodemInitReceiveCallback
+	"callbacks",      // ZmodemSetCallbacks
+	"logging",        // RollshellSetLogConfig
+	"process",        // ZmodemProcess
+	"events",         // ZmodemPollEvent / ZmodemFreeEvent
+	"results",        // ZmodemGetResults（含 SHA-256/MD5 摘要）
+	"detailed_state", // ZmodemGetDetailedState
+	"error_codes",    // ZMODEM_ERR_* 与 ZmodemLastInitError
+	"collision",      // collision 选项
+	"remote_charset", // remoteCharset 选项
+	"free_space",     // checkFreeSpace 选项
+	"trace",          // trace 选项（协议记录）
+	"escape_control", // escapeControl 选项
+	"upload_resume",  // resume 选项（上传时以 ZCRESUM 请求续传）
+	"upload_clobber", // clobber 选项（上传时以 ZMCLOB 要求覆盖）
+	"output_window",  // outputWindow 选项 / ZmodemAckOutput
+	"trailing",       // ZmodemGetTrailing / ZmodemFreeTrailing
+	"stats",          // ZmodemGetStats（速度、预计剩余时间、重传次数）
+	"pause",          // ZmodemPause / ZmodemResume
+	"rate_limit",     // rateLimit 选项 / ZmodemSetRateLimit / ZmodemSetGlobalRateLimit
+	"session_admin",  // ZmodemSetSessionLimits / ZmodemListSessions / ZmodemCleanupAll
+}
+
+var (
+	versionOnce   sync.Once
+	cVersion      *C.char
+	cCapabilities *C.char
+)
+
+// initVersionStrings 生成版本与能力字符串，整个进程只分配一次
+func initVersionStrings() {
+	versionOnce.Do(func() {
+		caps, _ := json.Marshal(libCapabilities{
+			Version:   libVersion,
+			ABI:       abiVersion,
+			Protocols: []string{"zmodem"},
+			Features:  libFeatures,
+		})
+		cVersion = C.CString(libVersion)
+		cCapabilities = C.CString(string(caps))
+	})
+}
+
+// RollshellLibVersion 获取动态库版本
+// 返回: 版本字符串，例如 "1.0.0"（静态字符串，不需要释放）
+//
+//export RollshellLibVersion
+func RollshellLibVersion() *C.char {
+	initVersionStrings()
+	return cVersion
+}
+
+// RollshellLibCapabilities 获取动态库支持的协议和功能，宿主可以在绑定其他函数之前调用
+// 返回: JSON 字符串（静态字符串，不需要释放）。例如
+// {"version":"1.0.0","abi":1,"protocols":["zmodem"],"features":["resume","batch","callbacks",...]}
+//
+//export RollshellLibCapabilities
+func RollshellLibCapabilities() *C.char {
+	initVersionStrings()
+	return cCapabilities
+}
+
+// RollshellSetLogConfig 设置动态库的日志（进程内全局生效，默认关闭）
+// configJSON: JSON 格式的日志配置，例如 {"level":"debug","sink":"file","path":"/tmp/rollshell.log","redact":true}
+// callback: sink 为 "callback" 时接收日志的回调（其他 sink 时可为 NULL）
+// userData: 原样传给回调的宿主指针
+// 返回: ZMODEM_OK，配置无效或无法打开日志文件时返回 ZMODEM_ERR_INVALID_ARGUMENT 并保持原配置
+//
+// 回调可能在任意线程上调用（不同线程的日志可能并发回调）；回调不在动态库内部的锁中调用，可以调用 Zmodem* 和 Rollshell* 函数。
+//
+//export RollshellSetLogConfig
+func RollshellSetLogConfig(configJSON *C.char, callback C.RollshellLogCallback, userData unsafe.Pointer) C.int {
+	var data string
+	if configJSON != nil {
+		data = C.GoString(configJSON)
+	}
+	cfg, err := zmodem.ParseLogConfig(data)
+	if err != nil {
+		return C.ZMODEM_ERR_INVALID_ARGUMENT
+	}
+
+	var fn zmodem.LogFunc
+	if callback != nil {
+		fn = func(level zmodem.LogLevel, message string) {
+			cMsg := C.CString(message)
+			defer C.free(unsafe.Pointer(cMsg))
+			C.callLogCallback(callback, userData, C.int32_t(level), cMsg)
+		}
+	}
+	if err := zmodem.SetLogConfig(cfg, fn); err != nil {
+		return C.ZMODEM_ERR_INVALID_ARGUMENT
+	}
+	return C.ZMODEM_OK
+}
+
 // ZmodemInit 初始化 ZMODEM 会话
 // mode: 0=upload (rz), 1=download (sz)
 // filePath: 文件路径
-// 返回: session_id (>=0) 或 -1 表示失败
+// 返回: session_id (>=0) 或错误码（<0，原因见 ZmodemLastInitError）
 //
 //export ZmodemInit
 func ZmodemInit(mode C.int, filePath *C.char) C.int {
+	return ZmodemInitWithOptions(mode, filePath, nil)
+}
+
+// ZmodemInitWithOptions 使用会话选项初始化 ZMODEM 会话
+// mode: 0=upload (rz), 1=download (sz)
+// filePath: 文件路径
+// optionsJSON: JSON 格式的会话选项（可为 NULL），例如 {"checkFreeSpace":true}
+// 返回: session_id (>=0) 或错误码（<0，原因见 ZmodemLastInitError）
+//
+//export ZmodemInitWithOptions
+func ZmodemInitWithOptions(mode C.int, filePath *C.char, optionsJSON *C.char) C.int {
 	goFilePath := C.GoString(filePath)
+
+	opts, err := parseOptionsArg(optionsJSON)
+	if err != nil {
+		return initFailed(zmodem.CodeInvalidArgument, err)
+	}
 	
-	// 测试日志写入（不依赖环境变量，尝试多个位置）
-	testLogFiles := []string{
-		"/tmp/zmodem-debug.log",
-		os.TempDir() + "/zmodem-debug.log",
-		"./zmodem-debug.log",
-	}
-	for _, testLogFile := range testLogFiles {
-		if f, err := os.OpenFile(testLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
-			timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-			msg := fmt.Sprintf("[%s] [ZMODEM CGO] ZmodemInit: mode=%d, filePath=%s, ZMODEM_DEBUG=%s\n", 
-				timestamp, mode, goFilePath, os.Getenv("ZMODEM_DEBUG"))
-			f.WriteString(msg)
-			f.Sync()
-			f.Close()
-			break // 成功写入一个就退出
+	zmodem.Logf(zmodem.LogInfo, "ZmodemInit: mode=%d, filePath=%s", mode, goFilePath)
+
+	impl, err := zmodem.NewZmodemImpl(int(mode), goFilePath, opts)
+	if err != nil {
+		return initFailed(zmodem.CodeOf(err), err)
+	}
+
+	return newSession(int(mode), goFilePath, impl, opts)
+}
+
+// newSession 注册会话；选项中指定了 trace 时开始记录会话的输入输出
+// 返回: session_id 或错误码
+func newSession(mode int, filePath string, impl *zmodem.ZmodemImpl, opts zmodem.Options) C.int {
+	if opts.Trace != "" {
+		if err := impl.StartTraceFile(opts.Trace); err != nil {
+			impl.Close()
+			return initFailed(zmodem.CodeOf(err), err)
+		}
+	}
+
+	session, err := zmodem.NewSession(mode, filePath, impl)
+	if err != nil {
+		impl.Close()
+		return initFailed(zmodem.CodeOf(err), err)
+	}
+	return C.int(session.ID)
+}
+
+// lastInitError 最近一次会话初始化失败的原因
+var lastInitError struct {
+	sync.Mutex
+	code    zmodem.ErrorCode
+	message string
+}
+
+// initFailed 记录初始化失败的原因（见 ZmodemLastInitError），返回对应的错误码
+func initFailed(code zmodem.ErrorCode, err error) C.int {
+	lastInitError.Lock()
+	defer lastInitError.Unlock()
+	lastInitError.code = code
+	lastInitError.message = err.Error()
+	return C.int(code)
+}
+
+// ZmodemLastInitError 获取最近一次 ZmodemInit* 失败的原因（进程内共享，初始化成功不会清除）
+// 返回: Error 结构体指针（需要调用 ZmodemFreeError 释放），从未失败时 code 为 ZMODEM_OK
+//
+//export ZmodemLastInitError
+func ZmodemLastInitError() *C.ZmodemError {
+	lastInitError.Lock()
+	defer lastInitError.Unlock()
+
+	cErr := (*C.ZmodemError)(C.malloc(C.size_t(unsafe.Sizeof(C.ZmodemError{}))))
+	cErr.code = C.int(lastInitError.code)
+	if lastInitError.message != "" {
+		cErr.message = C.CString(lastInitError.message)
+	} else {
+		cErr.message = nil
+	}
+	return cErr
+}
+
+// ZmodemFreeError 释放 Error 结构体内存
+//
+//export ZmodemFreeError
+func ZmodemFreeError(e *C.ZmodemError) {
+	if e != nil {
+		if e.message != nil {
+			C.free(unsafe.Pointer(e.message))
 		}
+		C.free(unsafe.Pointer(e))
 	}
+}
 
-	impl, err := zmodem.NewZmodemImpl(int(mode), goFilePath)
+// parseOptionsArg 解析 C 传入的 JSON 会话选项，NULL 表示使用默认选项
+func parseOptionsArg(optionsJSON *C.char) (zmodem.Options, error) {
+	if optionsJSON == nil {
+		return zmodem.Options{}, nil
+	}
+	return zmodem.ParseOptions(C.GoString(optionsJSON))
+}
+
+// ZmodemInitSendCallback 初始化发送会话，文件内容由宿主通过 readFn 回调提供
+// filesJSON: 文件列表，例如 [{"name":"a.txt","size":12,"mtime":1700000000,"mode":420}]
+// readFn: 读取回调，fileIndex 为文件在 filesJSON 中的下标
+// userData: 原样传给回调的宿主指针
+// optionsJSON: JSON 格式的会话选项（可为 NULL）
+// 返回: session_id (>=0) 或错误码（<0，原因见 ZmodemLastInitError）
+//
+//export ZmodemInitSendCallback
+func ZmodemInitSendCallback(filesJSON *C.char, readFn C.ZmodemReadFunc, userData unsafe.Pointer, optionsJSON *C.char) C.int {
+	if filesJSON == nil || readFn == nil {
+		return initFailed(zmodem.CodeInvalidArgument, errors.New("文件列表和读取回调不能为空"))
+	}
+	opts, err := parseOptionsArg(optionsJSON)
 	if err != nil {
-		return -1
+		return initFailed(zmodem.CodeInvalidArgument, err)
+	}
+	infos, err := zmodem.ParseFileInfos(C.GoString(filesJSON))
+	if err != nil {
+		return initFailed(zmodem.CodeInvalidArgument, err)
+	}
+
+	files := make([]zmodem.FileSource, len(infos))
+	for i, info := range infos {
+		index := C.int32_t(i)
+		files[i] = &zmodem.FuncSource{
+			FileInfo: info,
+			ReadAtFunc: func(p []byte, off int64) (int, error) {
+				if len(p) == 0 {
+					return 0, nil
+				}
+				n := C.callReadFunc(readFn, userData, index, C.int64_t(off), (*C.uint8_t)(unsafe.Pointer(&p[0])), C.int32_t(len(p)))
+				if n < 0 {
+					return 0, fmt.Errorf("宿主读取文件失败: %d", int64(n))
+				}
+				if int(n) < len(p) {
+					return int(n), io.EOF
+				}
+				return int(n), nil
+			},
+		}
 	}
 
-	session, err := zmodem.NewSession(int(mode), goFilePath, impl)
+	return newSession(0, "", zmodem.NewSender(files, opts), opts)
+}
+
+// ZmodemInitReceiveCallback 初始化接收会话，收到的文件交给宿主回调处理
+// createFn: 收到 ZFILE 时创建写入目标
+// writeFn: 写入文件数据
+// finishFn: 文件结束时提交（完整收到）或放弃
+// userData: 原样传给回调的宿主指针
+// optionsJSON: JSON 格式的会话选项（可为 NULL）
+// 返回: session_id (>=0) 或错误码（<0，原因见 ZmodemLastInitError）
+//
+//export ZmodemInitReceiveCallback
+func ZmodemInitReceiveCallback(createFn C.ZmodemCreateFunc, writeFn C.ZmodemWriteFunc, finishFn C.ZmodemFinishFunc, userData unsafe.Pointer, optionsJSON *C.char) C.int {
+	if createFn == nil || writeFn == nil || finishFn == nil {
+		return initFailed(zmodem.CodeInvalidArgument, errors.New("回调函数不能为空"))
+	}
+	opts, err := parseOptionsArg(optionsJSON)
 	if err != nil {
-		return -1
+		return initFailed(zmodem.CodeInvalidArgument, err)
 	}
 
-	return C.int(session.ID)
+	sink := zmodem.SinkFunc(func(info zmodem.FileInfo) (zmodem.FileWriter, error) {
+		cName := C.CString(info.Name)
+		defer C.free(unsafe.Pointer(cName))
+		var mtime int64
+		if !info.ModTime.IsZero() {
+			mtime = info.ModTime.Unix()
+		}
+
+		handle := C.callCreateFunc(createFn, userData, cName, C.int64_t(info.Size), C.int64_t(mtime), C.uint32_t(info.Mode))
+		if handle == C.ZMODEM_CREATE_SKIP {
+			return nil, zmodem.ErrSkipFile
+		}
+		if handle < 0 {
+			return nil, fmt.Errorf("宿主创建文件失败: %s", info.Name)
+		}
+
+		finish := func(commit C.int32_t) error {
+			if rc := C.callFinishFunc(finishFn, userData, handle, commit); rc != 0 {
+				return fmt.Errorf("宿主结束文件失败: %d", int32(rc))
+			}
+			return nil
+		}
+		return &zmodem.FuncWriter{
+			WriteAtFunc: func(p []byte, off int64) (int, error) {
+				if len(p) == 0 {
+					return 0, nil
+				}
+				if rc := C.callWriteFunc(writeFn, userData, handle, C.int64_t(off), (*C.uint8_t)(unsafe.Pointer(&p[0])), C.int32_t(len(p))); rc != 0 {
+					return 0, fmt.Errorf("宿主写入文件失败: %d", int32(rc))
+				}
+				return len(p), nil
+			},
+			CommitFunc: func() error { return finish(1) },
+			AbortFunc:  func() error { return finish(0) },
+		}, nil
+	})
+
+	return newSession(1, "", zmodem.NewReceiver(sink, opts), opts)
 }
 
 // ZmodemFeedData 输入数据（从 SSH channel 接收）
 // sessionId: 会话 ID
 // data: 数据指针
 // dataLen: 数据长度
-// 返回: 0=成功, -1=错误
+// 返回: ZMODEM_OK 或错误码（<0，见 ZMODEM_ERR_*）
 //
 //export ZmodemFeedData
 func ZmodemFeedData(sessionId C.int, data *C.uint8_t, dataLen C.int) C.int {
 	session := zmodem.GetSession(int(sessionId))
 	if session == nil {
-		return -1
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+	if dataLen < 0 || (data == nil && dataLen > 0) {
+		return C.ZMODEM_ERR_INVALID_ARGUMENT
 	}
 
 	// 将 C 数组转换为 Go slice
 	goData := C.GoBytes(unsafe.Pointer(data), dataLen)
 	
-	// 调试输出到文件（总是写入，不依赖环境变量）
-	testLogFile := "/tmp/zmodem-debug.log"
-	if f, err := os.OpenFile(testLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
-		previewLen := len(goData)
-		if previewLen > 32 {
-			previewLen = 32
-		}
-		timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-		msg := fmt.Sprintf("[%s] [ZMODEM CGO] ZmodemFeedData: sessionId=%d, length=%d, preview: %x\n", 
-			timestamp, sessionId, len(goData), goData[:previewLen])
-		f.WriteString(msg)
-		f.Sync()
-		f.Close()
+	if zmodem.LogEnabled(zmodem.LogDebug) {
+		zmodem.Logf(zmodem.LogDebug, "ZmodemFeedData: sessionId=%d, %s", sessionId, zmodem.PayloadPreview(goData))
 	}
 
 	impl := session.GetImpl()
 	if impl == nil {
-		return -1
+		return C.ZMODEM_ERR_INVALID_SESSION
 	}
 
 	err := impl.FeedData(goData)
 	if err != nil {
-		session.SetError(err.Error())
-		return -1
+		session.Fail(err)
+		return C.int(zmodem.CodeOf(err))
 	}
-
-	// 更新进度
-	transferred := impl.GetTransferred()
-	total := impl.GetFileSize()
-	session.UpdateProgress(transferred, total)
-
+	session.Wake()
 	session.SetStatus(zmodem.StatusActive)
 	return 0
 }
@@ -123,13 +528,16 @@ func ZmodemFeedData(sessionId C.int, data *C.uint8_t, dataLen C.int) C.int {
 // sessionId: 会话 ID
 // buffer: 输出缓冲区
 // bufferLen: 缓冲区长度
-// 返回: 实际数据长度 (>=0), 0=无数据, -1=错误
+// 返回: 实际数据长度 (>=0), 0=无数据, <0 为错误码（见 ZMODEM_ERR_*）
 //
 //export ZmodemGetOutputData
 func ZmodemGetOutputData(sessionId C.int, buffer *C.uint8_t, bufferLen C.int) C.int {
 	session := zmodem.GetSession(int(sessionId))
 	if session == nil {
-		return -1
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+	if buffer == nil || bufferLen < 0 {
+		return C.ZMODEM_ERR_INVALID_ARGUMENT
 	}
 
 	// 分配 Go buffer
@@ -137,48 +545,20 @@ func ZmodemGetOutputData(sessionId C.int, buffer *C.uint8_t, bufferLen C.int) C.
 
 	impl := session.GetImpl()
 	if impl == nil {
-		return -1
-	}
-
-	// 调试日志：调用前
-	if f, err := os.OpenFile("/tmp/zmodem-debug.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
-		timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-		msg := fmt.Sprintf("[%s] [ZMODEM CGO] ZmodemGetOutputData: 调用前 sessionId=%d, bufferLen=%d\n",
-			timestamp, sessionId, bufferLen)
-		f.WriteString(msg)
-		f.Sync()
-		f.Close()
+		return C.ZMODEM_ERR_INVALID_SESSION
 	}
 
 	n, err := impl.GetOutputData(goBuffer)
 	if err != nil {
-		session.SetError(err.Error())
-		return -1
+		session.Fail(err)
+		return C.int(zmodem.CodeOf(err))
 	}
 
-	// 调试日志：调用后
-	if f, err := os.OpenFile("/tmp/zmodem-debug.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
-		previewLen := n
-		if previewLen > 32 {
-			previewLen = 32
-		}
-		if previewLen < 0 {
-			previewLen = 0
-		}
-		timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-		msg := fmt.Sprintf("[%s] [ZMODEM CGO] ZmodemGetOutputData: 调用后 sessionId=%d, 返回=%d, 预览: %x\n",
-			timestamp, sessionId, n, goBuffer[:previewLen])
-		f.WriteString(msg)
-		f.Sync()
-		f.Close()
+	if n > 0 && zmodem.LogEnabled(zmodem.LogDebug) {
+		zmodem.Logf(zmodem.LogDebug, "ZmodemGetOutputData: sessionId=%d, %s", sessionId, zmodem.PayloadPreview(goBuffer[:n]))
 	}
 
 	if n > 0 {
-		// 更新进度
-		transferred := impl.GetTransferred()
-		total := impl.GetFileSize()
-		session.UpdateProgress(transferred, total)
-
 		// 将数据复制到 C buffer
 		if n > int(bufferLen) {
 			n = int(bufferLen)
@@ -189,9 +569,63 @@ func ZmodemGetOutputData(sessionId C.int, buffer *C.uint8_t, bufferLen C.int) C.
 	return C.int(n)
 }
 
+// ZmodemProcess 输入数据并取出输出，一次调用代替 ZmodemFeedData + 循环 ZmodemGetOutputData
+// sessionId: 会话 ID
+// in/inLen: 从 SSH channel 收到的数据，全部会被消费（inLen 为 0 时只取输出，in 可为 NULL）
+// out/outCap: 输出缓冲区及其容量
+// outLen: 返回写入 out 的字节数
+// more: 返回 1 表示还有输出没有取完，应以空输入再次调用；0 表示暂时没有更多输出
+// 返回: ZMODEM_OK 或错误码（<0，见 ZMODEM_ERR_*）
+//
+//export ZmodemProcess
+func ZmodemProcess(sessionId C.int, in *C.uint8_t, inLen C.int, out *C.uint8_t, outCap C.int, outLen *C.int, more *C.int) C.int {
+	session := zmodem.GetSession(int(sessionId))
+	if session == nil {
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+	if outLen == nil || more == nil || inLen < 0 || outCap < 0 {
+		return C.ZMODEM_ERR_INVALID_ARGUMENT
+	}
+	if (in == nil && inLen > 0) || (out == nil && outCap > 0) {
+		return C.ZMODEM_ERR_INVALID_ARGUMENT
+	}
+
+	impl := session.GetImpl()
+	if impl == nil {
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+
+	var input []byte
+	if inLen > 0 {
+		input = unsafe.Slice((*byte)(unsafe.Pointer(in)), int(inLen))
+	}
+	var output []byte
+	if outCap > 0 {
+		output = unsafe.Slice((*byte)(unsafe.Pointer(out)), int(outCap))
+	}
+
+	n, pending, err := impl.Process(input, output)
+	if err != nil {
+		session.Fail(err)
+		return C.int(zmodem.CodeOf(err))
+	}
+
+	if inLen > 0 {
+		session.SetStatus(zmodem.StatusActive)
+		session.Wake()
+	}
+
+	*outLen = C.int(n)
+	*more = 0
+	if pending {
+		*more = 1
+	}
+	return 0
+}
+
 // ZmodemGetProgress 获取传输进度
 // sessionId: 会话 ID
-// 返回: Progress 结构体指针（需要调用者 free），nil 表示错误
+// 返回: Progress 结构体指针（需要调用者 free），nil 表示会话不存在（相当于 ZMODEM_ERR_INVALID_SESSION）
 //
 //export ZmodemGetProgress
 func ZmodemGetProgress(sessionId C.int) *C.ZmodemProgress {
@@ -200,31 +634,12 @@ func ZmodemGetProgress(sessionId C.int) *C.ZmodemProgress {
 		return nil
 	}
 
-	// 从 impl 获取实时进度
-	impl := session.GetImpl()
-	var transferred, total int64
-	var percent float64
-
-	if impl != nil {
-		transferred = impl.GetTransferred()
-		total = impl.GetFileSize()
-		if total > 0 {
-			percent = float64(transferred) / float64(total) * 100
-		}
-
-		// 更新 session 的进度
-		session.UpdateProgress(transferred, total)
-	} else {
-		progress := session.GetProgress()
-		transferred = progress.Transferred
-		total = progress.Total
-		percent = progress.Percent
-	}
+	progress := session.GetProgress()
 
 	cProgress := (*C.ZmodemProgress)(C.malloc(C.size_t(unsafe.Sizeof(C.ZmodemProgress{}))))
-	cProgress.transferred = C.int64_t(transferred)
-	cProgress.total = C.int64_t(total)
-	cProgress.percent = C.double(percent)
+	cProgress.transferred = C.int64_t(progress.Transferred)
+	cProgress.total = C.int64_t(progress.Total)
+	cProgress.percent = C.double(progress.Percent)
 
 	return cProgress
 }
@@ -238,9 +653,29 @@ func ZmodemFreeProgress(progress *C.ZmodemProgress) {
 	}
 }
 
+// ZmodemGetStats 获取传输统计：速度、预计剩余时间、重传次数等
+// sessionId: 会话 ID
+// 返回: JSON 对象（需要调用 ZmodemFreeString 释放），nil 表示会话不存在（相当于 ZMODEM_ERR_INVALID_SESSION）。例如
+// {"transferred":524288,"total":1048576,"percent":50,"bytes":524288,"elapsedMs":2100,"bytesPerSec":262144,
+// "avgBytesPerSec":249660,"etaMs":2000,"retransmits":0,"crcErrors":0,"blockSize":1024,"paused":false,"rateLimit":0}
+//
+//export ZmodemGetStats
+func ZmodemGetStats(sessionId C.int) *C.char {
+	session := zmodem.GetSession(int(sessionId))
+	if session == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(session.Stats())
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(data))
+}
+
 // ZmodemGetStatus 获取会话状态
 // sessionId: 会话 ID
-// 返回: Status 结构体指针（需要调用者 free），nil 表示错误
+// 返回: Status 结构体指针（需要调用者 free），nil 表示会话不存在（相当于 ZMODEM_ERR_INVALID_SESSION）
 //
 //export ZmodemGetStatus
 func ZmodemGetStatus(sessionId C.int) *C.ZmodemStatus {
@@ -254,25 +689,11 @@ func ZmodemGetStatus(sessionId C.int) *C.ZmodemStatus {
 	currentStatus := session.GetStatus()
 	if currentStatus != zmodem.StatusError {
 		if impl := session.GetImpl(); impl != nil {
-			state := impl.GetState()
-			transferred := impl.GetTransferred()
-			total := impl.GetFileSize()
-
-			switch state {
-			case "completed":
-				currentStatus = zmodem.StatusCompleted
-			case "idle":
-				currentStatus = zmodem.StatusIdle
-			case "sending_eof":
-				// 如果已经发送完所有数据且处于 sending_eof，则视为已完成
-				if total > 0 && transferred >= total {
-					currentStatus = zmodem.StatusCompleted
-				} else {
-					currentStatus = zmodem.StatusActive
+			currentStatus = impl.GetState().SessionStatus()
+			if currentStatus == zmodem.StatusError {
+				if err := impl.GetError(); err != nil {
+					session.Fail(err)
 				}
-			default:
-				// 只在尚未完成时将状态视为 active，避免误报 completed
-				currentStatus = zmodem.StatusActive
 			}
 
 			session.SetStatus(currentStatus)
@@ -283,6 +704,10 @@ func ZmodemGetStatus(sessionId C.int) *C.ZmodemStatus {
 
 	cStatus := (*C.ZmodemStatus)(C.malloc(C.size_t(unsafe.Sizeof(C.ZmodemStatus{}))))
 	cStatus.status = C.int(currentStatus)
+	cStatus.code = C.int(zmodem.CodeOK)
+	if currentStatus == zmodem.StatusError {
+		cStatus.code = C.int(session.GetErrorCode())
+	}
 
 	if errorMsg != "" {
 		cStatus.message = C.CString(errorMsg)
@@ -305,19 +730,394 @@ func ZmodemFreeStatus(status *C.ZmodemStatus) {
 	}
 }
 
+// ZmodemGetDetailedState 获取协议层的详细状态
+// sessionId: 会话 ID
+// 返回: DetailedState 结构体指针（需要调用 ZmodemFreeDetailedState 释放），nil 表示会话不存在（相当于 ZMODEM_ERR_INVALID_SESSION）
+//
+//export ZmodemGetDetailedState
+func ZmodemGetDetailedState(sessionId C.int) *C.ZmodemDetailedState {
+	session := zmodem.GetSession(int(sessionId))
+	if session == nil {
+		return nil
+	}
+
+	impl := session.GetImpl()
+	if impl == nil {
+		return nil
+	}
+
+	info := impl.GetStateInfo()
+
+	cState := (*C.ZmodemDetailedState)(C.malloc(C.size_t(unsafe.Sizeof(C.ZmodemDetailedState{}))))
+	cState.state = C.int(info.State)
+	cState.name = C.CString(info.State.String())
+	cState.reason = C.CString(info.Reason)
+	cState.position = C.int64_t(info.Position)
+
+	return cState
+}
+
+// ZmodemFreeDetailedState 释放 DetailedState 结构体内存
+//
+//export ZmodemFreeDetailedState
+func ZmodemFreeDetailedState(state *C.ZmodemDetailedState) {
+	if state != nil {
+		C.free(unsafe.Pointer(state.name))
+		C.free(unsafe.Pointer(state.reason))
+		C.free(unsafe.Pointer(state))
+	}
+}
+
+// ZmodemGetResults 获取每个文件的传输结果
+// sessionId: 会话 ID
+// 返回: JSON 数组（需要调用 ZmodemFreeString 释放），nil 表示会话不存在（相当于 ZMODEM_ERR_INVALID_SESSION）。例如
+// [{"name":"a.txt","size":12,"transferred":12,"skipped":false,"completed":true,"sha256":"..."}]
+// 完整传输的文件带有 sha256（会话选项 md5 为 true 时还有 md5），失败或跳过的文件带有 error
+//
+//export ZmodemGetResults
+func ZmodemGetResults(sessionId C.int) *C.char {
+	session := zmodem.GetSession(int(sessionId))
+	if session == nil {
+		return nil
+	}
+
+	impl := session.GetImpl()
+	if impl == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(impl.Results())
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(data))
+}
+
+// ZmodemPollEvent 取出会话的下一个事件
+// sessionId: 会话 ID
+// 返回: JSON 格式的事件（需要调用 ZmodemFreeEvent 释放），nil 表示没有事件或会话不存在
+// （需要区分时调用 ZmodemGetStatus，会话不存在时它返回 nil）。例如
+// {"type":"file_offered","time":1700000000000,"file":{"index":0,"name":"a.txt","size":12,"transferred":0}}
+//
+//export ZmodemPollEvent
+func ZmodemPollEvent(sessionId C.int) *C.char {
+	session := zmodem.GetSession(int(sessionId))
+	if session == nil {
+		return nil
+	}
+
+	impl := session.GetImpl()
+	if impl == nil {
+		return nil
+	}
+
+	event, ok := impl.PollEvent()
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(data))
+}
+
+// ZmodemFreeEvent 释放 ZmodemPollEvent 返回的事件
+//
+//export ZmodemFreeEvent
+func ZmodemFreeEvent(event *C.char) {
+	if event != nil {
+		C.free(unsafe.Pointer(event))
+	}
+}
+
+// ZmodemFreeString 释放 Zmodem* 函数返回的字符串
+//
+//export ZmodemFreeString
+func ZmodemFreeString(s *C.char) {
+	if s != nil {
+		C.free(unsafe.Pointer(s))
+	}
+}
+
+// ZmodemSetCallbacks 注册事件回调，之后输出数据、进度、文件开始/结束和会话结束都由 Go 推送给宿主
+// sessionId: 会话 ID
+// callbacks: 回调函数表（结构体会被复制，调用后可以释放），其中为 NULL 的回调不调用
+// userData: 原样传给回调的宿主指针
+// 返回: ZMODEM_OK，或错误码（会话不存在为 ZMODEM_ERR_INVALID_SESSION，已注册过回调为 ZMODEM_ERR_INVALID_ARGUMENT）
+//
+// 回调在会话专属的线程上调用，不是调用 Zmodem* 函数的宿主线程；同一会话的回调不会并发。
+// 回调中可以调用同一会话的 ZmodemFeedData/ZmodemGetStatus 等函数，但不能调用 ZmodemCleanup。
+// ZmodemCleanup 会等待正在执行的回调返回，之后不会再发起新的回调。
+// 会话选项设置了 outputWindow 时，宿主写出 onOutput 的数据后需调用 ZmodemAckOutput 确认。
+//
+//export ZmodemSetCallbacks
+func ZmodemSetCallbacks(sessionId C.int, callbacks *C.ZmodemCallbacks, userData unsafe.Pointer) C.int {
+	session := zmodem.GetSession(int(sessionId))
+	if session == nil {
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+	if callbacks == nil {
+		return C.ZMODEM_ERR_INVALID_ARGUMENT
+	}
+	cb := *callbacks
+	id := C.int32_t(sessionId)
+
+	var handlers zmodem.Callbacks
+	if cb.onOutput != nil {
+		handlers.Output = func(data []byte) {
+			C.callOutputCallback(cb.onOutput, userData, id, (*C.uint8_t)(unsafe.Pointer(&data[0])), C.int32_t(len(data)))
+		}
+	}
+	if cb.onProgress != nil {
+		handlers.Progress = func(transferred, total int64) {
+			C.callProgressCallback(cb.onProgress, userData, id, C.int64_t(transferred), C.int64_t(total))
+		}
+	}
+	if cb.onFileStart != nil {
+		handlers.FileStart = func(index int, result zmodem.FileResult) {
+			cName := C.CString(result.Name)
+			defer C.free(unsafe.Pointer(cName))
+			C.callFileStartCallback(cb.onFileStart, userData, id, C.int32_t(index), cName, C.int64_t(result.Size))
+		}
+	}
+	if cb.onFileEnd != nil {
+		handlers.FileEnd = func(index int, result zmodem.FileResult) {
+			cName := C.CString(result.Name)
+			defer C.free(unsafe.Pointer(cName))
+			var cErr *C.char
+			if result.Err != nil {
+				cErr = C.CString(result.Err.Error())
+				defer C.free(unsafe.Pointer(cErr))
+			}
+			code := C.int32_t(C.ZMODEM_FILE_FAILED)
+			switch {
+			case result.Completed:
+				code = C.ZMODEM_FILE_COMPLETED
+			case result.Skipped:
+				code = C.ZMODEM_FILE_SKIPPED
+			}
+			C.callFileEndCallback(cb.onFileEnd, userData, id, C.int32_t(index), cName, C.int64_t(result.Transferred), code, cErr)
+		}
+	}
+	handlers.Finish = func(status zmodem.SessionStatus, err error) {
+		var cMsg *C.char
+		if err != nil {
+			session.Fail(err)
+			cMsg = C.CString(err.Error())
+			defer C.free(unsafe.Pointer(cMsg))
+		} else {
+			session.SetStatus(status)
+		}
+		if cb.onFinish != nil {
+			C.callFinishCallback(cb.onFinish, userData, id, C.int32_t(status), cMsg)
+		}
+	}
+
+	if err := session.SetCallbacks(handlers); err != nil {
+		return C.ZMODEM_ERR_INVALID_ARGUMENT
+	}
+	return 0
+}
+
+// ZmodemGetTrailing 取出会话结束后收到的、不属于协议的数据（如 "OO" 之后的 shell 提示符），应原样交给终端显示
+// sessionId: 会话 ID
+// 返回: Trailing 结构体指针（需要调用 ZmodemFreeTrailing 释放），nil 表示会话不存在；取出后清空
+//
+//export ZmodemGetTrailing
+func ZmodemGetTrailing(sessionId C.int) *C.ZmodemTrailing {
+	session := zmodem.GetSession(int(sessionId))
+	if session == nil {
+		return nil
+	}
+	var data []byte
+	if impl := session.GetImpl(); impl != nil {
+		data = impl.Trailing()
+	}
+
+	cTrailing := (*C.ZmodemTrailing)(C.malloc(C.size_t(unsafe.Sizeof(C.ZmodemTrailing{}))))
+	cTrailing.data = nil
+	cTrailing.len = C.int32_t(len(data))
+	if len(data) > 0 {
+		cTrailing.data = (*C.uint8_t)(C.CBytes(data))
+	}
+	return cTrailing
+}
+
+// ZmodemFreeTrailing 释放 Trailing 结构体内存
+//
+//export ZmodemFreeTrailing
+func ZmodemFreeTrailing(trailing *C.ZmodemTrailing) {
+	if trailing != nil {
+		if trailing.data != nil {
+			C.free(unsafe.Pointer(trailing.data))
+		}
+		C.free(unsafe.Pointer(trailing))
+	}
+}
+
+// ZmodemAckOutput 确认已写出 onOutput 交付的数据，腾出输出窗口（会话选项 outputWindow）
+// sessionId: 会话 ID
+// dataLen: 已写出的字节数
+// 返回: ZMODEM_OK，或错误码（会话不存在为 ZMODEM_ERR_INVALID_SESSION，dataLen 为负数为 ZMODEM_ERR_INVALID_ARGUMENT）
+//
+//export ZmodemAckOutput
+func ZmodemAckOutput(sessionId C.int, dataLen C.int) C.int {
+	session := zmodem.GetSession(int(sessionId))
+	if session == nil {
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+	if dataLen < 0 {
+		return C.ZMODEM_ERR_INVALID_ARGUMENT
+	}
+	session.AckOutput(int(dataLen))
+	return 0
+}
+
+// ZmodemPause 暂停传输：发送方在当前数据帧结束后停止发送，接收方暂存应答使对方停下
+// sessionId: 会话 ID
+// 返回: ZMODEM_OK，会话不存在为 ZMODEM_ERR_INVALID_SESSION；会话已结束或已暂停时不做任何事
+//
+//export ZmodemPause
+func ZmodemPause(sessionId C.int) C.int {
+	session := zmodem.GetSession(int(sessionId))
+	if session == nil {
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+	impl := session.GetImpl()
+	if impl == nil {
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+	impl.Pause()
+	session.Wake()
+	return 0
+}
+
+// ZmodemResume 恢复暂停的传输，从暂停的位置继续，不会重新开始当前文件
+// sessionId: 会话 ID
+// 返回: ZMODEM_OK，会话不存在为 ZMODEM_ERR_INVALID_SESSION；没有暂停时不做任何事
+//
+//export ZmodemResume
+func ZmodemResume(sessionId C.int) C.int {
+	session := zmodem.GetSession(int(sessionId))
+	if session == nil {
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+	impl := session.GetImpl()
+	if impl == nil {
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+	impl.Resume()
+	session.Wake()
+	return 0
+}
+
+// ZmodemSetRateLimit 修改会话的上传限速，传输过程中修改立即生效（只对上传会话生效）
+// sessionId: 会话 ID
+// bytesPerSec: 文件数据的速度上限（字节/秒），0 表示不限速，低于 1024 按 1024 处理
+// 返回: ZMODEM_OK，或错误码（会话不存在为 ZMODEM_ERR_INVALID_SESSION，bytesPerSec 为负数为 ZMODEM_ERR_INVALID_ARGUMENT）
+//
+//export ZmodemSetRateLimit
+func ZmodemSetRateLimit(sessionId C.int, bytesPerSec C.int64_t) C.int {
+	session := zmodem.GetSession(int(sessionId))
+	if session == nil {
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+	impl := session.GetImpl()
+	if impl == nil {
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+	if bytesPerSec < 0 {
+		return C.ZMODEM_ERR_INVALID_ARGUMENT
+	}
+	impl.SetRateLimit(int64(bytesPerSec))
+	session.Wake()
+	return 0
+}
+
+// ZmodemSetGlobalRateLimit 设置所有会话共享的上传限速，与各会话的限速同时生效
+// bytesPerSec: 所有上传会话合计的速度上限（字节/秒），0 表示不限速（默认），低于 1024 按 1024 处理
+// 返回: ZMODEM_OK，bytesPerSec 为负数为 ZMODEM_ERR_INVALID_ARGUMENT
+//
+//export ZmodemSetGlobalRateLimit
+func ZmodemSetGlobalRateLimit(bytesPerSec C.int64_t) C.int {
+	if bytesPerSec < 0 {
+		return C.ZMODEM_ERR_INVALID_ARGUMENT
+	}
+	zmodem.SetGlobalRateLimit(int64(bytesPerSec))
+	return 0
+}
+
 // ZmodemCleanup 清理会话资源
 // sessionId: 会话 ID
+// 注册了事件回调时会等待正在执行的回调返回，因此不能在回调中调用；
+// 回调被转发到宿主主线程执行的 FFI（如 koffi）应在 onFinish 之后调用，或以异步方式调用
+// 返回: ZMODEM_OK；会话不存在（或已清理）为 ZMODEM_ERR_INVALID_SESSION；
+// 释放文件时出错（如关闭协议记录文件失败）返回对应的错误码，此时会话同样已被清理
 //
 //export ZmodemCleanup
-func ZmodemCleanup(sessionId C.int) {
+func ZmodemCleanup(sessionId C.int) C.int {
 	session := zmodem.GetSession(int(sessionId))
-	if session != nil {
-		impl := session.GetImpl()
-		if impl != nil {
-			impl.Close()
+	if session == nil {
+		return C.ZMODEM_ERR_INVALID_SESSION
+	}
+
+	// 先停止事件回调，再释放引擎资源
+	zmodem.RemoveSession(int(sessionId))
+	if impl := session.GetImpl(); impl != nil {
+		if err := impl.Close(); err != nil {
+			zmodem.Logf(zmodem.LogWarn, "ZmodemCleanup: sessionId=%d, 释放会话资源失败: %v", sessionId, err)
+			return C.int(zmodem.CodeOf(err))
 		}
-		zmodem.RemoveSession(int(sessionId))
 	}
+	return 0
+}
+
+// ZmodemSetSessionLimits 设置进行中的会话数上限和空闲会话的回收时间（进程内全局生效，默认不限制）
+// configJSON: JSON 格式的限制，例如 {"maxSessions":8,"idleTimeoutMs":600000}，NULL 或空字符串表示不限制
+// 达到上限时 ZmodemInit* 返回 ZMODEM_ERR_TOO_MANY_SESSIONS；超过回收时间没有输入输出的会话会被中止并清理，
+// 其文件被关闭、未完成的 .part 被删除（会话选项 keepPartial 时保留），之后该会话 ID 返回 ZMODEM_ERR_INVALID_SESSION
+// 返回: ZMODEM_OK，配置无效时返回 ZMODEM_ERR_INVALID_ARGUMENT 并保持原配置
+//
+//export ZmodemSetSessionLimits
+func ZmodemSetSessionLimits(configJSON *C.char) C.int {
+	var data string
+	if configJSON != nil {
+		data = C.GoString(configJSON)
+	}
+	limits, err := zmodem.ParseSessionLimits(data)
+	if err != nil {
+		return C.ZMODEM_ERR_INVALID_ARGUMENT
+	}
+	zmodem.SetSessionLimits(limits)
+	return C.ZMODEM_OK
+}
+
+// ZmodemListSessions 列出所有未清理的会话（用于诊断）
+// 返回: JSON 数组（需要调用 ZmodemFreeString 释放），按会话 ID 排序，例如
+// [{"id":3,"mode":"receive","filePath":"/tmp/dl","state":"receiving_data","file":"a.bin","transferred":524288,
+// "total":1048576,"paused":false,"callbacks":true,"idleMs":120}]
+//
+//export ZmodemListSessions
+func ZmodemListSessions() *C.char {
+	data, err := json.Marshal(zmodem.ListSessions())
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(data))
+}
+
+// ZmodemCleanupAll 清理所有会话（宿主退出时调用）：中止未结束的传输并释放文件
+// 与 ZmodemCleanup 一样会等待正在执行的回调返回，不能在回调中调用
+// 返回: ZMODEM_OK，或第一个释放文件失败的错误码（所有会话同样已被清理）
+//
+//export ZmodemCleanupAll
+func ZmodemCleanupAll() C.int {
+	if err := zmodem.CleanupAll(); err != nil {
+		zmodem.Logf(zmodem.LogWarn, "ZmodemCleanupAll: 释放会话资源失败: %v", err)
+		return C.int(zmodem.CodeOf(err))
+	}
+	return 0
 }
 
 func main() {
@@ -0,0 +1,97 @@
+package zmodem
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// FuncSource 由回调函数提供数据的 FileSource（如 C API 中由宿主提供的文件内容）
+type FuncSource struct {
+	FileInfo   FileInfo
+	ReadAtFunc func(p []byte, off int64) (int, error) // 语义同 io.ReaderAt
+	CloseFunc  func() error                           // 可为 nil
+}
+
+// Info 返回文件信息
+func (s *FuncSource) Info() FileInfo {
+	return s.FileInfo
+}
+
+// ReadAt 调用 ReadAtFunc 读取数据
+func (s *FuncSource) ReadAt(p []byte, off int64) (int, error) {
+	return s.ReadAtFunc(p, off)
+}
+
+// Close 调用 CloseFunc
+func (s *FuncSource) Close() error {
+	if s.CloseFunc == nil {
+		return nil
+	}
+	return s.CloseFunc()
+}
+
+// SinkFunc 将函数适配为 Sink
+type SinkFunc func(info FileInfo) (FileWriter, error)
+
+// Create 调用 f 创建写入目标
+func (f SinkFunc) Create(info FileInfo) (FileWriter, error) {
+	return f(info)
+}
+
+// FuncWriter 由回调函数消费数据的 FileWriter
+type FuncWriter struct {
+	WriteAtFunc func(p []byte, off int64) (int, error) // 语义同 io.WriterAt
+	CommitFunc  func() error                           // 可为 nil
+	AbortFunc   func() error                           // 可为 nil
+}
+
+// WriteAt 调用 WriteAtFunc 写入数据
+func (w *FuncWriter) WriteAt(p []byte, off int64) (int, error) {
+	return w.WriteAtFunc(p, off)
+}
+
+// Commit 调用 CommitFunc
+func (w *FuncWriter) Commit() error {
+	if w.CommitFunc == nil {
+		return nil
+	}
+	return w.CommitFunc()
+}
+
+// Abort 调用 AbortFunc
+func (w *FuncWriter) Abort() error {
+	if w.AbortFunc == nil {
+		return nil
+	}
+	return w.AbortFunc()
+}
+
+// fileInfoJSON 宿主以 JSON 描述的文件信息
+type fileInfoJSON struct {
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	MTime int64  `json:"mtime"` // Unix 时间戳（秒），0 表示未知
+	Mode  uint32 `json:"mode"`  // 权限位，如 420 (0644)
+}
+
+// ParseFileInfos 解析 JSON 格式的文件列表，例如 [{"name":"a.txt","size":12,"mtime":1700000000,"mode":420}]
+func ParseFileInfos(data string) ([]FileInfo, error) {
+	var items []fileInfoJSON
+	if err := json.Unmarshal([]byte(data), &items); err != nil {
+		return nil, fmt.Errorf("解析文件列表失败: %w", err)
+	}
+	infos := make([]FileInfo, 0, len(items))
+	for _, item := range items {
+		if item.Name == "" || item.Size < 0 {
+			return nil, fmt.Errorf("解析文件列表失败: 文件名为空或大小无效")
+		}
+		info := FileInfo{Name: item.Name, Size: item.Size, Mode: os.FileMode(item.Mode).Perm()}
+		if item.MTime > 0 {
+			info.ModTime = time.Unix(item.MTime, 0)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
@@ -0,0 +1,136 @@
+package zmodem
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// Charset 远端（ZFILE 中）文件名使用的字符集，如 "gbk"、"big5"、"shift-jis"、"latin-1"，空值表示 UTF-8
+type Charset string
+
+// charsets 支持的字符集，键为去掉 "-"、"_" 后的小写名称；值为 nil 表示 UTF-8
+var charsets = map[string]encoding.Encoding{
+	"":         nil,
+	"utf8":     nil,
+	"gbk":      simplifiedchinese.GBK,
+	"gb2312":   simplifiedchinese.GBK,
+	"cp936":    simplifiedchinese.GBK,
+	"gb18030":  simplifiedchinese.GB18030,
+	"big5":     traditionalchinese.Big5,
+	"shiftjis": japanese.ShiftJIS,
+	"sjis":     japanese.ShiftJIS,
+	"latin1":   charmap.ISO8859_1,
+	"iso88591": charmap.ISO8859_1,
+}
+
+// lookupCharset 查找字符集对应的编码
+func lookupCharset(name string) (encoding.Encoding, bool) {
+	key := strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+	enc, ok := charsets[key]
+	return enc, ok
+}
+
+// UnmarshalText 校验字符集名称（用于 JSON 会话选项）
+func (c *Charset) UnmarshalText(text []byte) error {
+	if _, ok := lookupCharset(string(text)); !ok {
+		return fmt.Errorf("不支持的字符集: %q", text)
+	}
+	*c = Charset(text)
+	return nil
+}
+
+// nameCodec 在远端字符集与 UTF-8 之间转换 ZFILE 中的文件名
+type nameCodec struct {
+	enc  encoding.Encoding                                        // nil 表示 UTF-8，不需要转换
+	logf func(level LogLevel, format string, args ...interface{}) // 记录日志，nil 时使用 Logf
+}
+
+// log 记录转换过程中的日志
+func (c nameCodec) log(level LogLevel, format string, args ...interface{}) {
+	if c.logf != nil {
+		c.logf(level, format, args...)
+		return
+	}
+	Logf(level, format, args...)
+}
+
+// newNameCodec 创建文件名转换器，不支持的字符集按 UTF-8 处理
+func newNameCodec(charset Charset) nameCodec {
+	enc, ok := lookupCharset(string(charset))
+	if !ok {
+		logWarnf("不支持的字符集 %q，按 UTF-8 处理", charset)
+	}
+	return nameCodec{enc: enc}
+}
+
+// decode 将对方发来的文件名转换为 UTF-8
+// 含有该字符集中无效的字节序列时，返回转义后的安全名称（见 escapeName）
+func (c nameCodec) decode(raw []byte) string {
+	if isASCII(raw) {
+		return string(raw)
+	}
+	if c.enc == nil {
+		if utf8.Valid(raw) {
+			return string(raw)
+		}
+		return escapeName(raw)
+	}
+	decoded, err := c.enc.NewDecoder().Bytes(raw)
+	if err != nil || bytes.ContainsRune(decoded, utf8.RuneError) {
+		c.log(LogInfo, "文件名不是有效的字符集编码，使用转义名称: %q", raw)
+		return escapeName(raw)
+	}
+	return string(decoded)
+}
+
+// encode 将本地文件名转换为远端字符集，无法表示的字符替换为 "_"
+func (c nameCodec) encode(name string) []byte {
+	if c.enc == nil {
+		return []byte(name)
+	}
+	if encoded, err := c.enc.NewEncoder().Bytes([]byte(name)); err == nil {
+		return encoded
+	}
+	c.log(LogInfo, "文件名包含远端字符集无法表示的字符: %q", name)
+	var out []byte
+	for _, r := range name {
+		encoded, err := c.enc.NewEncoder().Bytes([]byte(string(r)))
+		if err != nil || r == utf8.RuneError {
+			out = append(out, '_')
+			continue
+		}
+		out = append(out, encoded...)
+	}
+	return out
+}
+
+// escapeName 将无法解码的文件名转换为只含可打印 ASCII 的名称：其余字节（以及 "%"）写作 %XX
+func escapeName(raw []byte) string {
+	var b strings.Builder
+	for _, c := range raw {
+		if c >= 0x20 && c < 0x7f && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// isASCII 判断数据是否全部为 ASCII
+func isASCII(data []byte) bool {
+	for _, c := range data {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
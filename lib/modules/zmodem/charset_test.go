@@ -0,0 +1,92 @@
+package zmodem
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestNameCodecDecode 按远端字符集解码文件名，无效编码回退为 %XX 转义名称
+func TestNameCodecDecode(t *testing.T) {
+	tests := []struct {
+		charset Charset
+		raw     []byte
+		want    string
+	}{
+		{"gbk", []byte("\xd6\xd0\xce\xc4.txt"), "中文.txt"},
+		{"GB-2312", []byte("\xd6\xd0\xce\xc4.txt"), "中文.txt"},
+		{"gb18030", []byte("\xd6\xd0\xce\xc4.txt"), "中文.txt"},
+		{"big5", []byte("\xa4\xa4\xa4\xe5.txt"), "中文.txt"},
+		{"shift_jis", []byte("\x93\xfa\x96\x7b.txt"), "日本.txt"},
+		{"latin-1", []byte("caf\xe9.txt"), "café.txt"},
+		{"", []byte("中文.txt"), "中文.txt"},
+		{"gbk", []byte("plain.txt"), "plain.txt"},
+
+		// UTF-8 会话收到 GBK 编码的文件名
+		{"", []byte("\xd6\xd0\xce\xc4.txt"), "%D6%D0%CE%C4.txt"},
+		// GBK 中无效的字节
+		{"gbk", []byte("a\xff.txt"), "a%FF.txt"},
+		// 转义时 "%" 本身也要转义，避免与转义序列混淆
+		{"gbk", []byte("100%\xff"), "100%25%FF"},
+		// 不支持的字符集按 UTF-8 处理
+		{"ebcdic", []byte("\xd6\xd0.txt"), "%D6%D0.txt"},
+	}
+	for _, tt := range tests {
+		if got := newNameCodec(tt.charset).decode(tt.raw); got != tt.want {
+			t.Errorf("charset=%q: decode(%q) = %q，期望 %q", tt.charset, tt.raw, got, tt.want)
+		}
+	}
+}
+
+// TestNameCodecEncode 按远端字符集编码文件名，无法表示的字符替换为 "_"
+func TestNameCodecEncode(t *testing.T) {
+	tests := []struct {
+		charset Charset
+		name    string
+		want    []byte
+	}{
+		{"gbk", "中文.txt", []byte("\xd6\xd0\xce\xc4.txt")},
+		{"big5", "中文.txt", []byte("\xa4\xa4\xa4\xe5.txt")},
+		{"latin-1", "café.txt", []byte("caf\xe9.txt")},
+		{"", "中文.txt", []byte("中文.txt")},
+		{"gbk", "a😀b.txt", []byte("a_b.txt")},
+		{"latin-1", "日本.txt", []byte("__.txt")},
+		{"gbk", "中😀.txt", []byte("\xd6\xd0_.txt")},
+	}
+	for _, tt := range tests {
+		if got := newNameCodec(tt.charset).encode(tt.name); !bytes.Equal(got, tt.want) {
+			t.Errorf("charset=%q: encode(%q) = %q，期望 %q", tt.charset, tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestCharsetOption 会话选项中的字符集名称不区分大小写和分隔符，不支持的名称报错
+func TestCharsetOption(t *testing.T) {
+	for _, name := range []string{"GBK", "gb_2312", "Shift-JIS", "ISO-8859-1", "utf-8", ""} {
+		if _, err := ParseOptions(`{"remoteCharset":"` + name + `"}`); err != nil {
+			t.Errorf("字符集 %q 应被接受: %v", name, err)
+		}
+	}
+	if _, err := ParseOptions(`{"remoteCharset":"ebcdic"}`); err == nil {
+		t.Error("不支持的字符集应报错")
+	}
+}
+
+// TestRemoteCharsetTransfer 双方都使用 GBK 时，ZFILE 中的文件名为 GBK 编码，接收方还原为原来的名称
+func TestRemoteCharsetTransfer(t *testing.T) {
+	files := []loopFile{{"中文.txt", []byte("hello")}, {"a😀.txt", []byte("world")}}
+	opts := Options{RemoteCharset: "gbk"}
+	sender := NewSender(memorySources(files), opts)
+	sink := NewMemorySink()
+	receiver := NewReceiver(sink, opts)
+
+	newLoopback(t, sender, receiver).run()
+
+	got := sink.Files()
+	if len(got) != 2 || got[0].Info.Name != "中文.txt" || got[1].Info.Name != "a_.txt" {
+		t.Fatalf("接收到的文件 = %+v", got)
+	}
+	info := encodeFileInfo(FileInfo{Name: "中文.txt", Size: 5}, newNameCodec("gbk"), 0, 0)
+	if !bytes.HasPrefix(info, []byte("\xd6\xd0\xce\xc4.txt\x00")) {
+		t.Errorf("ZFILE 中的文件名不是 GBK 编码: %q", info)
+	}
+}
@@ -0,0 +1,93 @@
+package zmodem
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// ErrorCode 稳定的数字错误码（C API 的返回值），宿主可以据此显示本地化的错误信息
+// 取值只会追加，不会改变已有的编号
+type ErrorCode int
+
+const (
+	CodeOK               ErrorCode = 0   // 成功
+	CodeInvalidSession   ErrorCode = -1  // 会话不存在（或已清理）
+	CodeInvalidArgument  ErrorCode = -2  // 参数无效（空指针、无法解析的 JSON 等）
+	CodeNotFound         ErrorCode = -3  // 文件或目录不存在
+	CodePermission       ErrorCode = -4  // 没有权限
+	CodeDiskFull         ErrorCode = -5  // 本地或远端磁盘空间不足
+	CodeIO               ErrorCode = -6  // 其他文件读写错误
+	CodeProtocol         ErrorCode = -7  // 对方违反协议
+	CodeCRCExhausted     ErrorCode = -8  // 数据反复校验失败，重传次数超过上限
+	CodePeerCancelled    ErrorCode = -9  // 对方取消了传输
+	CodeTimeout          ErrorCode = -10 // 等待对方响应超时
+	CodeCancelled        ErrorCode = -11 // 本端取消了传输
+	CodeUnsafePath       ErrorCode = -12 // 对方提供的文件名不安全
+	CodeConnectionClosed ErrorCode = -13 // 传输完成前连接已断开
+	CodeInternal         ErrorCode = -14 // 其他错误
+	CodeTooManySessions  ErrorCode = -15 // 进行中的会话数已达到上限
+)
+
+var errorCodeNames = map[ErrorCode]string{
+	CodeOK:               "ok",
+	CodeInvalidSession:   "invalid_session",
+	CodeInvalidArgument:  "invalid_argument",
+	CodeNotFound:         "not_found",
+	CodePermission:       "permission",
+	CodeDiskFull:         "disk_full",
+	CodeIO:               "io",
+	CodeProtocol:         "protocol_violation",
+	CodeCRCExhausted:     "crc_exhausted",
+	CodePeerCancelled:    "cancelled_by_peer",
+	CodeTimeout:          "timeout",
+	CodeCancelled:        "cancelled",
+	CodeUnsafePath:       "unsafe_path",
+	CodeConnectionClosed: "connection_closed",
+	CodeInternal:         "internal",
+	CodeTooManySessions:  "too_many_sessions",
+}
+
+// String 返回错误码的英文名称，如 "disk_full"
+func (c ErrorCode) String() string {
+	if name, ok := errorCodeNames[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// CodeOf 返回错误对应的错误码，nil 返回 CodeOK
+func CodeOf(err error) ErrorCode {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	switch {
+	case err == nil:
+		return CodeOK
+	case errors.Is(err, ErrCancelled):
+		return CodeCancelled
+	case errors.Is(err, ErrPeerCancelled):
+		return CodePeerCancelled
+	case errors.Is(err, ErrRetriesExhausted):
+		return CodeCRCExhausted
+	case errors.Is(err, ErrTimeout):
+		return CodeTimeout
+	case errors.Is(err, ErrUnsafePath):
+		return CodeUnsafePath
+	case errors.Is(err, ErrProtocol):
+		return CodeProtocol
+	case errors.Is(err, ErrConnectionClosed):
+		return CodeConnectionClosed
+	case errors.Is(err, ErrTooManySessions):
+		return CodeTooManySessions
+	case errors.Is(err, ErrDiskFull) || isDiskFull(err):
+		return CodeDiskFull
+	case errors.Is(err, fs.ErrNotExist):
+		return CodeNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return CodePermission
+	case errors.As(err, &pathErr) || errors.As(err, &linkErr):
+		return CodeIO
+	default:
+		return CodeInternal
+	}
+}
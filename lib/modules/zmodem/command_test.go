@@ -0,0 +1,74 @@
+package zmodem
+
+import (
+	"testing"
+)
+
+// newIdleEngine 创建已发出第一个帧头（ZRQINIT 或 ZRINIT）、正在等待对方的发送方或接收方
+func newIdleEngine(mode int) *ZmodemImpl {
+	var z *ZmodemImpl
+	if mode == modeSend {
+		z = NewSender([]FileSource{NewMemorySource(FileInfo{Name: "a.txt"}, []byte("hello"))}, Options{})
+	} else {
+		z = NewReceiver(NewMemorySink(), Options{})
+	}
+	drain(z)
+	return z
+}
+
+// parseReply 解析引擎输出中的第一个帧
+func parseReply(t *testing.T, out []byte) *ZmodemFrame {
+	t.Helper()
+	p := NewFrameParser()
+	p.AddData(out)
+	frame, err := p.ParseFrame()
+	if err != nil || frame == nil {
+		t.Fatalf("输出 %q 中没有完整的帧: %v", out, err)
+	}
+	return frame
+}
+
+// TestRefuseCommand 收到 ZCOMMAND 时从不执行，以 ZCOMPL 返回失败状态 1，会话继续
+func TestRefuseCommand(t *testing.T) {
+	command := append(BuildBinaryHeader(FrameZCOMMAND, [4]byte{}, true, false),
+		BuildDataSubpacket([]byte("touch /tmp/pwned\x00"), ZCRCW, true, false)...)
+
+	for _, mode := range []int{modeSend, modeReceive} {
+		t.Run(map[int]string{modeSend: "sender", modeReceive: "receiver"}[mode], func(t *testing.T) {
+			z := newIdleEngine(mode)
+			state := z.GetState()
+			if err := z.FeedData(command); err != nil {
+				t.Fatalf("输入 ZCOMMAND 失败: %v", err)
+			}
+
+			reply := parseReply(t, drain(z))
+			if reply.Type != FrameZCOMPL || reply.Position() != zcomplRefused {
+				t.Fatalf("回复 = %s(%d)，期望 ZCOMPL(%d)", reply.Type, reply.Position(), zcomplRefused)
+			}
+			if got := z.GetState(); got != state || z.GetError() != nil {
+				t.Fatalf("拒绝命令后状态 = %s (%v)，期望保持 %s", got, z.GetError(), state)
+			}
+		})
+	}
+}
+
+// TestAnswerChallenge 收到 ZCHALLENGE 时把其中的随机数原样放入 ZACK 返回
+func TestAnswerChallenge(t *testing.T) {
+	for _, mode := range []int{modeSend, modeReceive} {
+		for _, challenge := range []uint32{0, 1, 0xDEADBEEF, 0xFFFFFFFF} {
+			z := newIdleEngine(mode)
+			state := z.GetState()
+			if err := z.FeedData(BuildHexHeader(FrameZCHALLENGE, positionHeader(challenge))); err != nil {
+				t.Fatalf("输入 ZCHALLENGE 失败: %v", err)
+			}
+
+			reply := parseReply(t, drain(z))
+			if reply.Type != FrameZACK || reply.Position() != challenge {
+				t.Fatalf("mode=%d: 回复 = %s(0x%08x)，期望 ZACK(0x%08x)", mode, reply.Type, reply.Position(), challenge)
+			}
+			if got := z.GetState(); got != state {
+				t.Fatalf("mode=%d: 响应 ZCHALLENGE 后状态 = %s，期望保持 %s", mode, got, state)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package zmodem
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// fileDigest 在传输过程中按文件顺序流式计算摘要
+//
+// 数据可能因重传而重复出现（发送方收到 ZRPOS 后回退），已计入的部分会被忽略，
+// 因此最终结果与对完整文件运行 sha256sum/md5sum 一致。
+type fileDigest struct {
+	sha256 hash.Hash
+	md5    hash.Hash // 未启用 MD5 时为 nil
+	pos    int64     // 已计入摘要的字节数
+	broken bool      // 出现了无法补齐的空缺，摘要不可用
+}
+
+// newFileDigest 创建摘要计算器，withMD5 为 true 时同时计算 MD5
+func newFileDigest(withMD5 bool) *fileDigest {
+	d := &fileDigest{sha256: sha256.New()}
+	if withMD5 {
+		d.md5 = md5.New()
+	}
+	return d
+}
+
+// add 计入从 off 开始的数据，其中已计入的部分被忽略
+// off 超过已计入的位置说明中间有空缺，调用方应先用 fill 补齐
+func (d *fileDigest) add(p []byte, off int64) {
+	if off > d.pos {
+		d.broken = true
+		return
+	}
+	if skip := d.pos - off; skip < int64(len(p)) {
+		d.write(p[skip:])
+	}
+}
+
+// fill 从 r 读取 [pos, end) 的数据计入摘要（如续传时已有的数据）
+func (d *fileDigest) fill(r io.ReaderAt, end int64) {
+	if d.pos >= end {
+		return
+	}
+	if _, err := io.Copy(hashWriter{d}, io.NewSectionReader(r, d.pos, end-d.pos)); err != nil || d.pos != end {
+		d.broken = true
+	}
+}
+
+// write 将数据写入各摘要
+func (d *fileDigest) write(p []byte) {
+	d.sha256.Write(p)
+	if d.md5 != nil {
+		d.md5.Write(p)
+	}
+	d.pos += int64(len(p))
+}
+
+// sums 返回十六进制的 SHA-256 和 MD5（未启用或不可用时为空）
+func (d *fileDigest) sums() (sha256Hex, md5Hex string) {
+	if d.broken {
+		return "", ""
+	}
+	sha256Hex = hex.EncodeToString(d.sha256.Sum(nil))
+	if d.md5 != nil {
+		md5Hex = hex.EncodeToString(d.md5.Sum(nil))
+	}
+	return sha256Hex, md5Hex
+}
+
+// hashWriter 将 fileDigest 适配为 io.Writer
+type hashWriter struct {
+	d *fileDigest
+}
+
+func (w hashWriter) Write(p []byte) (int, error) {
+	w.d.write(p)
+	return len(p), nil
+}
@@ -0,0 +1,111 @@
+package zmodem
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// pollInterval 没有输入时检查超时重试的间隔
+	pollInterval = 10 * time.Millisecond
+	// ioBufferSize 读写 rw 时使用的缓冲区大小
+	ioBufferSize = 32 * 1024
+)
+
+// Send 通过 rw 向对方（如远端的 rz）发送 files 中的文件，返回每个文件的传输结果
+//
+// files 在返回前都会被关闭。ctx 被取消时向对方发送取消序列并返回 ErrCancelled。
+// rw 的 Read 会在后台 goroutine 中调用，返回后如果 Read 仍阻塞，需要调用方关闭连接使其返回。
+func Send(ctx context.Context, rw io.ReadWriter, files []FileSource, opts Options) ([]FileResult, error) {
+	z := NewSender(files, opts)
+	defer z.Close()
+	return run(ctx, rw, z)
+}
+
+// Receive 通过 rw 接收对方（如远端的 sz）发送的文件，每个文件通过 sink 创建写入目标
+//
+// ctx 被取消时向对方发送取消序列并返回 ErrCancelled。
+// rw 的 Read 会在后台 goroutine 中调用，返回后如果 Read 仍阻塞，需要调用方关闭连接使其返回。
+func Receive(ctx context.Context, rw io.ReadWriter, sink Sink, opts Options) ([]FileResult, error) {
+	z := NewReceiver(sink, opts)
+	defer z.Close()
+	return run(ctx, rw, z)
+}
+
+// run 在 rw 上驱动引擎直到会话结束
+func run(ctx context.Context, rw io.ReadWriter, z *ZmodemImpl) ([]FileResult, error) {
+	if z.opts.Trace != "" {
+		if err := z.StartTraceFile(z.opts.Trace); err != nil {
+			return nil, err
+		}
+	}
+
+	input := make(chan []byte, 16)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			buf := make([]byte, ioBufferSize)
+			n, err := rw.Read(buf)
+			if n > 0 {
+				select {
+				case input <- buf[:n]:
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	out := make([]byte, ioBufferSize)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// 写出所有待发送的数据；流式发送期间顺带处理对方的输入（如 ZRPOS）
+		for {
+			n, _ := z.GetOutputData(out)
+			if n == 0 {
+				break
+			}
+			if _, err := rw.Write(out[:n]); err != nil {
+				z.Abort(fmt.Errorf("写入数据失败: %w", err))
+				return z.Results(), z.GetError()
+			}
+			select {
+			case data := <-input:
+				z.FeedData(data)
+			default:
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		if z.GetState().IsTerminal() {
+			return z.Results(), z.GetError()
+		}
+
+		select {
+		case data := <-input:
+			z.FeedData(data)
+		case err := <-readErr:
+			if err == io.EOF {
+				err = nil
+			}
+			z.InputClosed(err)
+		case <-ctx.Done():
+			// 会话进入 error 状态，下一轮循环写出取消序列后返回
+			z.Abort(fmt.Errorf("%w: %w", ErrCancelled, context.Cause(ctx)))
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package zmodem
+
+import "errors"
+
+var (
+	// ErrCancelled 本端取消了传输（如 ctx 被取消）
+	ErrCancelled = errors.New("传输已取消")
+	// ErrPeerCancelled 对方取消了传输（CAN 序列、ZABORT 或 ZFERR）
+	ErrPeerCancelled = errors.New("对方取消了传输")
+	// ErrTimeout 多次重试后仍未收到对方响应
+	ErrTimeout = errors.New("等待对方响应超时")
+	// ErrSkipFile 由 Sink.Create 返回，表示跳过该文件（接收方回复 ZSKIP）
+	ErrSkipFile = errors.New("跳过文件")
+	// ErrUnsafePath 对方提供的文件名试图写到接收目录之外（绝对路径、".."、设备名或符号链接）
+	ErrUnsafePath = errors.New("不安全的文件路径")
+	// ErrProtocol 对方违反了协议（如收到的字节数与声明的大小不一致）
+	ErrProtocol = errors.New("协议错误")
+	// ErrRetriesExhausted 数据反复校验失败、重传次数超过上限
+	ErrRetriesExhausted = errors.New("重传次数过多")
+	// ErrDiskFull 本地或远端磁盘空间不足
+	ErrDiskFull = errors.New("磁盘空间不足")
+	// ErrConnectionClosed 传输完成前连接已断开
+	ErrConnectionClosed = errors.New("连接已断开")
+	// ErrTooManySessions 进行中的会话数已达到上限（见 SessionLimits.MaxSessions）
+	ErrTooManySessions = errors.New("进行中的会话过多")
+)
@@ -0,0 +1,133 @@
+package zmodem
+
+// EventType 会话事件类型
+type EventType string
+
+const (
+	EventSessionStart EventType = "session_start" // 会话开始，Direction 为 "send" 或 "receive"
+	EventFileOffered  EventType = "file_offered"  // 发出或收到 ZFILE
+	EventFileProgress EventType = "file_progress" // 当前文件的进度（队列中相邻的进度事件会合并）
+	EventFileSkipped  EventType = "file_skipped"  // 文件被跳过，Reason 为原因（可为空）
+	EventFileComplete EventType = "file_complete" // 文件完整传输，附带摘要
+	EventFileFailed   EventType = "file_failed"   // 文件因会话出错而未完成
+	EventRetry        EventType = "retry"         // 超时、数据错误等导致的重传
+	EventSessionEnd   EventType = "session_end"   // 会话结束，附带结果汇总
+)
+
+// maxQueuedEvents 事件队列的最大长度，超出时丢弃最早的事件
+const maxQueuedEvents = 1024
+
+// EventFile 事件涉及的文件
+type EventFile struct {
+	Index       int    `json:"index"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	MTime       int64  `json:"mtime,omitempty"` // Unix 秒
+	Transferred int64  `json:"transferred"`
+	SHA256      string `json:"sha256,omitempty"`
+	MD5         string `json:"md5,omitempty"`
+}
+
+// EventSummary 会话结束时的结果汇总
+type EventSummary struct {
+	Files     int   `json:"files"`
+	Completed int   `json:"completed"`
+	Skipped   int   `json:"skipped"`
+	Failed    int   `json:"failed"`
+	Bytes     int64 `json:"bytes"` // 所有文件实际传输的字节数
+}
+
+// Event 会话事件（C API 的 ZmodemPollEvent 以 JSON 返回）
+type Event struct {
+	Type      EventType     `json:"type"`
+	Time      int64         `json:"time"` // Unix 毫秒
+	Direction string        `json:"direction,omitempty"`
+	File      *EventFile    `json:"file,omitempty"`
+	Reason    string        `json:"reason,omitempty"`
+	Status    string        `json:"status,omitempty"` // session_end: "completed" 或 "error"
+	Error     string        `json:"error,omitempty"`
+	Code      ErrorCode     `json:"code,omitempty"` // 错误码（见 ErrorCode）
+	Summary   *EventSummary `json:"summary,omitempty"`
+}
+
+// PollEvent 取出下一个事件，没有事件时 ok 为 false
+func (z *ZmodemImpl) PollEvent() (event Event, ok bool) {
+	z.mu.Lock()
+	defer z.unlock()
+	if len(z.events) == 0 {
+		return Event{}, false
+	}
+	event = z.events[0]
+	z.events = z.events[1:]
+	return event, true
+}
+
+// emit 将事件加入队列（调用方持有 z.mu）
+func (z *ZmodemImpl) emit(event Event) {
+	event.Time = z.now().UnixMilli()
+	if n := len(z.events); n > 0 && event.Type == EventFileProgress && z.events[n-1].Type == EventFileProgress {
+		z.events[n-1] = event
+		return
+	}
+	if len(z.events) >= maxQueuedEvents {
+		z.events = z.events[1:]
+	}
+	z.events = append(z.events, event)
+}
+
+// emitFile 发出与当前文件有关的事件
+func (z *ZmodemImpl) emitFile(t EventType, reason string) {
+	r := z.currentResult()
+	if r == nil {
+		return
+	}
+	file := &EventFile{
+		Index:       len(z.results) - 1,
+		Name:        r.Name,
+		Size:        r.Size,
+		Transferred: z.transferred,
+		SHA256:      r.SHA256,
+		MD5:         r.MD5,
+	}
+	z.emit(Event{Type: t, File: file, Reason: reason, Code: CodeOf(r.Err)})
+}
+
+// retry 发出 retry 事件并计入重传次数（见 Stats）
+func (z *ZmodemImpl) retry(reason string) {
+	z.stats.retransmits++
+	z.emitFile(EventRetry, reason)
+}
+
+// emitOffered 发出 file_offered 事件
+func (z *ZmodemImpl) emitOffered(info FileInfo) {
+	file := &EventFile{Index: len(z.results) - 1, Name: info.Name, Size: info.Size}
+	if !info.ModTime.IsZero() {
+		file.MTime = info.ModTime.Unix()
+	}
+	z.emit(Event{Type: EventFileOffered, File: file})
+}
+
+// emitSessionEnd 发出会话结束事件及结果汇总
+func (z *ZmodemImpl) emitSessionEnd() {
+	summary := &EventSummary{Files: len(z.results)}
+	for _, r := range z.results {
+		switch {
+		case r.Completed:
+			summary.Completed++
+		case r.Skipped:
+			summary.Skipped++
+		default:
+			summary.Failed++
+		}
+		summary.Bytes += r.Transferred
+	}
+	event := Event{Type: EventSessionEnd, Status: "completed", Summary: summary}
+	if z.state == StateError {
+		event.Status = "error"
+		if z.err != nil {
+			event.Error = z.err.Error()
+			event.Code = CodeOf(z.err)
+		}
+	}
+	z.emit(event)
+}
@@ -0,0 +1,194 @@
+package zmodem
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// pollAll 取出队列中的全部事件
+func pollAll(z *ZmodemImpl) []Event {
+	var events []Event
+	for {
+		ev, ok := z.PollEvent()
+		if !ok {
+			return events
+		}
+		events = append(events, ev)
+	}
+}
+
+// eventTypes 事件类型序列，相邻的 file_progress 合并为一个
+func eventTypes(events []Event) []EventType {
+	var types []EventType
+	for _, ev := range events {
+		if n := len(types); n > 0 && ev.Type == EventFileProgress && types[n-1] == EventFileProgress {
+			continue
+		}
+		types = append(types, ev.Type)
+	}
+	return types
+}
+
+// TestEventOrder 批量传输时双方的事件顺序：会话开始，每个文件依次 offered → progress → complete/skipped，最后会话结束
+func TestEventOrder(t *testing.T) {
+	files := []loopFile{{"a.bin", testPayload(20000)}, {"skip.bin", testPayload(100)}, {"c.bin", testPayload(3000)}}
+	sink := NewMemorySink()
+	sender := NewSender(memorySources(files), Options{})
+	receiver := NewReceiver(SinkFunc(func(info FileInfo) (FileWriter, error) {
+		if info.Name == "skip.bin" {
+			return nil, ErrSkipFile
+		}
+		return sink.Create(info)
+	}), Options{})
+
+	var sent, received []Event
+	l := newLoopback(t, sender, receiver)
+	start := l.clock
+	l.onStep = func(l *loopback) {
+		// 边传输边取出，与宿主的用法一致
+		sent = append(sent, pollAll(sender)...)
+		received = append(received, pollAll(receiver)...)
+	}
+	l.run()
+	sent = append(sent, pollAll(sender)...)
+	received = append(received, pollAll(receiver)...)
+
+	want := []EventType{
+		EventSessionStart,
+		EventFileOffered, EventFileProgress, EventFileComplete,
+		EventFileOffered, EventFileSkipped,
+		EventFileOffered, EventFileProgress, EventFileComplete,
+		EventSessionEnd,
+	}
+	for name, events := range map[string][]Event{"sender": sent, "receiver": received} {
+		if got := eventTypes(events); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s 事件顺序 = %v\n期望 %v", name, got, want)
+			continue
+		}
+		for i, ev := range events {
+			if i > 0 && ev.Time < events[i-1].Time {
+				t.Errorf("%s 事件时间倒退: %v", name, events)
+			}
+			// 事件时间取自引擎的时钟（这里是虚拟时钟）
+			if ev.Time < start.UnixMilli() || ev.Time > l.clock.UnixMilli() {
+				t.Errorf("%s 事件时间 %d 不在虚拟时钟范围 [%d, %d] 内", name, ev.Time, start.UnixMilli(), l.clock.UnixMilli())
+				break
+			}
+		}
+		end := events[len(events)-1]
+		wantSummary := EventSummary{Files: 3, Completed: 2, Skipped: 1, Bytes: 23000}
+		if end.Status != "completed" || end.Summary == nil || *end.Summary != wantSummary {
+			t.Errorf("%s 会话结束事件 = %+v，汇总 %+v", name, end, end.Summary)
+		}
+	}
+	if sent[0].Direction != "send" || received[0].Direction != "receive" {
+		t.Errorf("session_start 的 direction 不正确: %q, %q", sent[0].Direction, received[0].Direction)
+	}
+}
+
+// TestEventQueue 相邻的进度事件合并为最新的一条，队列超出上限时丢弃最早的事件
+func TestEventQueue(t *testing.T) {
+	z := newImpl(modeReceive, Options{})
+	z.emit(Event{Type: EventFileOffered})
+	for i := int64(1); i <= 5; i++ {
+		z.emit(Event{Type: EventFileProgress, File: &EventFile{Transferred: i}})
+	}
+	z.emit(Event{Type: EventRetry})
+	z.emit(Event{Type: EventFileProgress, File: &EventFile{Transferred: 6}})
+
+	events := pollAll(z)
+	if got := eventTypes(events); len(events) != 4 || !reflect.DeepEqual(got, []EventType{EventFileOffered, EventFileProgress, EventRetry, EventFileProgress}) {
+		t.Fatalf("事件 = %v", got)
+	}
+	if events[1].File.Transferred != 5 {
+		t.Fatalf("合并后的进度 = %d，期望最新的 5", events[1].File.Transferred)
+	}
+
+	for i := 0; i < maxQueuedEvents+10; i++ {
+		z.emit(Event{Type: EventRetry, Reason: string(rune('a' + i%26))})
+	}
+	events = pollAll(z)
+	if len(events) != maxQueuedEvents {
+		t.Fatalf("队列长度 = %d，期望 %d", len(events), maxQueuedEvents)
+	}
+	if events[0].Reason != string(rune('a'+10)) {
+		t.Fatalf("应丢弃最早的 10 个事件，队首为 %q", events[0].Reason)
+	}
+}
+
+// jsonKeys 返回 JSON 对象的键（按字母排序）
+func jsonKeys(t *testing.T, obj map[string]any) []string {
+	t.Helper()
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestEventJSON 事件的 JSON 形状：只输出与事件类型相关的字段，零值字段省略
+func TestEventJSON(t *testing.T) {
+	tests := []struct {
+		event    Event
+		keys     []string
+		fileKeys []string
+	}{
+		{
+			event: Event{Type: EventSessionStart, Time: 1700000000000, Direction: "receive"},
+			keys:  []string{"direction", "time", "type"},
+		},
+		{
+			event:    Event{Type: EventFileOffered, Time: 1, File: &EventFile{Index: 0, Name: "a.txt", Size: 12, MTime: 1700000000}},
+			keys:     []string{"file", "time", "type"},
+			fileKeys: []string{"index", "mtime", "name", "size", "transferred"},
+		},
+		{
+			event:    Event{Type: EventFileComplete, Time: 1, File: &EventFile{Name: "a.txt", Size: 12, Transferred: 12, SHA256: "ab"}},
+			keys:     []string{"file", "time", "type"},
+			fileKeys: []string{"index", "name", "sha256", "size", "transferred"},
+		},
+		{
+			event:    Event{Type: EventFileFailed, Time: 1, File: &EventFile{Name: "a.txt"}, Reason: "disk full", Code: CodeDiskFull},
+			keys:     []string{"code", "file", "reason", "time", "type"},
+			fileKeys: []string{"index", "name", "size", "transferred"},
+		},
+		{
+			event: Event{Type: EventSessionEnd, Time: 1, Status: "error", Error: "timeout", Code: CodeTimeout, Summary: &EventSummary{Files: 1, Failed: 1}},
+			keys:  []string{"code", "error", "status", "summary", "time", "type"},
+		},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.event)
+		if err != nil {
+			t.Fatalf("序列化事件失败: %v", err)
+		}
+		var obj map[string]any
+		if err := json.Unmarshal(data, &obj); err != nil {
+			t.Fatalf("解析事件 JSON 失败: %v", err)
+		}
+		if got := jsonKeys(t, obj); !reflect.DeepEqual(got, tt.keys) {
+			t.Errorf("%s 的字段 = %v，期望 %v（%s）", tt.event.Type, got, tt.keys, data)
+		}
+		if obj["type"] != string(tt.event.Type) {
+			t.Errorf("type = %v，期望 %s", obj["type"], tt.event.Type)
+		}
+		if tt.fileKeys != nil {
+			if got := jsonKeys(t, obj["file"].(map[string]any)); !reflect.DeepEqual(got, tt.fileKeys) {
+				t.Errorf("%s 的 file 字段 = %v，期望 %v", tt.event.Type, got, tt.fileKeys)
+			}
+		}
+		if tt.event.Code != 0 && obj["code"] != float64(tt.event.Code) {
+			t.Errorf("code = %v，期望 %d", obj["code"], tt.event.Code)
+		}
+	}
+
+	var summary map[string]any
+	data, _ := json.Marshal(EventSummary{Files: 2, Completed: 1, Skipped: 1, Bytes: 10})
+	json.Unmarshal(data, &summary)
+	if got := jsonKeys(t, summary); !reflect.DeepEqual(got, []string{"bytes", "completed", "failed", "files", "skipped"}) {
+		t.Errorf("summary 字段 = %v", got)
+	}
+}
@@ -1,138 +1,223 @@
 package zmodem
 
-import (
-	"encoding/binary"
-	"fmt"
-)
+// hexDigits 十六进制帧头使用小写字母
+const hexDigits = "0123456789abcdef"
+
+// needsEscape 判断字节在二进制帧中是否需要 ZDLE 转义
+// 默认转义 ZDLE、DLE、XON/XOFF（含第 8 位）以及 CR（避免 "@\r" 被 telnet/rlogin 吞掉）；
+// escapeCtl 为 true 时（对方 ZRINIT 带 ESCCTL）转义所有控制字符
+func needsEscape(b byte, escapeCtl bool) bool {
+	switch b {
+	case ZDLE, 0x10, 0x90, XON, XOFF, XON | 0x80, XOFF | 0x80, '\r', '\r' | 0x80:
+		return true
+	}
+	return escapeCtl && b&0x60 == 0
+}
+
+// appendEscaped 将数据按 ZDLE 转义后追加到 dst
+func appendEscaped(dst []byte, data []byte, escapeCtl bool) []byte {
+	for _, b := range data {
+		if needsEscape(b, escapeCtl) {
+			dst = append(dst, ZDLE, b^ZDLE_ESC)
+		} else {
+			dst = append(dst, b)
+		}
+	}
+	return dst
+}
 
-// BuildBinaryFrame 构建二进制 ZMODEM 帧
-func BuildBinaryFrame(frameType FrameType, flags uint32, f0, f1, f2, f3 uint8, data []byte, useCRC32 bool) []byte {
-	// 二进制帧格式：ZPAD + ZPAD + ZDLE + frame_type_char + frame_type + flags(4) + f0-f3(4) + [data] + [ZDLE + end_marker] + CRC
-	
-	var frame []byte
-	
-	// ZPAD + ZPAD
-	frame = append(frame, ZPAD, ZPAD)
-	
-	// ZDLE + 帧类型字符
+// appendCRC 追加（转义后的）CRC：16 位为大端，32 位为小端
+func appendCRC(dst []byte, data []byte, useCRC32, escapeCtl bool) []byte {
 	if useCRC32 {
-		frame = append(frame, ZDLE, ZBIN32)
-	} else {
-		frame = append(frame, ZDLE, ZBIN)
+		crc := CalculateCRC32(data)
+		return appendEscaped(dst, []byte{byte(crc), byte(crc >> 8), byte(crc >> 16), byte(crc >> 24)}, escapeCtl)
 	}
-	
-	// 帧类型
-	frame = append(frame, byte(frameType))
-	
-	// 标志位（4字节，大端序）
-	flagsBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(flagsBytes, flags)
-	frame = append(frame, flagsBytes...)
-	
-	// F0-F3
-	frame = append(frame, f0, f1, f2, f3)
-	
-	// 数据部分（如果需要 ZDLE 转义）
-	if len(data) > 0 {
-		for _, b := range data {
-			// 需要对特殊字符进行 ZDLE 转义
-			if b == ZDLE || b == '@' || (b >= 0x10 && b <= 0x1A) || b == 0x7F || b == 0x8D || b == 0x8A {
-				// 转义：ZDLE + (original ^ 0x40)
-				frame = append(frame, ZDLE, b^ZDLE_ESC)
+	crc := CalculateCRC16(data)
+	return appendEscaped(dst, []byte{byte(crc >> 8), byte(crc)}, escapeCtl)
+}
+
+// CRC 多项式
+const (
+	CRC16_POLY = 0x1021     // CRC-16/XMODEM
+	CRC32_POLY = 0xEDB88320 // CRC-32（反射）
+)
+
+// CalculateCRC16 计算 CRC16 校验和
+func CalculateCRC16(data []byte) uint16 {
+	crc := uint16(0)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = (crc << 1) ^ CRC16_POLY
 			} else {
-				frame = append(frame, b)
+				crc <<= 1
 			}
 		}
-		
-		// 添加数据结束标记（ZDLE + ZCRCE 表示子包结束）
-		frame = append(frame, ZDLE, ZCRCE)
 	}
-	
-	// 计算并添加 CRC
-	crc := uint32(0)
+	return crc
+}
+
+// CalculateCRC32 计算 CRC32 校验和
+func CalculateCRC32(data []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, b := range data {
+		crc ^= uint32(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = (crc >> 1) ^ CRC32_POLY
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc ^ 0xFFFFFFFF
+}
+
+// positionHeader 将位置编码为帧头的 4 个字节（P0-P3，低字节在前）
+func positionHeader(pos uint32) [4]byte {
+	return [4]byte{byte(pos), byte(pos >> 8), byte(pos >> 16), byte(pos >> 24)}
+}
+
+// flagsHeader 将标志位编码为帧头的 4 个字节（线路顺序为 F3 F2 F1 F0）
+func flagsHeader(f0, f1, f2, f3 uint8) [4]byte {
+	return [4]byte{f3, f2, f1, f0}
+}
+
+// BuildHexHeader 构建十六进制帧头
+// 格式：ZPAD ZPAD ZDLE 'B' + type/P0-P3/CRC16 的十六进制 + CR LF|0x80 [+ XON]
+func BuildHexHeader(frameType FrameType, hdr [4]byte) []byte {
+	raw := []byte{byte(frameType), hdr[0], hdr[1], hdr[2], hdr[3]}
+	crc := CalculateCRC16(raw)
+	raw = append(raw, byte(crc>>8), byte(crc))
+
+	frame := make([]byte, 0, 4+len(raw)*2+3)
+	frame = append(frame, ZPAD, ZPAD, ZDLE, ZHEX)
+	for _, b := range raw {
+		frame = append(frame, hexDigits[b>>4], hexDigits[b&0x0F])
+	}
+	frame = append(frame, '\r', '\n'|0x80)
+	// 与 lrzsz 一致：除 ZFIN 和 ZACK 外都追加 XON，唤醒可能被 XOFF 暂停的对端
+	if frameType != FrameZFIN && frameType != FrameZACK {
+		frame = append(frame, XON)
+	}
+	return frame
+}
+
+// BuildBinaryHeader 构建二进制帧头
+// 格式：ZPAD ZDLE 'A'/'C' + 转义后的 type/P0-P3/CRC
+func BuildBinaryHeader(frameType FrameType, hdr [4]byte, useCRC32, escapeCtl bool) []byte {
+	raw := []byte{byte(frameType), hdr[0], hdr[1], hdr[2], hdr[3]}
+
+	frame := make([]byte, 0, 3+len(raw)*2+8)
 	if useCRC32 {
-		// 对帧内容（不包括 ZPAD）计算 CRC32
-		crcData := frame[2:] // 跳过 ZPAD + ZPAD
-		crc = CalculateCRC32(crcData)
-		crcBytes := make([]byte, 4)
-		binary.BigEndian.PutUint32(crcBytes, crc)
-		frame = append(frame, crcBytes...)
+		frame = append(frame, ZPAD, ZDLE, ZBIN32)
 	} else {
-		// CRC16
-		crcData := frame[2:]
-		crc16 := CalculateCRC16(crcData)
-		crcBytes := make([]byte, 2)
-		binary.BigEndian.PutUint16(crcBytes, crc16)
-		frame = append(frame, crcBytes...)
+		frame = append(frame, ZPAD, ZDLE, ZBIN)
+	}
+	frame = appendEscaped(frame, raw, escapeCtl)
+	return appendCRC(frame, raw, useCRC32, escapeCtl)
+}
+
+// BuildDataSubpacket 构建数据子包：转义数据 + ZDLE + 结束标记 + CRC（覆盖数据和结束标记）
+func BuildDataSubpacket(data []byte, end byte, useCRC32, escapeCtl bool) []byte {
+	frame := make([]byte, 0, len(data)+len(data)/8+12)
+	frame = appendEscaped(frame, data, escapeCtl)
+	frame = append(frame, ZDLE, end)
+
+	crcData := make([]byte, 0, len(data)+1)
+	crcData = append(crcData, data...)
+	crcData = append(crcData, end)
+	frame = appendCRC(frame, crcData, useCRC32, escapeCtl)
+
+	// ZCRCW 之后对方要等待应答，追加 XON 防止其被流控暂停
+	if end == ZCRCW {
+		frame = append(frame, XON)
 	}
-	
 	return frame
 }
 
-// BuildZDATAFrame 构建 ZDATA 帧
-func BuildZDATAFrame(data []byte, position uint32) []byte {
-	// ZDATA 帧：flags 可以是位置信息，f0-f3 通常为 0
-	return BuildBinaryFrame(FrameZDATA, position, 0, 0, 0, 0, data, true)
+// BuildZRQINITFrame 构建 ZRQINIT 帧（发送方请求接收方初始化）
+func BuildZRQINITFrame() []byte {
+	return BuildHexHeader(FrameZRQINIT, [4]byte{})
 }
 
-// BuildZFILEFrameBinary 构建 ZFILE 帧（二进制格式）
-//
-// 按照常见 ZMODEM 实现，ZFILE 数据子包格式为：
-//   filename '\0' filesize ' ' modtime ' ' mode ' ' serial '\0'
-// 这里为了兼容性，使用：
-//   filename '\0' <filesize 十进制字符串> ' ' '0' ' ' '0' ' ' '0' '\0'
-// 即只准确填写文件大小，其它字段用 0 占位。
-func BuildZFILEFrameBinary(filename string, size int64) []byte {
-	var data []byte
-	data = append(data, []byte(filename)...)
-	data = append(data, 0)
+// BuildZRINITFrame 构建 ZRINIT 帧，caps 为 CANFDX 等能力标志
+// 缓冲区大小（P0/P1）填 0，表示可以全速流式接收
+func BuildZRINITFrame(caps uint8) []byte {
+	return BuildHexHeader(FrameZRINIT, flagsHeader(caps, 0, 0, 0))
+}
 
-	// 文件大小使用 ASCII 十进制编码
-	sizeStr := []byte(fmt.Sprintf("%d", size))
-	data = append(data, sizeStr...)
-	data = append(data, ' ')
-	data = append(data, '0', ' ')
-	data = append(data, '0', ' ')
-	data = append(data, '0')
-	data = append(data, 0)
+// BuildZFILEFrame 构建 ZFILE 帧：二进制帧头 + 以 ZCRCW 结束的文件信息子包
+// conv 为转换选项（ZF0，如 ZCBIN/ZCRESUM），manage 为文件管理选项（ZF1）
+func BuildZFILEFrame(fileInfo []byte, conv, manage uint8, useCRC32, escapeCtl bool) []byte {
+	frame := BuildBinaryHeader(FrameZFILE, flagsHeader(conv, manage, 0, 0), useCRC32, escapeCtl)
+	return append(frame, BuildDataSubpacket(fileInfo, ZCRCW, useCRC32, escapeCtl)...)
+}
 
-	return BuildBinaryFrame(FrameZFILE, 0, 0, 0, 0, 0, data, true)
+// BuildZDATAHeader 构建 ZDATA 帧头（其后跟若干数据子包）
+func BuildZDATAHeader(position uint32, useCRC32, escapeCtl bool) []byte {
+	return BuildBinaryHeader(FrameZDATA, positionHeader(position), useCRC32, escapeCtl)
 }
 
-// BuildZRINITFrame 构建 ZRINIT 帧（二进制格式）
-func BuildZRINITFrame() []byte {
-	flags := uint32(0)
-	flags |= 0x00000080 // CANFDX
-	flags |= 0x00000040 // CANOVIO
-	flags |= 0x00000020 // CANBRK
-	flags |= 0x00000010 // CANFC32
-	
-	return BuildBinaryFrame(FrameZRINIT, flags, 0, 0, 0, 0, nil, true)
+// BuildZEOFFrame 构建 ZEOF 帧
+func BuildZEOFFrame(position uint32, useCRC32, escapeCtl bool) []byte {
+	return BuildBinaryHeader(FrameZEOF, positionHeader(position), useCRC32, escapeCtl)
 }
 
 // BuildZACKFrame 构建 ZACK 帧
 func BuildZACKFrame(position uint32) []byte {
-	posBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(posBytes, position)
-	return BuildBinaryFrame(FrameZACK, 0, 0, 0, 0, 0, posBytes, true)
+	return BuildHexHeader(FrameZACK, positionHeader(position))
 }
 
 // BuildZRPOSFrame 构建 ZRPOS 帧
 func BuildZRPOSFrame(position uint32) []byte {
-	posBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(posBytes, position)
-	return BuildBinaryFrame(FrameZRPOS, 0, 0, 0, 0, 0, posBytes, true)
+	return BuildHexHeader(FrameZRPOS, positionHeader(position))
 }
 
-// BuildZEOFFrame 构建 ZEOF 帧
-func BuildZEOFFrame(position uint32) []byte {
-	posBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(posBytes, position)
-	return BuildBinaryFrame(FrameZEOF, 0, 0, 0, 0, 0, posBytes, true)
+// BuildZSKIPFrame 构建 ZSKIP 帧（接收方跳过当前文件）
+func BuildZSKIPFrame() []byte {
+	return BuildHexHeader(FrameZSKIP, [4]byte{})
+}
+
+// BuildZNAKFrame 构建 ZNAK 帧（要求对方重发上一个帧头）
+func BuildZNAKFrame() []byte {
+	return BuildHexHeader(FrameZNAK, [4]byte{})
+}
+
+// BuildZABORTFrame 构建 ZABORT 帧（接收方请求中止批量传输）
+func BuildZABORTFrame() []byte {
+	return BuildHexHeader(FrameZABORT, [4]byte{})
+}
+
+// BuildZCRCFrame 构建 ZCRC 帧（回复文件的 CRC32）
+func BuildZCRCFrame(crc uint32) []byte {
+	return BuildHexHeader(FrameZCRC, positionHeader(crc))
 }
 
 // BuildZFINFrame 构建 ZFIN 帧
 func BuildZFINFrame() []byte {
-	return BuildBinaryFrame(FrameZFIN, 0, 0, 0, 0, 0, nil, true)
+	return BuildHexHeader(FrameZFIN, [4]byte{})
 }
 
+// BuildZCOMPLFrame 构建 ZCOMPL 帧（ZCOMMAND 的执行结果，status 为命令退出码）
+func BuildZCOMPLFrame(status uint32) []byte {
+	return BuildHexHeader(FrameZCOMPL, positionHeader(status))
+}
+
+// BuildZFREECNTFrame 构建 ZFREECNT 帧（请求对方返回剩余磁盘空间）
+func BuildZFREECNTFrame() []byte {
+	return BuildHexHeader(FrameZFREECNT, [4]byte{})
+}
+
+// BuildAbortSequence 构建取消序列（8 个 CAN 后跟 10 个退格），用于中止对方的传输
+func BuildAbortSequence() []byte {
+	seq := make([]byte, 0, 18)
+	for i := 0; i < 8; i++ {
+		seq = append(seq, ZDLE)
+	}
+	for i := 0; i < 10; i++ {
+		seq = append(seq, 0x08)
+	}
+	return seq
+}
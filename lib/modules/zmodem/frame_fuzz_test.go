@@ -0,0 +1,333 @@
+package zmodem
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// maxPendingInput 解析器等待更多数据时最多保留的字节数（一个完全转义的最大数据子包加少量余量）
+const maxPendingInput = maxEscapedSubpacket + 16
+
+// fuzzStream 种子：一次完整会话中出现的各种帧
+func fuzzStream() []byte {
+	var b []byte
+	b = append(b, "rz\r"...)
+	b = append(b, BuildZRQINITFrame()...)
+	b = append(b, BuildZRINITFrame(CANFDX|CANOVIO|CANFC32)...)
+	info := encodeFileInfo(FileInfo{Name: "a.txt", Size: 5, ModTime: time.Unix(1700000000, 0), Mode: 0o644}, nameCodec{}, 1, 5)
+	b = append(b, BuildZFILEFrame(info, ZCBIN, 0, true, false)...)
+	b = append(b, BuildZDATAHeader(0, true, false)...)
+	b = append(b, BuildDataSubpacket([]byte("he\x18l\x11"), ZCRCG, true, false)...)
+	b = append(b, BuildDataSubpacket([]byte{0x7f, 0xff, 0x0d, 0x8d}, ZCRCE, true, true)...)
+	b = append(b, BuildZEOFFrame(5, false, false)...)
+	b = append(b, BuildZRPOSFrame(1024)...)
+	b = append(b, BuildZFINFrame()...)
+	b = append(b, "OO"...)
+	return append(b, BuildAbortSequence()...)
+}
+
+// parseStep ParseFrame 一次调用的结果，用于比较不同切分方式下的解析结果
+func parseStep(f *ZmodemFrame, err error) string {
+	if err != nil {
+		return "error"
+	}
+	return fmt.Sprintf("%s %x %x %x %x %q %x %x %v", f.Type, f.F0, f.F1, f.F2, f.F3, f.Data, f.End, f.FrameType, f.Subpacket)
+}
+
+// parseAll 以 chunk 字节为单位输入 data，检查每次调用的不变量并返回所有结果
+func parseAll(t *testing.T, data []byte, chunk int) []string {
+	p := NewFrameParser()
+	var steps []string
+	for len(data) > 0 {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		p.AddData(data[:n])
+		data = data[n:]
+
+		for {
+			before := p.GetBufferSize()
+			f, err := p.ParseFrame()
+			if f == nil && err == nil {
+				// 数据不足：保留的数据只能是一个不完整的帧头或数据子包
+				if size := p.GetBufferSize(); size > maxPendingInput {
+					t.Fatalf("等待数据时保留了 %d 字节", size)
+				}
+				break
+			}
+			// 每次返回帧或错误都必须消耗数据，否则调用方会死循环
+			if p.GetBufferSize() >= before {
+				t.Fatalf("ParseFrame 没有消耗数据: %d -> %d (%v)", before, p.GetBufferSize(), err)
+			}
+			if f != nil && len(f.Data) > maxSubpacketSize {
+				t.Fatalf("数据子包过长: %d", len(f.Data))
+			}
+			steps = append(steps, parseStep(f, err))
+		}
+	}
+	return steps
+}
+
+func FuzzParseFrame(f *testing.F) {
+	f.Add(fuzzStream(), uint8(0))
+	f.Add(fuzzStream(), uint8(1))
+	f.Add(fuzzStream(), uint8(7))
+	f.Add([]byte("**\x18B0100000023be50\r\x8a\x11"), uint8(3))
+	f.Add(bytes.Repeat([]byte{XON}, 100), uint8(0))
+	f.Add(append([]byte{ZPAD, ZDLE, ZBIN}, bytes.Repeat([]byte{XON}, 100)...), uint8(0))
+	f.Add(append(BuildZDATAHeader(0, false, false), bytes.Repeat([]byte{ZDLE, 'A'}, 100)...), uint8(5))
+	f.Add(append(BuildZDATAHeader(0, false, false), bytes.Repeat([]byte{XON}, 2*maxEscapedSubpacket)...), uint8(255))
+	f.Add(bytes.Repeat([]byte{ZPAD}, 2*maxEscapedSubpacket), uint8(255))
+	f.Fuzz(func(t *testing.T, data []byte, chunk uint8) {
+		whole := parseAll(t, data, len(data))
+		// 数据如何切分不应影响解析结果
+		split := parseAll(t, data, int(chunk)+1)
+		if fmt.Sprint(whole) != fmt.Sprint(split) {
+			t.Fatalf("切分为 %d 字节时结果不同:\n  整体: %q\n  切分: %q", int(chunk)+1, whole, split)
+		}
+	})
+}
+
+// buildHeader 按 format（0 十六进制，1 CRC16 二进制，2 CRC32 二进制）构建帧头
+func buildHeader(typ FrameType, hdr [4]byte, format uint8, escapeCtl bool) []byte {
+	switch format % 3 {
+	case 0:
+		return BuildHexHeader(typ, hdr)
+	case 1:
+		return BuildBinaryHeader(typ, hdr, false, escapeCtl)
+	default:
+		return BuildBinaryHeader(typ, hdr, true, escapeCtl)
+	}
+}
+
+func FuzzHeaderRoundTrip(f *testing.F) {
+	f.Add(uint8(FrameZRINIT), uint8(0), uint8(0), uint8(0), uint8(CANFDX), uint8(0), false)
+	f.Add(uint8(FrameZDATA), uint8(0x18), uint8(0x11), uint8(0x7f), uint8(0xff), uint8(1), true)
+	f.Add(uint8(FrameZEOF), uint8(0x0d), uint8(0x8d), uint8(0x13), uint8(0x93), uint8(2), false)
+	f.Fuzz(func(t *testing.T, typ, h0, h1, h2, h3, format uint8, escapeCtl bool) {
+		hdr := [4]byte{h0, h1, h2, h3}
+		encoded := buildHeader(FrameType(typ), hdr, format, escapeCtl)
+
+		var frame *ZmodemFrame
+		var consumed int
+		var err error
+		prefix := 3 // ZPAD ZDLE 'A'/'C'
+		if format%3 == 0 {
+			prefix = 4 // ZPAD ZPAD ZDLE 'B'
+			frame, consumed, err = parseHexHeader(encoded[prefix:])
+		} else {
+			frame, consumed, err = parseBinaryHeader(encoded[prefix:], format%3 == 2)
+		}
+		if err != nil || frame == nil {
+			t.Fatalf("解析失败: %v (% x)", err, encoded)
+		}
+		if consumed != len(encoded)-prefix {
+			t.Fatalf("消耗了 %d 字节，帧头共 %d 字节", consumed, len(encoded)-prefix)
+		}
+		if frame.Type != FrameType(typ) || headerBytes(frame) != hdr {
+			t.Fatalf("解码结果不一致: %+v, 期望 %d % x", frame, typ, hdr)
+		}
+
+		// 经过 FrameParser 也应得到同一个帧头（带数据子包的类型需要跟一个子包）
+		if FrameType(typ).hasSubpacket() {
+			encoded = append(encoded, BuildDataSubpacket(nil, ZCRCW, format%3 == 2, escapeCtl)...)
+		}
+		p := NewFrameParser()
+		p.AddData(encoded)
+		got, err := p.ParseFrame()
+		if err != nil || got == nil || got.Type != frame.Type || got.Position() != frame.Position() {
+			t.Fatalf("FrameParser 解析结果不一致: %+v, %v", got, err)
+		}
+	})
+}
+
+func FuzzParseHexHeader(f *testing.F) {
+	f.Add(BuildZRQINITFrame()[4:])
+	f.Add(BuildZRPOSFrame(0x12345678)[4:])
+	f.Add([]byte("0100000023be50\r\n"))
+	f.Add([]byte("01000000"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		frame, consumed, err := parseHexHeader(data)
+		checkHeaderResult(t, data, frame, consumed, err)
+		if frame == nil {
+			return
+		}
+		// 解码得到的帧头重新编码后应解码为同一个帧头
+		again, _, err := parseHexHeader(BuildHexHeader(frame.Type, headerBytes(frame))[4:])
+		if err != nil || again == nil || parseStep(again, nil) != parseStep(frame, nil) {
+			t.Fatalf("重新编码后不一致: %+v, %+v, %v", frame, again, err)
+		}
+	})
+}
+
+func FuzzParseBinaryHeader(f *testing.F) {
+	f.Add(BuildZDATAHeader(0x1000, false, false)[3:], false)
+	f.Add(BuildZDATAHeader(0x1000, true, true)[3:], true)
+	f.Add(BuildZEOFFrame(0x11131818, true, false)[3:], true)
+	f.Add([]byte{0x0a, ZDLE, 'l', XON, 0, 0, 0}, false)
+	f.Add(bytes.Repeat([]byte{XOFF}, 100), true)
+	f.Fuzz(func(t *testing.T, data []byte, crc32 bool) {
+		frame, consumed, err := parseBinaryHeader(data, crc32)
+		checkHeaderResult(t, data, frame, consumed, err)
+		if frame == nil {
+			return
+		}
+		for _, escapeCtl := range []bool{false, true} {
+			again, _, err := parseBinaryHeader(BuildBinaryHeader(frame.Type, headerBytes(frame), crc32, escapeCtl)[3:], crc32)
+			if err != nil || again == nil || parseStep(again, nil) != parseStep(frame, nil) {
+				t.Fatalf("重新编码后不一致: %+v, %+v, %v", frame, again, err)
+			}
+		}
+	})
+}
+
+// checkHeaderResult 帧头解析函数的共同不变量
+func checkHeaderResult(t *testing.T, data []byte, frame *ZmodemFrame, consumed int, err error) {
+	t.Helper()
+	switch {
+	case err != nil && frame != nil:
+		t.Fatal("同时返回了帧和错误")
+	case consumed < 0 || consumed > len(data):
+		t.Fatalf("消耗的字节数无效: %d/%d", consumed, len(data))
+	case frame == nil && consumed != 0:
+		t.Fatalf("没有帧时不应消耗数据: %d", consumed)
+	case frame != nil && consumed == 0:
+		t.Fatal("返回帧时没有消耗数据")
+	case err == nil && frame == nil && len(data) > maxBinaryHeaderInput:
+		t.Fatalf("%d 字节的数据仍不足以解析帧头", len(data))
+	}
+}
+
+// headerBytes 按线路顺序返回帧头的 4 个字节
+func headerBytes(f *ZmodemFrame) [4]byte {
+	return [4]byte{f.F3, f.F2, f.F1, f.F0}
+}
+
+func FuzzSubpacketRoundTrip(f *testing.F) {
+	f.Add([]byte("hello"), uint8(0), false, false)
+	f.Add([]byte{ZDLE, XON, XOFF, 0x7f, 0xff, 0x0d, 0x8d, 0x10, 0x90}, uint8(1), true, true)
+	f.Add(bytes.Repeat([]byte{ZDLE}, maxSubpacketSize), uint8(3), true, false)
+	f.Fuzz(func(t *testing.T, data []byte, endSel uint8, crc32, escapeCtl bool) {
+		if len(data) > maxSubpacketSize {
+			data = data[:maxSubpacketSize]
+		}
+		end := [...]byte{ZCRCE, ZCRCG, ZCRCQ, ZCRCW}[endSel%4]
+
+		stream := BuildZDATAHeader(0, crc32, escapeCtl)
+		stream = append(stream, BuildDataSubpacket(data, end, crc32, escapeCtl)...)
+		p := NewFrameParser()
+		p.AddData(stream)
+		if hdr, err := p.ParseFrame(); err != nil || hdr == nil || hdr.Type != FrameZDATA || hdr.Subpacket {
+			t.Fatalf("ZDATA 帧头解析失败: %+v, %v", hdr, err)
+		}
+		got, err := p.ParseFrame()
+		if err != nil || got == nil || !got.Subpacket || got.End != end || !bytes.Equal(got.Data, data) {
+			t.Fatalf("数据子包不一致: %+v, %v", got, err)
+		}
+		// ZCRCW 之后的 XON 留给下一次查找帧头时丢弃
+		if rest := p.TakeBuffer(); len(bytes.Trim(rest, "\x11")) != 0 {
+			t.Fatalf("数据子包之后剩余数据: % x", rest)
+		}
+	})
+}
+
+func FuzzDecodeFileInfo(f *testing.F) {
+	f.Add([]byte("a.txt\x005 14524603400 100644 0 1 5\x00"))
+	f.Add([]byte("\xc4\xe3\xba\xc3.txt\x00-1 zz 7777777777777\x00"))
+	f.Add([]byte("name-only"))
+	f.Add([]byte("\x00\x00\x00"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, names := range []nameCodec{{}, newNameCodec("gbk")} {
+			info := decodeFileInfo(data, names)
+			if !utf8.ValidString(info.Name) || info.Size < 0 || info.Mode&^0o777 != 0 {
+				t.Fatalf("解码结果无效: %+v", info)
+			}
+		}
+
+		// 解码的结果重新编码后应解码为同一个结果
+		info := decodeFileInfo(data, nameCodec{})
+		again := decodeFileInfo(encodeFileInfo(info, nameCodec{}, 1, info.Size), nameCodec{})
+		if !sameFileInfo(info, again) {
+			t.Fatalf("重新编码后不一致: %+v, %+v", info, again)
+		}
+	})
+}
+
+func FuzzZFILERoundTrip(f *testing.F) {
+	f.Add("a.txt", int64(5), int64(1700000000), uint32(0o644), false, false)
+	f.Add("目录/文件 名.txt", int64(1)<<40, int64(0), uint32(0), true, true)
+	f.Add("\x18\x11\r.bin", int64(0), int64(-1), uint32(0o7777), true, false)
+	f.Fuzz(func(t *testing.T, name string, size, mtime int64, mode uint32, crc32, escapeCtl bool) {
+		if !utf8.ValidString(name) || name == "" || bytes.IndexByte([]byte(name), 0) >= 0 || size < 0 {
+			t.Skip()
+		}
+		info := FileInfo{Name: name, Size: size, Mode: os.FileMode(mode).Perm()}
+		if mtime > 0 {
+			info.ModTime = time.Unix(mtime, 0)
+		}
+		encoded := encodeFileInfo(info, nameCodec{}, 1, size)
+		if len(encoded) > maxSubpacketSize {
+			t.Skip() // 文件名超过了数据子包的最大长度
+		}
+
+		p := NewFrameParser()
+		p.AddData(BuildZFILEFrame(encoded, ZCBIN, 0, crc32, escapeCtl))
+		frame, err := p.ParseFrame()
+		if err != nil || frame == nil || frame.Type != FrameZFILE || frame.F0 != ZCBIN {
+			t.Fatalf("ZFILE 解析失败: %+v, %v", frame, err)
+		}
+		if got := decodeFileInfo(frame.Data, nameCodec{}); !sameFileInfo(info, got) {
+			t.Fatalf("文件信息不一致: %+v, %+v", got, info)
+		}
+	})
+}
+
+// sameFileInfo 比较 ZFILE 中传输的字段
+func sameFileInfo(a, b FileInfo) bool {
+	return a.Name == b.Name && a.Size == b.Size && a.ModTime.Equal(b.ModTime) && a.Mode == b.Mode
+}
+
+func FuzzIsZmodemSequence(f *testing.F) {
+	f.Add(BuildZRQINITFrame())
+	f.Add(BuildZRINITFrame(CANFDX | CANOVIO | CANFC32))
+	f.Add([]byte("**B00000000000000"))
+	f.Add([]byte("*\x18B01"))
+	f.Add([]byte("ls -l\r\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ok, upload := IsZmodemSequence(data)
+		if !ok && upload {
+			t.Fatal("没有检测到启动序列时不应返回方向")
+		}
+		// 检测只依赖开头的 6 个字节，终端输出可以在任意位置切分
+		if len(data) > 6 {
+			if ok2, upload2 := IsZmodemSequence(data[:6]); ok2 != ok || upload2 != upload {
+				t.Fatal("检测结果依赖开头 6 个字节之后的数据")
+			}
+		}
+
+		// 以 ZRQINIT（对方运行 sz）或 ZRINIT（对方运行 rz）十六进制帧头开始的数据必须被检测到，且方向正确
+		start := bytes.IndexByte(data, ZDLE)
+		if start < 1 || start > 2 || !bytes.Equal(data[:start], []byte("**")[:start]) || len(data) < start+2 || data[start+1] != ZHEX {
+			return
+		}
+		frame, _, err := parseHexHeader(data[start+2:])
+		if err != nil || frame == nil {
+			return
+		}
+		switch frame.Type {
+		case FrameZRQINIT:
+			if !ok || upload {
+				t.Fatalf("ZRQINIT 应检测为下载: %q", data)
+			}
+		case FrameZRINIT:
+			if !ok || !upload {
+				t.Fatalf("ZRINIT 应检测为上传: %q", data)
+			}
+		}
+	})
+}
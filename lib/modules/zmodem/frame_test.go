@@ -0,0 +1,68 @@
+package zmodem
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestParserBoundsBufferedInput 对方发送大量被忽略的字节（XON、ZPAD）时，解析器不应无限缓存数据
+func TestParserBoundsBufferedInput(t *testing.T) {
+	flood := func(b byte) []byte { return bytes.Repeat([]byte{b}, 4*maxEscapedSubpacket) }
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error // 期望返回的错误，nil 表示只要求不缓存过多数据
+	}{
+		{"XON in subpacket", append(BuildZDATAHeader(0, false, false), flood(XON)...), errSubpacketTooLong},
+		{"XOFF in subpacket", append(BuildZDATAHeader(0, true, false), flood(XOFF)...), errSubpacketTooLong},
+		{"XON in binary header", append([]byte{ZPAD, ZDLE, ZBIN}, flood(XON)...), errHeaderTooLong},
+		{"ZPAD", flood(ZPAD), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewFrameParser()
+			var got error
+			for i := 0; i < len(tt.data); i += 1024 {
+				p.AddData(tt.data[i:min(i+1024, len(tt.data))])
+				for {
+					f, err := p.ParseFrame()
+					if err != nil && got == nil {
+						got = err
+					}
+					if f == nil && err == nil {
+						break
+					}
+				}
+				if size := p.GetBufferSize(); size > maxEscapedSubpacket+16 {
+					t.Fatalf("缓存了 %d 字节", size)
+				}
+			}
+			if tt.wantErr != nil && !errors.Is(got, tt.wantErr) {
+				t.Fatalf("错误 = %v，期望 %v", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestParserAllowsIgnoredBytes 正常数量的 XON 和重复的 ZPAD 不影响解析
+func TestParserAllowsIgnoredBytes(t *testing.T) {
+	data := testPayload(maxSubpacketSize)
+	var stream []byte
+	stream = append(stream, "****"...)
+	stream = append(stream, BuildZDATAHeader(0, true, false)...)
+	sub := BuildDataSubpacket(data, ZCRCE, true, false)
+	stream = append(stream, sub[:100]...)
+	stream = append(stream, XON, XOFF, XON)
+	stream = append(stream, sub[100:]...)
+
+	p := NewFrameParser()
+	p.AddData(stream)
+	if f, err := p.ParseFrame(); err != nil || f == nil || f.Type != FrameZDATA {
+		t.Fatalf("ZDATA 帧头解析失败: %+v, %v", f, err)
+	}
+	if f, err := p.ParseFrame(); err != nil || f == nil || !bytes.Equal(f.Data, data) {
+		t.Fatalf("数据子包解析失败: %v", err)
+	}
+}
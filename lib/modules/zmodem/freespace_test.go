@@ -0,0 +1,92 @@
+package zmodem
+
+import (
+	"errors"
+	"testing"
+)
+
+// spaceSink 报告固定剩余空间的 MemorySink
+type spaceSink struct {
+	*MemorySink
+	free uint64
+	err  error
+}
+
+func (s spaceSink) FreeSpace() (uint64, error) {
+	return s.free, s.err
+}
+
+// TestReplyFreeSpace 接收方以 ZACK 返回剩余空间，超出 32 位或无法获取时返回 0xFFFFFFFF
+func TestReplyFreeSpace(t *testing.T) {
+	tests := []struct {
+		name string
+		sink Sink
+		want uint32
+	}{
+		{"free space", spaceSink{NewMemorySink(), 123456, nil}, 123456},
+		{"zero", spaceSink{NewMemorySink(), 0, nil}, 0},
+		{"over 4GB", spaceSink{NewMemorySink(), 1 << 40, nil}, 0xFFFFFFFF},
+		{"error", spaceSink{NewMemorySink(), 100, errors.New("statfs")}, 0xFFFFFFFF},
+		{"sink without free space", NewMemorySink(), 0xFFFFFFFF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := NewReceiver(tt.sink, Options{})
+			drain(z)
+			if err := z.FeedData(BuildZFREECNTFrame()); err != nil {
+				t.Fatalf("输入 ZFREECNT 失败: %v", err)
+			}
+
+			p := NewFrameParser()
+			p.AddData(drain(z))
+			frame, err := p.ParseFrame()
+			if err != nil || frame == nil || frame.Type != FrameZACK {
+				t.Fatalf("期望 ZACK，实际为 %+v, %v", frame, err)
+			}
+			if got := frame.Position(); got != tt.want {
+				t.Fatalf("剩余空间 = %d，期望 %d", got, tt.want)
+			}
+			if state := z.GetState(); state != StateReceivingHeader {
+				t.Fatalf("ZFREECNT 不应改变状态，实际为 %s", state)
+			}
+		})
+	}
+}
+
+// TestCheckFreeSpace 上传前查询剩余空间：批次大于远端剩余空间时拒绝传输，否则正常传输
+func TestCheckFreeSpace(t *testing.T) {
+	files := []loopFile{{"a.bin", testPayload(3000)}, {"b.bin", testPayload(2000)}}
+	tests := []struct {
+		name    string
+		free    uint64
+		wantErr error
+	}{
+		{"enough", 5000, nil},
+		{"unlimited", 1 << 40, nil},
+		{"too small", 4999, ErrDiskFull},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := spaceSink{MemorySink: NewMemorySink(), free: tt.free}
+			sender := NewSender(memorySources(files), Options{CheckFreeSpace: true})
+			receiver := NewReceiver(sink, Options{})
+			newLoopback(t, sender, receiver).run()
+
+			if !errors.Is(sender.GetError(), tt.wantErr) {
+				t.Fatalf("发送方错误 = %v，期望 %v", sender.GetError(), tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if code := CodeOf(sender.GetError()); code != CodeDiskFull {
+					t.Errorf("错误码 = %d，期望 %d", code, CodeDiskFull)
+				}
+				if got := sink.Files(); len(got) != 0 {
+					t.Fatalf("空间不足时不应开始传输，接收方收到 %d 个文件", len(got))
+				}
+				return
+			}
+			if got := sink.Files(); len(got) != len(files) {
+				t.Fatalf("接收方收到 %d 个文件，期望 %d", len(got), len(files))
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package zmodem
+
+import (
+	"errors"
+	"syscall"
+)
+
+// diskFreeSpace 获取目录所在文件系统对当前用户可用的剩余空间（字节）
+func diskFreeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// isDiskFull 判断错误是否由磁盘空间不足引起
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT)
+}
@@ -0,0 +1,41 @@
+//go:build windows
+
+package zmodem
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// diskFreeSpace 获取目录所在卷对当前用户可用的剩余空间（字节）
+func diskFreeSpace(dir string) (uint64, error) {
+	dirPtr, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var freeBytesAvailable uint64
+	r, _, callErr := procGetDiskFreeSpaceExW.Call(
+		uintptr(unsafe.Pointer(dirPtr)),
+		uintptr(unsafe.Pointer(&freeBytesAvailable)),
+		0,
+		0,
+	)
+	if r == 0 {
+		return 0, callErr
+	}
+	return freeBytesAvailable, nil
+}
+
+// Windows 磁盘空间不足的错误码
+const (
+	errorHandleDiskFull syscall.Errno = 39  // ERROR_HANDLE_DISK_FULL
+	errorDiskFull       syscall.Errno = 112 // ERROR_DISK_FULL
+)
+
+// isDiskFull 判断错误是否由磁盘空间不足引起
+func isDiskFull(err error) bool {
+	return errors.Is(err, errorDiskFull) || errors.Is(err, errorHandleDiskFull)
+}
@@ -0,0 +1,239 @@
+package zmodem
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogLevel 日志级别，低于配置级别的日志直接丢弃
+type LogLevel int32
+
+const (
+	LogDebug LogLevel = iota // 协议细节：状态转换、帧、数据预览
+	LogInfo                  // 会话与文件级别的事件
+	LogWarn                  // 可恢复的异常：超时重试、数据错误、拒绝的请求
+	LogError                 // 会话出错
+	LogOff                   // 关闭日志
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogDebug: "debug",
+	LogInfo:  "info",
+	LogWarn:  "warn",
+	LogError: "error",
+	LogOff:   "off",
+}
+
+// String 返回级别名称，如 "debug"
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogLevel(%d)", int32(l))
+}
+
+// UnmarshalText 从 JSON 字符串解析级别
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	s := strings.ToLower(string(text))
+	if s == "warning" {
+		s = "warn"
+	}
+	for level, name := range logLevelNames {
+		if name == s {
+			*l = level
+			return nil
+		}
+	}
+	return fmt.Errorf("未知的日志级别: %q", text)
+}
+
+// MarshalText 将级别编码为名称
+func (l LogLevel) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// LogSink 日志输出位置
+type LogSink string
+
+const (
+	LogSinkOff      LogSink = "off"      // 不输出
+	LogSinkFile     LogSink = "file"     // 追加写入 LogConfig.Path
+	LogSinkStderr   LogSink = "stderr"   // 标准错误输出
+	LogSinkCallback LogSink = "callback" // 交给宿主回调（见 SetLogConfig）
+)
+
+// LogConfig 日志配置（C API 的 RollshellSetLogConfig 以 JSON 传入）
+type LogConfig struct {
+	Level LogLevel `json:"level"`
+	Sink  LogSink  `json:"sink"`
+	Path  string   `json:"path,omitempty"` // Sink 为 file 时的日志文件路径
+	// Redact 为 true 时日志只记录数据长度，不记录数据内容的预览（其中可能包含文件内容）
+	Redact bool `json:"redact"`
+}
+
+// DefaultLogConfig 默认配置：关闭日志，开启后默认隐藏数据预览
+func DefaultLogConfig() LogConfig {
+	return LogConfig{Level: LogInfo, Sink: LogSinkOff, Redact: true}
+}
+
+// ParseLogConfig 解析 JSON 格式的日志配置，未出现的字段取默认值
+func ParseLogConfig(data string) (LogConfig, error) {
+	cfg := DefaultLogConfig()
+	if strings.TrimSpace(data) == "" {
+		return cfg, nil
+	}
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		return LogConfig{}, fmt.Errorf("解析日志配置失败: %w", err)
+	}
+	return cfg, nil
+}
+
+// LogFunc 日志回调，message 不含时间戳和换行
+// 回调不在日志锁或引擎锁中调用，不同 goroutine 的日志可能并发回调，回调中可以调用引擎的方法
+type LogFunc func(level LogLevel, message string)
+
+// previewLen 数据预览的最大字节数
+const previewLen = 32
+
+var (
+	// logLevel 当前生效的级别，sink 为 off 时为 LogOff，使关闭状态下的检查只有一次原子读取
+	logLevel  atomic.Int32
+	logRedact atomic.Bool
+
+	logMu   sync.Mutex
+	logOut  io.Writer // file 或 stderr
+	logFile *os.File  // 需要在切换配置时关闭的日志文件
+	logFunc LogFunc
+)
+
+func init() {
+	logLevel.Store(int32(LogOff))
+	logRedact.Store(true)
+	// 兼容旧的调试方式：设置 ZMODEM_LOG_FILE 时以 debug 级别写入该文件
+	if path := os.Getenv("ZMODEM_LOG_FILE"); path != "" {
+		SetLogConfig(LogConfig{Level: LogDebug, Sink: LogSinkFile, Path: path, Redact: true}, nil)
+	}
+}
+
+// SetLogConfig 替换全局日志配置；sink 为 callback 时 fn 不能为 nil
+// 配置无效时返回错误并保持原配置
+func SetLogConfig(cfg LogConfig, fn LogFunc) error {
+	if _, ok := logLevelNames[cfg.Level]; !ok {
+		return fmt.Errorf("未知的日志级别: %d", int32(cfg.Level))
+	}
+
+	var (
+		out  io.Writer
+		file *os.File
+	)
+	switch cfg.Sink {
+	case LogSinkOff, "":
+		cfg.Level = LogOff
+	case LogSinkStderr:
+		out = os.Stderr
+	case LogSinkFile:
+		if cfg.Path == "" {
+			return fmt.Errorf("日志输出为 file 时必须指定 path")
+		}
+		f, err := os.OpenFile(cfg.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("打开日志文件失败: %w", err)
+		}
+		out, file = f, f
+	case LogSinkCallback:
+		if fn == nil {
+			return fmt.Errorf("日志输出为 callback 时必须提供回调函数")
+		}
+	default:
+		return fmt.Errorf("未知的日志输出: %q", cfg.Sink)
+	}
+	if cfg.Sink != LogSinkCallback {
+		fn = nil
+	}
+
+	logMu.Lock()
+	defer logMu.Unlock()
+	if logFile != nil {
+		logFile.Close()
+	}
+	logOut, logFile, logFunc = out, file, fn
+	logRedact.Store(cfg.Redact)
+	logLevel.Store(int32(cfg.Level))
+	return nil
+}
+
+// LogEnabled 判断 level 级别的日志是否会输出，构造代价较高的日志前应先检查
+func LogEnabled(level LogLevel) bool {
+	return int32(level) >= logLevel.Load()
+}
+
+// Logf 按级别记录日志，未启用时只有一次原子读取
+func Logf(level LogLevel, format string, args ...interface{}) {
+	if !LogEnabled(level) {
+		return
+	}
+	writeLog(level, fmt.Sprintf(format, args...))
+}
+
+// writeLog 输出一条日志；宿主回调在释放 logMu 之后调用，回调中可以再次记录日志或调用引擎的方法
+func writeLog(level LogLevel, msg string) {
+	logMu.Lock()
+	fn := logFunc
+	if fn == nil && logOut != nil {
+		timestamp := time.Now().Format("2006-01-02 15:04:05.000")
+		fmt.Fprintf(logOut, "%s [%s] %s\n", timestamp, strings.ToUpper(level.String()), msg)
+	}
+	logMu.Unlock()
+	if fn != nil {
+		fn(level, msg)
+	}
+}
+
+// logEntry 引擎持有 z.mu 期间排队的日志
+type logEntry struct {
+	level LogLevel
+	msg   string
+}
+
+// logf 记录引擎的日志（调用方持有 z.mu）
+// 日志先排队，由 unlock 在释放 z.mu 之后输出，使日志回调不会在持有引擎锁时被调用
+func (z *ZmodemImpl) logf(level LogLevel, format string, args ...interface{}) {
+	if !LogEnabled(level) {
+		return
+	}
+	z.logs = append(z.logs, logEntry{level, fmt.Sprintf(format, args...)})
+}
+
+// unlock 释放 z.mu，并输出持有锁期间排队的日志
+func (z *ZmodemImpl) unlock() {
+	logs := z.logs
+	z.logs = nil
+	z.mu.Unlock()
+	for _, e := range logs {
+		writeLog(e.level, e.msg)
+	}
+}
+
+// PayloadPreview 返回数据的日志表示：开启 redact 时只有长度，否则附带前 32 字节的十六进制预览
+func PayloadPreview(data []byte) string {
+	if logRedact.Load() {
+		return fmt.Sprintf("%d bytes", len(data))
+	}
+	n := len(data)
+	if n > previewLen {
+		n = previewLen
+	}
+	return fmt.Sprintf("%d bytes: %s", len(data), hex.EncodeToString(data[:n]))
+}
+
+func logDebugf(format string, args ...interface{}) { Logf(LogDebug, format, args...) }
+func logInfof(format string, args ...interface{})  { Logf(LogInfo, format, args...) }
+func logWarnf(format string, args ...interface{})  { Logf(LogWarn, format, args...) }
+func logErrorf(format string, args ...interface{}) { Logf(LogError, format, args...) }
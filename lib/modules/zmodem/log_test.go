@@ -0,0 +1,50 @@
+package zmodem
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestLogCallbackReentry 日志回调不在持有引擎锁或日志锁时调用，回调中可以调用引擎的方法并再次记录日志
+func TestLogCallbackReentry(t *testing.T) {
+	var (
+		engine atomic.Pointer[ZmodemImpl]
+		calls  atomic.Int32
+	)
+	err := SetLogConfig(LogConfig{Level: LogDebug, Sink: LogSinkCallback}, func(level LogLevel, message string) {
+		if z := engine.Load(); z != nil {
+			z.GetState()
+			z.Stats()
+		}
+		if calls.Add(1) == 1 {
+			Logf(LogDebug, "回调中记录的日志")
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetLogConfig(DefaultLogConfig(), nil) })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		data := testPayload(5000)
+		sender := NewSender(memorySources([]loopFile{{"a.bin", data}}), Options{})
+		engine.Store(sender)
+		receiver := NewReceiver(NewMemorySink(), Options{})
+		l := newLoopback(t, sender, receiver)
+		l.run()
+		if sender.GetState() != StateCompleted || receiver.GetState() != StateCompleted {
+			t.Errorf("状态 = %s (%v) / %s (%v)", sender.GetState(), sender.GetError(), receiver.GetState(), receiver.GetError())
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("日志回调中调用引擎的方法时死锁")
+	}
+	if calls.Load() < 2 {
+		t.Errorf("日志回调只调用了 %d 次", calls.Load())
+	}
+}
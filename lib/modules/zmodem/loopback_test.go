@@ -0,0 +1,415 @@
+package zmodem
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// impairment 在数据经过管道时修改数据：off 为 chunk 在数据流中的偏移，返回实际投递的数据块（可以为空或多块）
+type impairment func(off int64, chunk []byte) [][]byte
+
+// corruptAt 翻转数据流中第 at 个字节（只翻转一次）
+func corruptAt(at int64) impairment {
+	done := false
+	return func(off int64, chunk []byte) [][]byte {
+		if i := at - off; !done && i >= 0 && i < int64(len(chunk)) {
+			chunk = append([]byte(nil), chunk...)
+			chunk[i] ^= 0x55
+			done = true
+		}
+		return [][]byte{chunk}
+	}
+}
+
+// corruptRandom 以概率 rate 翻转每个数据块中的一个随机字节
+func corruptRandom(seed int64, rate float64) impairment {
+	rng := rand.New(rand.NewSource(seed))
+	return func(off int64, chunk []byte) [][]byte {
+		if len(chunk) > 0 && rng.Float64() < rate {
+			chunk = append([]byte(nil), chunk...)
+			chunk[rng.Intn(len(chunk))] ^= byte(1 + rng.Intn(255))
+		}
+		return [][]byte{chunk}
+	}
+}
+
+// dropChunks 丢弃第 n 个数据块（从 0 开始计数）
+func dropChunks(n ...int) impairment {
+	drop := make(map[int]bool, len(n))
+	for _, i := range n {
+		drop[i] = true
+	}
+	count := 0
+	return func(off int64, chunk []byte) [][]byte {
+		count++
+		if drop[count-1] {
+			return nil
+		}
+		return [][]byte{chunk}
+	}
+}
+
+// duplicateChunks 把第 n 个数据块投递两次
+func duplicateChunks(n ...int) impairment {
+	dup := make(map[int]bool, len(n))
+	for _, i := range n {
+		dup[i] = true
+	}
+	count := 0
+	return func(off int64, chunk []byte) [][]byte {
+		count++
+		if dup[count-1] {
+			return [][]byte{chunk, chunk}
+		}
+		return [][]byte{chunk}
+	}
+}
+
+// resplit 把数据块重新切分为最多 size 字节的小块；size 为 0 时切分为随机大小（1 到 64 字节）
+func resplit(seed int64, size int) impairment {
+	rng := rand.New(rand.NewSource(seed))
+	return func(off int64, chunk []byte) [][]byte {
+		var out [][]byte
+		for len(chunk) > 0 {
+			n := size
+			if n == 0 {
+				n = 1 + rng.Intn(64)
+			}
+			if n > len(chunk) {
+				n = len(chunk)
+			}
+			out = append(out, chunk[:n])
+			chunk = chunk[n:]
+		}
+		return out
+	}
+}
+
+// delivery 在途的数据块
+type delivery struct {
+	due  time.Time
+	data []byte
+}
+
+// pipe 单向的内存管道
+type pipe struct {
+	impairments []impairment
+	latency     time.Duration
+	queue       []delivery
+	offset      int64 // 已写入的字节数（损伤之前）
+	delivered   int64 // 已投递的字节数（损伤之后）
+}
+
+// write 写入一块数据，经过损伤后在 latency 之后投递
+func (p *pipe) write(now time.Time, data []byte) {
+	chunks := [][]byte{append([]byte(nil), data...)}
+	for _, impair := range p.impairments {
+		var next [][]byte
+		off := p.offset
+		for _, c := range chunks {
+			next = append(next, impair(off, c)...)
+			off += int64(len(c))
+		}
+		chunks = next
+	}
+	p.offset += int64(len(data))
+	for _, c := range chunks {
+		p.queue = append(p.queue, delivery{due: now.Add(p.latency), data: c})
+	}
+}
+
+// deliver 把到期的数据交给 z，返回是否投递了数据
+func (p *pipe) deliver(now time.Time, z *ZmodemImpl) bool {
+	delivered := false
+	for len(p.queue) > 0 && !p.queue[0].due.After(now) {
+		d := p.queue[0]
+		p.queue = p.queue[1:]
+		p.delivered += int64(len(d.data))
+		z.FeedData(d.data)
+		delivered = true
+	}
+	return delivered
+}
+
+// loopback 在内存中把发送方引擎和接收方引擎连接起来，使用虚拟时钟，结果完全确定
+type loopback struct {
+	t          *testing.T
+	sender     *ZmodemImpl
+	receiver   *ZmodemImpl
+	toReceiver pipe
+	toSender   pipe
+	clock      time.Time
+	bufSize    int
+	// onStep 每一步之后调用（如在传输中途取消）
+	onStep func(l *loopback)
+}
+
+// newLoopback 连接 sender 和 receiver，并让两者使用同一个虚拟时钟
+func newLoopback(t *testing.T, sender, receiver *ZmodemImpl) *loopback {
+	l := &loopback{
+		t:        t,
+		sender:   sender,
+		receiver: receiver,
+		clock:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		bufSize:  4096,
+	}
+	for _, z := range []*ZmodemImpl{sender, receiver} {
+		z.mu.Lock()
+		z.now = func() time.Time { return l.clock }
+		z.lastActivity = l.clock
+		// 创建引擎时（如 session_start）已排队的事件改用虚拟时钟的时间
+		for i := range z.events {
+			z.events[i].Time = l.clock.UnixMilli()
+		}
+		z.mu.Unlock()
+	}
+	return l
+}
+
+// idleStep 两端都没有数据可以交换时虚拟时钟前进的步长（用于触发超时重试）
+const idleStep = time.Second
+
+// maxLoopbackTime 虚拟时间的上限，超过时认为会话卡住
+const maxLoopbackTime = 10 * time.Minute
+
+// run 交换数据直到两端都结束
+func (l *loopback) run() {
+	l.t.Helper()
+	start := l.clock
+	buf := make([]byte, l.bufSize)
+	for {
+		if l.sender.GetState().IsTerminal() && l.receiver.GetState().IsTerminal() {
+			return
+		}
+		if l.clock.Sub(start) > maxLoopbackTime {
+			l.t.Fatalf("会话没有结束: sender=%s (%v), receiver=%s (%v)",
+				l.sender.GetState(), l.sender.GetError(), l.receiver.GetState(), l.receiver.GetError())
+		}
+
+		progressed := false
+		if n, _ := l.sender.GetOutputData(buf); n > 0 {
+			l.toReceiver.write(l.clock, buf[:n])
+			progressed = true
+		}
+		if n, _ := l.receiver.GetOutputData(buf); n > 0 {
+			l.toSender.write(l.clock, buf[:n])
+			progressed = true
+		}
+		if l.toReceiver.deliver(l.clock, l.receiver) {
+			progressed = true
+		}
+		if l.toSender.deliver(l.clock, l.sender) {
+			progressed = true
+		}
+		if l.onStep != nil {
+			l.onStep(l)
+		}
+		if !progressed {
+			l.advance()
+		}
+	}
+}
+
+// advance 没有数据可以交换时推进虚拟时钟：前进到最早的投递时间或引擎的定时（如限速等待），最多前进 idleStep
+func (l *loopback) advance() {
+	next := l.clock.Add(idleStep)
+	for _, z := range []*ZmodemImpl{l.sender, l.receiver} {
+		if d, ok := z.timerDelay(); ok && d > 0 && l.clock.Add(d).Before(next) {
+			next = l.clock.Add(d)
+		}
+	}
+	for _, p := range []*pipe{&l.toReceiver, &l.toSender} {
+		if len(p.queue) > 0 && p.queue[0].due.Before(next) {
+			next = p.queue[0].due
+		}
+	}
+	l.clock = next
+}
+
+// loopFile 测试用的文件
+type loopFile struct {
+	name string
+	data []byte
+}
+
+func memorySources(files []loopFile) []FileSource {
+	sources := make([]FileSource, len(files))
+	for i, f := range files {
+		sources[i] = NewMemorySource(FileInfo{Name: f.name, Size: int64(len(f.data))}, f.data)
+	}
+	return sources
+}
+
+func TestLoopbackTransfer(t *testing.T) {
+	single := []loopFile{{"a.bin", testPayload(50000)}}
+	batch := []loopFile{
+		{"one.txt", []byte("hello\n")},
+		{"two.bin", testPayload(subpacketSize * 3)},
+		{"three.bin", testPayload(12345)},
+	}
+	empty := []loopFile{{"empty.txt", nil}}
+	withEmpty := []loopFile{{"empty.txt", nil}, {"b.bin", testPayload(3000)}, {"empty2.txt", []byte{}}}
+
+	tests := []struct {
+		name       string
+		files      []loopFile
+		toReceiver []impairment
+		toSender   []impairment
+		latency    time.Duration
+		bufSize    int
+		wantRetry  bool // 损伤必须触发重传或超时重试（而不是被协议本身容忍）
+	}{
+		{name: "single", files: single},
+		{name: "batch", files: batch},
+		{name: "empty file", files: empty},
+		{name: "empty files in batch", files: withEmpty},
+		{name: "small buffer", files: batch, bufSize: 7},
+		{name: "corrupt data", files: single, toReceiver: []impairment{corruptAt(20000)}, wantRetry: true},
+		{name: "corrupt header", files: batch, toReceiver: []impairment{corruptAt(30)}, wantRetry: true},
+		{name: "corrupt random", files: batch, toReceiver: []impairment{corruptRandom(1, 0.2)}, wantRetry: true},
+		{name: "corrupt ack", files: batch, toSender: []impairment{corruptRandom(2, 0.3)}},
+		{name: "drop data", files: single, toReceiver: []impairment{dropChunks(3)}, wantRetry: true},
+		{name: "drop first ZRINIT", files: single, toSender: []impairment{dropChunks(0)}},
+		{name: "drop ZRQINIT", files: single, toReceiver: []impairment{dropChunks(0)}},
+		{name: "drop last data", files: []loopFile{{"a.bin", testPayload(100)}}, toReceiver: []impairment{dropChunks(1)}, wantRetry: true},
+		{name: "duplicate data", files: single, toReceiver: []impairment{duplicateChunks(2, 5)}, wantRetry: true},
+		{name: "duplicate ack", files: batch, toSender: []impairment{duplicateChunks(1, 2, 3)}, wantRetry: true},
+		{name: "resplit bytes", files: batch, toReceiver: []impairment{resplit(0, 1)}, toSender: []impairment{resplit(0, 1)}},
+		{name: "resplit random", files: single, toReceiver: []impairment{resplit(3, 0)}, toSender: []impairment{resplit(4, 0)}},
+		{name: "latency", files: batch, latency: 200 * time.Millisecond},
+		{name: "latency with drops", files: single, latency: 50 * time.Millisecond,
+			toReceiver: []impairment{dropChunks(2, 7)}, toSender: []impairment{dropChunks(1)}, wantRetry: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := NewMemorySink()
+			sender := NewSender(memorySources(tt.files), Options{})
+			receiver := NewReceiver(sink, Options{})
+			l := newLoopback(t, sender, receiver)
+			l.toReceiver.impairments = tt.toReceiver
+			l.toSender.impairments = tt.toSender
+			l.toReceiver.latency = tt.latency
+			l.toSender.latency = tt.latency
+			if tt.bufSize > 0 {
+				l.bufSize = tt.bufSize
+			}
+			l.run()
+
+			retried := false
+			for _, z := range []*ZmodemImpl{sender, receiver} {
+				for e, ok := z.PollEvent(); ok; e, ok = z.PollEvent() {
+					retried = retried || e.Type == EventRetry
+				}
+			}
+			if tt.wantRetry && !retried {
+				t.Error("损伤没有触发重传")
+			}
+
+			if sender.GetState() != StateCompleted || receiver.GetState() != StateCompleted {
+				t.Fatalf("会话未完成: sender=%s (%v), receiver=%s (%v)",
+					sender.GetState(), sender.GetError(), receiver.GetState(), receiver.GetError())
+			}
+			got := sink.Files()
+			if len(got) != len(tt.files) {
+				t.Fatalf("收到 %d 个文件，期望 %d 个", len(got), len(tt.files))
+			}
+			for i, f := range tt.files {
+				if got[i].Info.Name != f.name || !bytes.Equal(got[i].Data, f.data) {
+					t.Errorf("文件 %d 不一致: %s (%d 字节)，期望 %s (%d 字节)",
+						i, got[i].Info.Name, len(got[i].Data), f.name, len(f.data))
+				}
+			}
+			for _, r := range receiver.Results() {
+				if !r.Completed || r.SHA256 == "" {
+					t.Errorf("接收结果不正确: %+v", r)
+				}
+			}
+		})
+	}
+}
+
+func TestLoopbackResume(t *testing.T) {
+	data := testPayload(40000)
+	const have = 15000
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.bin.part"), data[:have], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sink := &DirSink{Dir: dir, Collision: CollisionResume}
+	sender := NewSender(memorySources([]loopFile{{"a.bin", data}}), Options{Resume: true})
+	receiver := NewReceiver(sink, Options{})
+	l := newLoopback(t, sender, receiver)
+	l.run()
+	receiver.Close()
+
+	if receiver.GetState() != StateCompleted {
+		t.Fatalf("会话未完成: %s (%v)", receiver.GetState(), receiver.GetError())
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "a.bin"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("续传后的文件不一致: %v", err)
+	}
+	if sent := l.toReceiver.offset; sent >= int64(len(data)) {
+		t.Errorf("续传时发送了 %d 字节，应只发送缺少的部分", sent)
+	}
+	if r := receiver.Results()[0]; r.SHA256 != fmt.Sprintf("%x", sha256.Sum256(data)) {
+		t.Errorf("续传后的摘要不正确: %s", r.SHA256)
+	}
+}
+
+func TestLoopbackAbort(t *testing.T) {
+	data := testPayload(200000)
+	tests := []struct {
+		name      string
+		abort     func(l *loopback)
+		senderErr error
+		recvErr   error
+	}{
+		{
+			name:      "sender",
+			abort:     func(l *loopback) { l.sender.Abort(ErrCancelled) },
+			senderErr: ErrCancelled,
+			recvErr:   ErrPeerCancelled,
+		},
+		{
+			name:      "receiver",
+			abort:     func(l *loopback) { l.receiver.Abort(ErrCancelled) },
+			senderErr: ErrPeerCancelled,
+			recvErr:   ErrCancelled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			sender := NewSender(memorySources([]loopFile{{"a.bin", data}}), Options{})
+			receiver := NewReceiver(NewDirSink(dir), Options{})
+			l := newLoopback(t, sender, receiver)
+			aborted := false
+			l.onStep = func(l *loopback) {
+				if !aborted && l.toReceiver.delivered > int64(len(data)/2) {
+					tt.abort(l)
+					aborted = true
+				}
+			}
+			l.run()
+			receiver.Close()
+
+			if !errors.Is(sender.GetError(), tt.senderErr) || !errors.Is(receiver.GetError(), tt.recvErr) {
+				t.Fatalf("错误不正确: sender=%v, receiver=%v", sender.GetError(), receiver.GetError())
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("取消后不应留下文件: %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package zmodem
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// lrzsz 互通语料（testdata/lrzsz，格式见其中的 README.md）
+//
+// 每个 .transcript 文件记录对端（lrzsz 的 sz/rz）发来的原始字节，以及对端在每一步需要收到的帧。
+// 回放时把对端数据依次输入引擎，比较引擎发出的帧头（类型和位置），最后检查生成的文件：
+// 下载时与 <名称>.files/ 目录逐个比较，上传时从引擎输出的数据子包还原文件内容再比较。
+
+// transcriptStep 语料中的一步：输入对端数据，或检查引擎的输出
+type transcriptStep struct {
+	line   int
+	peer   []byte // 非 nil 时为对端发来的数据
+	expect string // 期望引擎发出的帧（如 "ZRPOS 0"、"ZFILE a.txt"、"OO"）
+}
+
+// transcript 一份互通语料
+type transcript struct {
+	mode  int
+	opts  Options
+	send  []string // 上传时按顺序发送的文件（位于 <名称>.files/）
+	steps []transcriptStep
+	end   State
+}
+
+// readTranscript 解析语料文件
+func readTranscript(path string) (*transcript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tr := &transcript{mode: -1, end: StateCompleted}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keyword, arg, _ := strings.Cut(line, " ")
+		switch keyword {
+		case "mode":
+			switch arg {
+			case "send":
+				tr.mode = modeSend
+			case "receive":
+				tr.mode = modeReceive
+			default:
+				return nil, fmt.Errorf("第 %d 行: 未知的 mode %q", n, arg)
+			}
+		case "options":
+			if tr.opts, err = ParseOptions(arg); err != nil {
+				return nil, fmt.Errorf("第 %d 行: %w", n, err)
+			}
+		case "send":
+			tr.send = strings.Fields(arg)
+		case "peer":
+			data, err := strconv.Unquote(arg)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 行: 无法解析对端数据: %w", n, err)
+			}
+			tr.steps = append(tr.steps, transcriptStep{line: n, peer: []byte(data)})
+		case "expect":
+			tr.steps = append(tr.steps, transcriptStep{line: n, expect: arg})
+		case "end":
+			switch arg {
+			case "completed":
+				tr.end = StateCompleted
+			case "error":
+				tr.end = StateError
+			default:
+				return nil, fmt.Errorf("第 %d 行: 未知的结束状态 %q", n, arg)
+			}
+		default:
+			return nil, fmt.Errorf("第 %d 行: 未知的关键字 %q", n, keyword)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if tr.mode < 0 {
+		return nil, fmt.Errorf("缺少 mode")
+	}
+	return tr, nil
+}
+
+// sentFile 从引擎输出还原的上传文件
+type sentFile struct {
+	name  string
+	start int64 // 第一个 ZDATA 的位置（续传时不为 0）
+	data  []byte
+}
+
+// engineOutput 解析引擎的输出：帧头转换为语料中的写法，数据子包还原为文件内容
+type engineOutput struct {
+	parser *FrameParser
+	names  nameCodec
+	frames []string
+	raw    []byte // 上一次检查之后的原始输出
+	files  []*sentFile
+	pos    int64 // 当前 ZDATA 的写入位置
+}
+
+func (o *engineOutput) add(data []byte) error {
+	o.raw = append(o.raw, data...)
+	o.parser.AddData(data)
+	for {
+		frame, err := o.parser.ParseFrame()
+		if err != nil {
+			return fmt.Errorf("引擎输出无法解析: %w", err)
+		}
+		if frame == nil {
+			return nil
+		}
+		if frame.Subpacket {
+			file := o.files[len(o.files)-1]
+			if end := o.pos - file.start + int64(len(frame.Data)); end > int64(len(file.data)) {
+				file.data = append(file.data, make([]byte, end-int64(len(file.data)))...)
+			}
+			copy(file.data[o.pos-file.start:], frame.Data)
+			o.pos += int64(len(frame.Data))
+			continue
+		}
+
+		desc := frame.Type.String()
+		switch frame.Type {
+		case FrameZFILE:
+			info := decodeFileInfo(frame.Data, o.names)
+			o.files = append(o.files, &sentFile{name: info.Name, start: -1})
+			desc += " " + info.Name
+		case FrameZDATA:
+			o.pos = int64(frame.Position())
+			if file := o.files[len(o.files)-1]; file.start < 0 {
+				file.start = o.pos
+			}
+			desc += " " + strconv.FormatInt(o.pos, 10)
+		case FrameZRPOS, FrameZACK, FrameZEOF:
+			desc += " " + strconv.FormatUint(uint64(frame.Position()), 10)
+		}
+		o.frames = append(o.frames, desc)
+	}
+}
+
+// check 比较上一次检查之后引擎发出的帧
+func (o *engineOutput) check(want []string) error {
+	got := o.frames
+	if len(want) > 0 && want[len(want)-1] == "OO" {
+		want = want[:len(want)-1]
+		if !bytes.HasSuffix(o.raw, []byte("OO")) {
+			return fmt.Errorf("引擎没有在最后发出 \"OO\"，输出 %q", o.raw)
+		}
+	}
+	o.frames, o.raw = nil, nil
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		return fmt.Errorf("引擎发出 [%s]，期望 [%s]", strings.Join(got, ", "), strings.Join(want, ", "))
+	}
+	return nil
+}
+
+// readDirFiles 读取目录中的所有文件（不含子目录）
+func readDirFiles(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return files
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = data
+	}
+	return files
+}
+
+// replayTranscript 回放一份语料
+func replayTranscript(t *testing.T, path string) {
+	tr, err := readTranscript(path)
+	if err != nil {
+		t.Fatalf("读取语料失败: %v", err)
+	}
+	base := strings.TrimSuffix(path, ".transcript")
+	expected := readDirFiles(t, base+".files")
+
+	var z *ZmodemImpl
+	dir := t.TempDir()
+	if tr.mode == modeSend {
+		var sources []FileSource
+		for _, name := range tr.send {
+			data, ok := expected[name]
+			if !ok {
+				t.Fatalf("%s.files 中没有 %s", base, name)
+			}
+			sources = append(sources, NewMemorySource(FileInfo{Name: name}, data))
+		}
+		z = NewSender(sources, tr.opts)
+	} else {
+		for name, data := range readDirFiles(t, base+".setup") {
+			if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sink := NewDirSink(dir)
+		sink.Collision = tr.opts.Collision
+		sink.KeepPartial = tr.opts.KeepPartial
+		z = NewReceiver(sink, tr.opts)
+	}
+	defer z.Close()
+
+	out := &engineOutput{parser: NewFrameParser(), names: newNameCodec(tr.opts.RemoteCharset)}
+	var want []string
+	for _, step := range tr.steps {
+		if err := out.add(drain(z)); err != nil {
+			t.Fatalf("第 %d 行之前: %v", step.line, err)
+		}
+		if step.peer == nil {
+			want = append(want, step.expect)
+			continue
+		}
+		if err := out.check(want); err != nil {
+			t.Fatalf("第 %d 行之前: %v", step.line, err)
+		}
+		want = nil
+		z.FeedData(step.peer)
+	}
+	if err := out.add(drain(z)); err != nil {
+		t.Fatalf("结束时: %v", err)
+	}
+	if err := out.check(want); err != nil {
+		t.Fatalf("结束时: %v", err)
+	}
+	if state := z.GetState(); state != tr.end {
+		t.Fatalf("结束状态 = %s (%v)，期望 %s", state, z.GetError(), tr.end)
+	}
+
+	if tr.mode == modeReceive {
+		got := readDirFiles(t, dir)
+		if len(got) != len(expected) {
+			t.Errorf("保存目录中的文件 = %v，期望 %v", sortedKeys(got), sortedKeys(expected))
+		}
+		for name, data := range expected {
+			if !bytes.Equal(got[name], data) {
+				t.Errorf("%s 的内容与 %s.files 不一致（%d 字节，期望 %d 字节）", name, base, len(got[name]), len(data))
+			}
+		}
+		return
+	}
+	for _, file := range out.files {
+		data := expected[file.name]
+		if file.start < 0 {
+			continue // 对方跳过，没有发送数据
+		}
+		if end := file.start + int64(len(file.data)); end != int64(len(data)) || !bytes.Equal(file.data, data[file.start:]) {
+			t.Errorf("发送的 %s 与原文件不一致：位置 %d-%d，文件 %d 字节", file.name, file.start, end, len(data))
+		}
+	}
+}
+
+// sortedKeys 返回排序后的文件名
+func sortedKeys(files map[string][]byte) []string {
+	keys := make([]string, 0, len(files))
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestLrzszTranscripts 回放 testdata/lrzsz 中的全部语料
+func TestLrzszTranscripts(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "lrzsz", "*.transcript"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("testdata/lrzsz 中没有语料")
+	}
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".transcript"), func(t *testing.T) {
+			replayTranscript(t, path)
+		})
+	}
+}
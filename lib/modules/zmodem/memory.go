@@ -0,0 +1,95 @@
+package zmodem
+
+import (
+	"bytes"
+	"sync"
+)
+
+// memorySource 基于内存数据的 FileSource
+type memorySource struct {
+	*bytes.Reader
+	info FileInfo
+}
+
+// NewMemorySource 创建发送内存数据的 FileSource（如生成的内容、剪贴板数据）
+// info.Size 以 data 的长度为准
+func NewMemorySource(info FileInfo, data []byte) FileSource {
+	info.Size = int64(len(data))
+	return &memorySource{Reader: bytes.NewReader(data), info: info}
+}
+
+// Info 返回文件信息
+func (s *memorySource) Info() FileInfo {
+	return s.info
+}
+
+// Close 内存数据无需释放
+func (s *memorySource) Close() error {
+	return nil
+}
+
+// MemoryFile 接收到内存中的文件
+type MemoryFile struct {
+	Info FileInfo
+	Data []byte
+}
+
+// MemorySink 将收到的文件保存在内存中，只保留完整收到（已提交）的文件
+type MemorySink struct {
+	mu    sync.Mutex
+	files []MemoryFile
+}
+
+// NewMemorySink 创建保存到内存的 Sink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Create 创建内存写入目标
+func (s *MemorySink) Create(info FileInfo) (FileWriter, error) {
+	return &memoryWriter{sink: s, info: info}, nil
+}
+
+// Files 返回已完整收到的文件
+func (s *MemorySink) Files() []MemoryFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]MemoryFile(nil), s.files...)
+}
+
+// memoryWriter 写入内存的 FileWriter
+type memoryWriter struct {
+	sink *MemorySink
+	info FileInfo
+	data []byte
+}
+
+// WriteAt 在 off 处写入数据，必要时扩展缓冲区
+func (w *memoryWriter) WriteAt(p []byte, off int64) (int, error) {
+	end := int(off) + len(p)
+	if end > len(w.data) {
+		if end > cap(w.data) {
+			grown := make([]byte, end, end*2)
+			copy(grown, w.data)
+			w.data = grown
+		} else {
+			w.data = w.data[:end]
+		}
+	}
+	copy(w.data[off:], p)
+	return len(p), nil
+}
+
+// Commit 将文件加入 Sink 的结果
+func (w *memoryWriter) Commit() error {
+	w.sink.mu.Lock()
+	defer w.sink.mu.Unlock()
+	w.sink.files = append(w.sink.files, MemoryFile{Info: w.info, Data: w.data})
+	return nil
+}
+
+// Abort 丢弃已收到的数据
+func (w *memoryWriter) Abort() error {
+	w.data = nil
+	return nil
+}
@@ -0,0 +1,224 @@
+package zmodem
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	progressInterval = 100 * time.Millisecond // 两次进度回调的最小间隔
+	minTimerDelay    = time.Millisecond       // 定时器的最短间隔，避免时钟精度不足时空转
+)
+
+// Callbacks 会话事件回调，由 Session.SetCallbacks 注册，为 nil 的回调不会被调用
+//
+// 所有回调都在该会话专属的 goroutine 中依次调用（同一会话的回调不会并发），
+// 切片参数只在回调期间有效。回调中可以调用同一会话的 FeedData 等方法，但不能移除该会话
+// （RemoveSession 会等待正在执行的回调返回）。
+// 宿主 I/O 会话（FuncSource、SinkFunc）的读取函数此后也在该 goroutine 中调用。
+type Callbacks struct {
+	// Output 有数据需要发给对方。设置后输出只通过该回调交付，宿主不应再调用 GetOutputData；
+	// 设置了 Options.OutputWindow 时，宿主把数据写出后需调用 Session.AckOutput 确认
+	Output func(data []byte)
+	// Progress 当前文件的进度变化（最多每 100ms 一次，文件结束和会话结束时总会通知）
+	Progress func(transferred, total int64)
+	// FileStart 开始传输第 index 个文件
+	FileStart func(index int, result FileResult)
+	// FileEnd 第 index 个文件结束（完成、跳过或失败，见 result）
+	FileEnd func(index int, result FileResult)
+	// Finish 会话结束，status 为 StatusCompleted 或 StatusError
+	Finish func(status SessionStatus, err error)
+}
+
+// SetCallbacks 注册事件回调并启动会话 goroutine，每个会话只能注册一次
+// 之后由该 goroutine 驱动超时重试、输出数据并通知进度，宿主不再需要轮询
+func (s *Session) SetCallbacks(cb Callbacks) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.impl == nil {
+		return errors.New("会话没有关联的传输引擎")
+	}
+	if s.stop != nil {
+		return errors.New("会话已注册回调")
+	}
+	s.stop = make(chan struct{})
+	s.wake = make(chan struct{}, 1)
+	s.done = make(chan struct{})
+	go s.runCallbacks(s.impl, cb, s.stop, s.wake, s.done)
+	return nil
+}
+
+// Wake 通知会话 goroutine 有新的输入（如 FeedData 之后），未注册回调时无操作
+func (s *Session) Wake() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.wake == nil {
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// AckOutput 宿主确认已写出 n 字节 Output 回调交付的数据（只在设置了 Options.OutputWindow 时需要）
+func (s *Session) AckOutput(n int) {
+	s.mu.Lock()
+	s.unacked = max(s.unacked-int64(n), 0)
+	s.mu.Unlock()
+	s.Wake()
+}
+
+// outputRoom 输出窗口中还能交付的字节数，最多为 limit
+func (s *Session) outputRoom(window, limit int) int {
+	if window <= 0 {
+		return limit
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int(min(int64(limit), max(int64(window)-s.unacked, 0)))
+}
+
+// stopCallbacks 停止会话 goroutine，并等待正在执行的回调返回；之后不会再发起新的回调
+// 不能在该会话的回调中调用
+func (s *Session) stopCallbacks() {
+	s.mu.Lock()
+	if s.stop != nil && !s.stopped {
+		close(s.stop)
+		s.stopped = true
+	}
+	done := s.done
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// runCallbacks 会话 goroutine：输出数据、比较引擎状态并调用相应的回调，直到会话结束或被停止
+// 没有输入时只在下一个超时（重试、等待 "OO"、进度节流）到期时醒来
+func (s *Session) runCallbacks(impl *ZmodemImpl, cb Callbacks, stop <-chan struct{}, wake <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var (
+		buf          = make([]byte, ioBufferSize)
+		window       = impl.opts.OutputWindow
+		started      int // 已通知 FileStart 的文件数
+		ended        int // 已通知 FileEnd 的文件数
+		lastProgress time.Time
+		lastSent     [2]int64
+	)
+	stopped := func() bool {
+		select {
+		case <-stop:
+			return true
+		default:
+			return false
+		}
+	}
+
+	for {
+		// 先取状态再输出，保证进入结束状态前排队的数据（如取消序列）都已交付
+		state := impl.GetState()
+		terminal := state.IsTerminal()
+
+		if cb.Output != nil {
+			for {
+				room := s.outputRoom(window, len(buf))
+				if room == 0 {
+					break // 等待宿主确认（AckOutput 会唤醒）
+				}
+				n, _ := impl.GetOutputData(buf[:room])
+				if n == 0 || stopped() {
+					break
+				}
+				if window > 0 {
+					s.mu.Lock()
+					s.unacked += int64(n)
+					s.mu.Unlock()
+				}
+				cb.Output(buf[:n])
+			}
+		}
+
+		// 按文件顺序通知：一个文件结束之后才通知下一个文件开始，进度总是属于最后一个（当前）文件
+		results := impl.Results()
+		for i := ended; i < len(results) && !stopped(); i++ {
+			if i >= started {
+				if cb.FileStart != nil {
+					cb.FileStart(i, results[i])
+				}
+				started = i + 1
+			}
+			if i == len(results)-1 {
+				break
+			}
+			if cb.FileEnd != nil {
+				cb.FileEnd(i, results[i])
+			}
+			ended = i + 1
+		}
+
+		progress := [2]int64{impl.GetTransferred(), impl.GetFileSize()}
+		current := len(results) - 1
+		currentDone := current >= ended && (terminal || fileDone(results[current]))
+		progressDue := cb.Progress != nil && progress != lastSent
+		if progressDue && !stopped() && (currentDone || time.Since(lastProgress) >= progressInterval) {
+			cb.Progress(progress[0], progress[1])
+			lastSent = progress
+			lastProgress = time.Now()
+			progressDue = false
+		}
+		if currentDone && current < started && !stopped() {
+			if cb.FileEnd != nil {
+				cb.FileEnd(current, results[current])
+			}
+			ended = current + 1
+		}
+
+		if terminal {
+			if cb.Finish != nil && !stopped() {
+				cb.Finish(state.SessionStatus(), impl.GetError())
+			}
+			return
+		}
+
+		// 只为最近的一个截止时间设置定时器，其余情况等待 wake
+		delay, armed := impl.timerDelay()
+		if progressDue {
+			next := progressInterval - time.Since(lastProgress)
+			if !armed || next < delay {
+				delay, armed = next, true
+			}
+		}
+		var tick <-chan time.Time
+		if armed {
+			resetTimer(timer, max(delay, minTimerDelay))
+			tick = timer.C
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-wake:
+		case <-tick:
+		}
+	}
+}
+
+// resetTimer 停止 t 并清空未取走的到期信号后重新设置
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// fileDone 判断文件的传输结果是否已经确定
+func fileDone(r FileResult) bool {
+	return r.Completed || r.Skipped || r.Err != nil
+}
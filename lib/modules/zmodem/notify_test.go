@@ -0,0 +1,146 @@
+package zmodem
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor 等待 cond 成立，超时则测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newCallbackSender 创建发送 size 字节文件的会话
+func newCallbackSender(t *testing.T, size int, opts Options) *Session {
+	t.Helper()
+	impl := NewSender([]FileSource{NewMemorySource(FileInfo{Name: "a.bin"}, testPayload(size))}, opts)
+	session, err := NewSession(modeSend, "a.bin", impl)
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	t.Cleanup(func() { RemoveSession(session.ID) })
+	return session
+}
+
+// startStreaming 模拟接收方：回复 ZRINIT 和 ZRPOS，使发送方开始流式发送数据
+func startStreaming(s *Session) {
+	s.GetImpl().FeedData(BuildZRINITFrame(CANFDX | CANOVIO | CANFC32))
+	s.Wake()
+	s.GetImpl().FeedData(BuildZRPOSFrame(0))
+	s.Wake()
+}
+
+// TestRemoveSessionWaitsForCallback 移除会话时等待正在执行的回调返回，之后不再发起回调
+func TestRemoveSessionWaitsForCallback(t *testing.T) {
+	session := newCallbackSender(t, 1024, Options{})
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := 0
+	err := session.SetCallbacks(Callbacks{Output: func([]byte) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if first {
+			close(entered)
+			<-release
+		}
+	}})
+	if err != nil {
+		t.Fatalf("注册回调失败: %v", err)
+	}
+	<-entered
+
+	removed := make(chan struct{})
+	go func() {
+		RemoveSession(session.ID)
+		close(removed)
+	}()
+	select {
+	case <-removed:
+		t.Fatal("回调返回前 RemoveSession 已返回")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-removed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("回调返回后 RemoveSession 仍未返回")
+	}
+
+	// 会话已移除，之后的输入不应再触发回调
+	startStreaming(session)
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Fatalf("移除会话后仍调用了 %d 次回调", calls-1)
+	}
+}
+
+// TestOutputWindow 设置 OutputWindow 后，未确认的输出不超过窗口，确认后继续输出
+func TestOutputWindow(t *testing.T) {
+	const window = 4096
+	session := newCallbackSender(t, 256*1024, Options{OutputWindow: window})
+
+	var mu sync.Mutex
+	delivered := 0
+	err := session.SetCallbacks(Callbacks{Output: func(data []byte) {
+		mu.Lock()
+		delivered += len(data)
+		mu.Unlock()
+	}})
+	if err != nil {
+		t.Fatalf("注册回调失败: %v", err)
+	}
+	got := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return delivered
+	}
+
+	startStreaming(session)
+	waitFor(t, "输出填满窗口", func() bool { return got() == window })
+	time.Sleep(20 * time.Millisecond)
+	if n := got(); n != window {
+		t.Fatalf("未确认时输出了 %d 字节，窗口为 %d", n, window)
+	}
+
+	session.AckOutput(window)
+	waitFor(t, "确认后继续输出", func() bool { return got() == 2*window })
+}
+
+// TestTimerDelay 等待对方响应时按重试间隔设置定时器，流式发送时不需要定时器
+func TestTimerDelay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	z := NewSender([]FileSource{NewMemorySource(FileInfo{Name: "a.bin"}, testPayload(64*1024))}, Options{})
+	z.now = func() time.Time { return now }
+	z.lastActivity = now
+
+	buf := make([]byte, 4096)
+	z.GetOutputData(buf) // 发出 ZRQINIT，等待 ZRINIT
+	if d, ok := z.timerDelay(); !ok || d != retryInterval {
+		t.Fatalf("等待 ZRINIT 时定时器 = %v, %v，期望 %v", d, ok, retryInterval)
+	}
+
+	z.FeedData(BuildZRINITFrame(CANFDX | CANOVIO | CANFC32))
+	z.GetOutputData(buf)
+	z.FeedData(BuildZRPOSFrame(0))
+	if state := z.GetState(); state != StateSendingData {
+		t.Fatalf("状态 = %s，期望 %s", state, StateSendingData)
+	}
+	if _, ok := z.timerDelay(); ok {
+		t.Fatal("流式发送时不应设置定时器")
+	}
+}
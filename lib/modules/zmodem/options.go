@@ -0,0 +1,46 @@
+package zmodem
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Options 会话选项（由宿主以 JSON 传入，未设置的字段使用默认值）
+type Options struct {
+	// CheckFreeSpace 上传时先通过 ZFREECNT 查询远端剩余空间，空间不足则拒绝开始传输
+	CheckFreeSpace bool `json:"checkFreeSpace"`
+	// KeepPartial 下载失败时保留 "<目标文件>.part" 临时文件（供之后续传），默认删除
+	KeepPartial bool `json:"keepPartial"`
+	// Collision 批量下载时与已有文件同名的处理方式："rename"（默认）、"overwrite"、"skip"、"resume"
+	Collision CollisionPolicy `json:"collision"`
+	// RemoteCharset 远端文件名的字符集（"gbk"、"big5"、"shift-jis"、"latin-1" 等），默认 UTF-8
+	RemoteCharset Charset `json:"remoteCharset"`
+	// MD5 除 SHA-256 外同时计算每个文件的 MD5（用于与旧系统比对）
+	MD5 bool `json:"md5"`
+	// EscapeControl 转义所有控制字符（发送时直接转义，接收时在 ZRINIT 中要求对方转义），
+	// 用于会吞掉或改写控制字符的链路（如某些 telnet、串口服务器）
+	EscapeControl bool `json:"escapeControl"`
+	// Resume 上传时在 ZFILE 中请求接收方续传（ZCRESUM），由接收方决定从哪个位置开始
+	Resume bool `json:"resume"`
+	// Clobber 上传时在 ZFILE 中要求接收方覆盖已有的同名文件（ZMCLOB，与 lrzsz 的 sz -y 相同）
+	Clobber bool `json:"clobber"`
+	// OutputWindow 事件回调模式下已交给 Output 回调、但宿主尚未确认（Session.AckOutput）的字节数上限，
+	// 达到上限后暂停输出直到宿主确认，0 表示不限制
+	OutputWindow int `json:"outputWindow"`
+	// RateLimit 上传时文件数据的速度上限（字节/秒），0 表示不限速；传输过程中可以修改（见 SetRateLimit）
+	RateLimit int64 `json:"rateLimit"`
+	// Trace 将会话的输入输出记录到该文件（见 StartTrace），用于排查兼容性问题和回放
+	Trace string `json:"trace,omitempty"`
+}
+
+// ParseOptions 解析 JSON 格式的会话选项，空字符串返回默认选项
+func ParseOptions(data string) (Options, error) {
+	var opts Options
+	if data == "" {
+		return opts, nil
+	}
+	if err := json.Unmarshal([]byte(data), &opts); err != nil {
+		return opts, fmt.Errorf("解析会话选项失败: %w", err)
+	}
+	return opts, nil
+}
@@ -0,0 +1,6 @@
+//go:build windows
+
+package zmodem
+
+// oNoFollow Windows 没有 O_NOFOLLOW，依靠打开前的 Lstat 检查和打开后的类型检查
+const oNoFollow = 0
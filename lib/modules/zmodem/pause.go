@@ -0,0 +1,69 @@
+package zmodem
+
+// Pause 暂停传输，会话已结束或已暂停时不做任何事
+//
+// 发送方以一个空的 ZCRCW 子包结束当前数据帧（接收方以 ZACK 确认位置），之后不再生成数据子包；
+// 接收方暂存让发送方继续的应答（ZRINIT/ZRPOS/ZACK），对方因等不到应答而停下。
+// 接收文件数据时，流式发送的对方不等待应答：接收方以 ZRPOS 要求从当前位置重传并丢弃之后的数据，
+// 对方重传的第一个子包以 ZCRCW 结束，等不到 ZACK 便停在文件中途。
+// 暂停期间不做超时重试；对方等待超时后发来的重传请求照常处理，但不计入重传上限。
+func (z *ZmodemImpl) Pause() {
+	z.mu.Lock()
+	defer z.unlock()
+	if z.paused || z.state.IsTerminal() {
+		return
+	}
+	z.traceEvent(TracePause, nil)
+	if z.mode == modeReceive && z.state == StateReceivingData {
+		z.discarding = true
+		z.sendHeader(BuildZRPOSFrame(uint32(z.transferred)))
+	}
+	z.paused = true
+	z.lastUsed = z.now()
+	if z.mode == modeSend && z.state == StateSendingData && !z.needHeader && !z.waitingAck {
+		z.outputBuf.Write(BuildDataSubpacket(nil, ZCRCW, z.useCRC32, z.escapeCtl))
+		z.waitingAck = true
+	}
+	z.logf(LogInfo, "传输已暂停，状态: %s，位置: %d", z.state, z.transferred)
+}
+
+// Resume 恢复暂停的传输：发出暂存的应答，发送方从当前位置继续发送，不会重新开始当前文件
+func (z *ZmodemImpl) Resume() {
+	z.mu.Lock()
+	defer z.unlock()
+	if !z.paused {
+		return
+	}
+	z.traceEvent(TraceResume, nil)
+	z.paused = false
+	z.lastActivity = z.now()
+	z.lastUsed = z.now() // 空闲回收从恢复时开始计时
+	z.retries = 0
+	switch {
+	case z.mode == modeReceive && z.state == StateReceivingData:
+		// 暂停期间的数据都已丢弃，要求对方从当前位置继续
+		z.heldReply = nil
+		z.discarding = true
+		z.sendHeader(BuildZRPOSFrame(uint32(z.transferred)))
+	case z.heldReply != nil:
+		z.outputBuf.Write(z.heldReply)
+		z.heldReply = nil
+	}
+	z.logf(LogInfo, "传输已恢复，状态: %s，位置: %d", z.state, z.transferred)
+}
+
+// Paused 会话是否处于暂停状态
+func (z *ZmodemImpl) Paused() bool {
+	z.mu.Lock()
+	defer z.unlock()
+	return z.paused
+}
+
+// reply 发出让对方继续传输的帧头；暂停时只保留最新的一个，恢复时再发出
+func (z *ZmodemImpl) reply(frame []byte) {
+	if z.paused {
+		z.heldReply = frame
+		return
+	}
+	z.outputBuf.Write(frame)
+}
@@ -0,0 +1,157 @@
+package zmodem
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// pauseFor 在 when 首次成立时暂停 z，经过 d（虚拟时间）后恢复；暂停期间每一步调用 check
+func pauseFor(z *ZmodemImpl, d time.Duration, when func() bool, check func()) func(l *loopback) {
+	var pausedAt time.Time
+	resumed := false
+	return func(l *loopback) {
+		switch {
+		case pausedAt.IsZero():
+			if when() {
+				z.Pause()
+				pausedAt = l.clock
+			}
+		case !resumed:
+			check()
+			if l.clock.Sub(pausedAt) >= d {
+				z.Resume()
+				resumed = true
+			}
+		}
+	}
+}
+
+// TestPauseSender 发送方暂停后不再生成数据，超过对方超时时间的暂停也不会使会话失败，
+// 恢复后从暂停的位置继续，不重新发送已确认的数据
+func TestPauseSender(t *testing.T) {
+	data := testPayload(200000)
+	sink := NewMemorySink()
+	sender := NewSender(memorySources([]loopFile{{"a.bin", data}}), Options{})
+	receiver := NewReceiver(sink, Options{})
+	l := newLoopback(t, sender, receiver)
+	l.toReceiver.latency = 10 * time.Millisecond
+	l.toSender.latency = 10 * time.Millisecond
+
+	var trace bytes.Buffer
+	if err := sender.StartTrace(&trace); err != nil {
+		t.Fatal(err)
+	}
+
+	// 暂停 25 秒：期间接收方每 10 秒以 ZRPOS 要求重传，恢复时没有与数据交错的 ZRPOS（否则会按协议重发交错部分）
+	var pausedPos int64
+	l.onStep = pauseFor(sender, 25*time.Second, func() bool {
+		pausedPos = sender.GetTransferred()
+		return pausedPos > 50000
+	}, func() {
+		if !sender.Paused() || !sender.Stats().Paused {
+			t.Fatal("Paused 应为 true")
+		}
+		if pos := sender.GetTransferred(); pos > pausedPos {
+			t.Fatalf("暂停后仍在发送数据: %d -> %d", pausedPos, pos)
+		}
+	})
+	l.run()
+
+	if sender.GetState() != StateCompleted || receiver.GetState() != StateCompleted {
+		t.Fatalf("状态 = %s (%v) / %s (%v)", sender.GetState(), sender.GetError(), receiver.GetState(), receiver.GetError())
+	}
+	if files := sink.Files(); len(files) != 1 || !bytes.Equal(files[0].Data, data) {
+		t.Fatal("接收到的文件与原文件不一致")
+	}
+	if sent := sender.Stats().Bytes; sent-int64(len(data)) > 8*subpacketSize {
+		t.Errorf("发送了 %d 字节，文件 %d 字节：恢复后不应重新开始", sent, len(data))
+	}
+
+	// 暂停和恢复记录在协议记录中，回放结果一致
+	rec, err := ReadTrace(&trace)
+	if err != nil {
+		t.Fatalf("读取记录失败: %v", err)
+	}
+	result, err := rec.Replay(ReplayConfig{Sources: memorySources([]loopFile{{"a.bin", data}})})
+	if err != nil || result.Diff != nil {
+		t.Fatalf("回放不一致: %v %+v", err, result.Diff)
+	}
+}
+
+// TestPauseReceiver 接收方在文件中途暂停：以 ZRPOS 让流式发送的对方回到当前位置并等待确认，
+// 暂停期间位置不再前进，发送方停在文件中途、不会发出 ZEOF；恢复后从暂停的位置继续，批量传输完成
+func TestPauseReceiver(t *testing.T) {
+	files := []loopFile{{"a.bin", testPayload(50000)}, {"b.bin", testPayload(20000)}}
+	sink := NewMemorySink()
+	sender := NewSender(memorySources(files), Options{})
+	receiver := NewReceiver(sink, Options{})
+	// 没有延迟，数据逐块投递，接收方可以在第一个文件中途暂停
+	l := newLoopback(t, sender, receiver)
+
+	var (
+		pausedPos  int64
+		pausedSent int64 // 暂停时已发出的字节数
+		sentPaused int64 // 暂停期间发出的字节数
+		checked    bool
+	)
+	l.onStep = pauseFor(receiver, 30*time.Second, func() bool {
+		pausedPos = receiver.GetTransferred()
+		pausedSent = l.toReceiver.offset
+		return pausedPos > 10000
+	}, func() {
+		checked = true
+		sentPaused = l.toReceiver.offset - pausedSent
+		if pos := receiver.GetTransferred(); pos != pausedPos {
+			t.Fatalf("暂停后位置仍在前进: %d -> %d", pausedPos, pos)
+		}
+		if state := sender.GetState(); state != StateSendingData || len(sender.Results()) != 1 {
+			t.Fatalf("接收方暂停期间发送方状态 = %s，第 %d 个文件，应停在第一个文件中途", state, len(sender.Results()))
+		}
+	})
+	l.run()
+
+	if !checked || pausedPos >= int64(len(files[0].data)) {
+		t.Fatalf("没有在文件中途暂停: 位置 %d", pausedPos)
+	}
+	// 暂停期间发送方只发出暂停前已生成的一块数据（4096 字节）和每 10 秒超时重发的一个子包，
+	// 而不是继续发完第一个文件剩余的约 36000 字节
+	if sentPaused > 12*subpacketSize {
+		t.Errorf("暂停期间发送方仍在发送: 发出了 %d 字节", sentPaused)
+	}
+	if sender.GetState() != StateCompleted || receiver.GetState() != StateCompleted {
+		t.Fatalf("状态 = %s (%v) / %s (%v)", sender.GetState(), sender.GetError(), receiver.GetState(), receiver.GetError())
+	}
+	got := sink.Files()
+	if len(got) != 2 || !bytes.Equal(got[0].Data, files[0].data) || !bytes.Equal(got[1].Data, files[1].data) {
+		t.Fatal("接收到的文件与原文件不一致")
+	}
+}
+
+// TestPauseIdempotent 重复暂停、未暂停时恢复以及会话结束后暂停都不产生输出
+func TestPauseIdempotent(t *testing.T) {
+	z := newIdleEngine(modeReceive)
+	z.Resume()
+	z.Pause()
+	z.Pause()
+	if out := drain(z); len(out) != 0 {
+		t.Fatalf("暂停时不应有输出: %q", out)
+	}
+	// 暂停期间的多个应答只保留最新的一个
+	z.FeedData(BuildZRQINITFrame())
+	z.FeedData(BuildZRQINITFrame())
+	if out := drain(z); len(out) != 0 {
+		t.Fatalf("暂停时不应发出 ZRINIT: %q", out)
+	}
+	z.Resume()
+	if out := drain(z); !bytes.Equal(out, BuildZRINITFrame(z.zrinitCaps())) {
+		t.Fatalf("恢复后应发出一个 ZRINIT: %q", out)
+	}
+
+	z.Abort(ErrCancelled)
+	drain(z)
+	z.Pause()
+	if z.Paused() {
+		t.Error("会话结束后不应进入暂停状态")
+	}
+}
@@ -0,0 +1,95 @@
+package zmodem
+
+import (
+	"bytes"
+	"testing"
+)
+
+// processAll 以 Process 输入 input，并以空输入反复调用直到 more 为 false，返回全部输出和调用次数
+func processAll(t *testing.T, z *ZmodemImpl, input []byte, outCap int) ([]byte, int) {
+	t.Helper()
+	out := make([]byte, outCap)
+	var all []byte
+	calls := 0
+	for {
+		n, more, err := z.Process(input, out)
+		if err != nil {
+			t.Fatalf("Process 失败: %v", err)
+		}
+		if n > outCap {
+			t.Fatalf("输出 %d 字节，超过缓冲区容量 %d", n, outCap)
+		}
+		all = append(all, out[:n]...)
+		input = nil
+		calls++
+		if !more {
+			return all, calls
+		}
+		if calls > 10000 {
+			t.Fatal("more 始终为 true")
+		}
+	}
+}
+
+// TestProcessMatchesFeedAndGet Process 与 FeedData + 循环 GetOutputData 产生相同的输出，
+// 输入总是被全部消费，缓冲区放不下的输出留到下一次调用
+func TestProcessMatchesFeedAndGet(t *testing.T) {
+	data := testPayload(5000)
+	info := encodeFileInfo(FileInfo{Name: "a.bin", Size: int64(len(data))}, nameCodec{}, 0, 0)
+	chunks := [][]byte{
+		BuildZRQINITFrame(),
+		BuildZFILEFrame(info, 0, 0, true, false),
+		append(BuildZDATAHeader(0, true, false), BuildDataSubpacket(data, ZCRCE, true, false)...),
+		BuildZEOFFrame(uint32(len(data)), true, false),
+		append(BuildZFINFrame(), "OO"...),
+	}
+
+	for _, outCap := range []int{1, 7, 64, 4096} {
+		want := NewReceiver(NewMemorySink(), Options{})
+		got := NewReceiver(NewMemorySink(), Options{})
+		wantOut := drain(want)
+		gotOut, _ := processAll(t, got, nil, outCap)
+		for _, chunk := range chunks {
+			want.FeedData(chunk)
+			wantOut = append(wantOut, drain(want)...)
+			out, _ := processAll(t, got, chunk, outCap)
+			gotOut = append(gotOut, out...)
+		}
+
+		if !bytes.Equal(gotOut, wantOut) {
+			t.Fatalf("outCap=%d: Process 输出与 FeedData/GetOutputData 不一致:\n%q\n%q", outCap, gotOut, wantOut)
+		}
+		if state := got.GetState(); state != StateCompleted {
+			t.Fatalf("outCap=%d: 状态 = %s，期望 completed", outCap, state)
+		}
+	}
+}
+
+// TestProcessMore more 表示还有输出没有取完：缓冲区太小，或发送方还能继续生成数据；
+// 等待对方响应时 more 为 false
+func TestProcessMore(t *testing.T) {
+	z := NewSender([]FileSource{NewMemorySource(FileInfo{Name: "a.bin"}, testPayload(100000))}, Options{})
+
+	// 缓冲区为 0 时只报告是否有待取出的输出
+	n, more, _ := z.Process(nil, nil)
+	if n != 0 || !more {
+		t.Fatalf("空缓冲区: n=%d more=%v，期望 n=0 more=true", n, more)
+	}
+	if out, _ := processAll(t, z, nil, 4096); len(out) == 0 {
+		t.Fatal("没有发出 ZRQINIT")
+	}
+	if n, more, _ = z.Process(nil, make([]byte, 4096)); n != 0 || more {
+		t.Fatalf("等待 ZRINIT 时: n=%d more=%v，期望没有输出", n, more)
+	}
+
+	processAll(t, z, BuildZRINITFrame(CANFDX|CANOVIO|CANFC32), 4096) // 发出 ZFILE
+
+	// 流式发送整个文件：每次调用都填满缓冲区，直到文件发完、等待 ZEOF 的确认
+	out, calls := processAll(t, z, BuildZRPOSFrame(0), 4096)
+	if len(out) < 100000 || calls < 100000/4096 {
+		t.Fatalf("只输出了 %d 字节（%d 次调用），期望发送整个文件", len(out), calls)
+	}
+	if state := z.GetState(); state != StateSendingEOF {
+		t.Fatalf("状态 = %s，期望 sending_eof", state)
+	}
+}
@@ -0,0 +1,30 @@
+package zmodem
+
+import "testing"
+
+func TestIsZmodemSequence(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		wantOK     bool
+		wantUpload bool
+	}{
+		{"sz ZRQINIT", BuildZRQINITFrame(), true, false},
+		{"rz ZRINIT", BuildZRINITFrame(CANFDX | CANOVIO | CANFC32), true, true},
+		{"lrzsz rz", []byte("**\x18B0100000023be50\r\x8a\x11"), true, true},
+		{"single ZPAD sz", []byte("*\x18B00"), true, false},
+		{"single ZPAD rz", []byte("*\x18B01"), true, true},
+		{"without ZDLE", []byte("**B00000000000000"), true, false},
+		{"type 0x10", []byte("**\x18B10"), false, false},
+		{"shell output", []byte("ls -l\r\n"), false, false},
+		{"short", []byte("**"), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, upload := IsZmodemSequence(tt.data)
+			if ok != tt.wantOK || upload != tt.wantUpload {
+				t.Fatalf("IsZmodemSequence(%q) = %v, %v，期望 %v, %v", tt.data, ok, upload, tt.wantOK, tt.wantUpload)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package zmodem
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// minRateLimit 限速的下限（字节/秒），更低的值按下限处理，
+	// 避免两个数据子包之间的间隔超过对方的超时时间
+	minRateLimit = 1024
+	// rateBurst 限速器最多积累的额度（按时间计），决定限速时单次可以连续发送的数据量
+	rateBurst = 100 * time.Millisecond
+	// rateSlack 额度判断允许的时间误差（协议记录的时间精度），保证回放时在相同的位置发送
+	rateSlack = time.Microsecond
+)
+
+// RateLimiter 令牌桶限速器，可以由多个会话共享（见 SetGlobalRateLimit）
+//
+// 只限制文件数据，不计帧头和转义带来的开销。额度可以透支：
+// 额度不为负时即可发送一个数据子包，透支的部分由之后的等待补足，平均速度不超过限制。
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   int64     // 字节/秒，0 表示不限速
+	tokens float64   // 当前额度（字节），可为负
+	last   time.Time // 最近一次补充额度的时间
+}
+
+// NewRateLimiter 创建限速为 bytesPerSec 字节/秒的限速器，0 表示不限速
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetRate(bytesPerSec)
+	return l
+}
+
+// SetRate 修改限速，传输过程中修改立即生效；不大于 0 表示不限速，低于 1024 字节/秒按 1024 处理
+func (l *RateLimiter) SetRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case bytesPerSec <= 0:
+		bytesPerSec = 0
+	case bytesPerSec < minRateLimit:
+		bytesPerSec = minRateLimit
+	}
+	l.rate = bytesPerSec
+	// 修改后额度重新从满额开始积累，不受之前透支的影响
+	l.tokens = l.burst()
+	l.last = time.Time{}
+}
+
+// Rate 当前限速（字节/秒），0 表示不限速
+func (l *RateLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// burst 额度上限（调用方持有 l.mu）
+func (l *RateLimiter) burst() float64 {
+	return max(float64(l.rate)*rateBurst.Seconds(), float64(l.chunk()))
+}
+
+// chunk 限速时每个数据子包的长度，使限速较低时数据仍能以较短的间隔持续到达（调用方持有 l.mu）
+func (l *RateLimiter) chunk() int {
+	return int(min(int64(float64(l.rate)*rateBurst.Seconds()), subpacketSize))
+}
+
+// refill 按经过的时间补充额度（调用方持有 l.mu）
+// 共享的限速器可能被使用不同时钟的会话调用，时间倒退时不补充
+func (l *RateLimiter) refill(now time.Time) {
+	if l.last.IsZero() {
+		l.last = now
+		return
+	}
+	if dt := now.Sub(l.last); dt > 0 {
+		l.tokens = min(l.tokens+dt.Seconds()*float64(l.rate), l.burst())
+		l.last = now
+	}
+}
+
+// delay 距离可以发送下一个数据子包还需等待的时间，0 表示现在即可发送
+func (l *RateLimiter) delay(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate == 0 {
+		return 0
+	}
+	l.refill(now)
+	if l.tokens >= -float64(l.rate)*rateSlack.Seconds() {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+}
+
+// take 扣除发送 n 字节文件数据的额度
+func (l *RateLimiter) take(now time.Time, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate == 0 {
+		return
+	}
+	l.refill(now)
+	l.tokens -= float64(n)
+}
+
+// maxChunk 限速时数据子包的最大长度，不限速时为 0
+func (l *RateLimiter) maxChunk() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate == 0 {
+		return 0
+	}
+	return l.chunk()
+}
+
+// SetRateLimit 修改本会话的限速（字节/秒），传输过程中修改立即生效，0 表示不限速
+// 只对发送方生效：在生成数据子包时限制文件数据的速度，接收方不受影响
+func (z *ZmodemImpl) SetRateLimit(bytesPerSec int64) {
+	z.mu.Lock()
+	defer z.unlock()
+	z.limiter.SetRate(bytesPerSec)
+	z.opts.RateLimit = z.limiter.Rate()
+	z.traceData(TraceRateLimit, 0, strconv.AppendInt(nil, z.opts.RateLimit, 10))
+}
+
+// RateLimit 本会话的限速（字节/秒），0 表示不限速
+func (z *ZmodemImpl) RateLimit() int64 {
+	z.mu.Lock()
+	defer z.unlock()
+	return z.limiter.Rate()
+}
+
+// SetSharedLimiter 设置与其他会话共享的限速器，nil 表示只受本会话的限速
+// 共享限速器的效果取决于其他会话，协议记录回放时不会重现
+func (z *ZmodemImpl) SetSharedLimiter(l *RateLimiter) {
+	z.mu.Lock()
+	defer z.unlock()
+	z.shared = l
+}
+
+// limiters 本会话生效的限速器（调用方持有 z.mu）
+func (z *ZmodemImpl) limiters() []*RateLimiter {
+	if z.shared == nil {
+		return []*RateLimiter{z.limiter}
+	}
+	return []*RateLimiter{z.limiter, z.shared}
+}
+
+// throttleDelay 发送方因限速还需等待的时间，0 表示可以生成下一个数据子包（调用方持有 z.mu）
+func (z *ZmodemImpl) throttleDelay(now time.Time) time.Duration {
+	var d time.Duration
+	for _, l := range z.limiters() {
+		d = max(d, l.delay(now))
+	}
+	return d
+}
+
+// throttleChunk 限速时数据子包的最大长度，不限速时为 0（调用方持有 z.mu）
+func (z *ZmodemImpl) throttleChunk() int {
+	n := 0
+	for _, l := range z.limiters() {
+		if c := l.maxChunk(); c > 0 && (n == 0 || c < n) {
+			n = c
+		}
+	}
+	return n
+}
+
+// throttleTake 扣除已发送的 n 字节文件数据的额度（调用方持有 z.mu）
+func (z *ZmodemImpl) throttleTake(now time.Time, n int) {
+	for _, l := range z.limiters() {
+		l.take(now, n)
+	}
+}
@@ -0,0 +1,158 @@
+package zmodem
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// TestRateLimiter 额度可以透支，平均速度不超过限制；最多积累 100ms 的额度，共享的限速器按合计的数据量限速
+func TestRateLimiter(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(10000)
+	if l.maxChunk() != 1000 {
+		t.Fatalf("数据子包长度 = %d，期望 1000", l.maxChunk())
+	}
+	if d := l.delay(t0); d != 0 {
+		t.Fatalf("开始时应有额度，等待 %v", d)
+	}
+	// 两个会话共享：各发送 1000 字节后透支 1000 字节，需要等待 100ms
+	l.take(t0, 1000)
+	if d := l.delay(t0); d != 0 {
+		t.Fatalf("额度为 0 时应可以发送，等待 %v", d)
+	}
+	l.take(t0, 1000)
+	if d := l.delay(t0); d != 100*time.Millisecond {
+		t.Fatalf("透支 1000 字节后等待 %v，期望 100ms", d)
+	}
+	if d := l.delay(t0.Add(100 * time.Millisecond)); d != 0 {
+		t.Fatalf("等待后仍不能发送: %v", d)
+	}
+
+	// 长时间空闲后最多积累 100ms 的额度
+	l.take(t0.Add(10*time.Second), 1000)
+	l.take(t0.Add(10*time.Second), 1000)
+	if d := l.delay(t0.Add(10 * time.Second)); d != 100*time.Millisecond {
+		t.Errorf("空闲后透支 1000 字节需要等待 %v，期望 100ms", d)
+	}
+
+	// 低于下限的限速按下限处理，0 表示不限速
+	l.SetRate(1)
+	if l.Rate() != minRateLimit || l.maxChunk() != 102 {
+		t.Errorf("限速 = %d，数据子包长度 = %d，期望 %d、102", l.Rate(), l.maxChunk(), minRateLimit)
+	}
+	l.SetRate(0)
+	l.take(t0, 1<<20)
+	if d := l.delay(t0); d != 0 || l.maxChunk() != 0 {
+		t.Errorf("不限速时等待 %v，数据子包长度 %d", d, l.maxChunk())
+	}
+}
+
+// TestRateLimitSender 限速的上传按限制的速度完成，数据子包缩短为约 100ms 的数据量
+func TestRateLimitSender(t *testing.T) {
+	data := testPayload(100000)
+	sink := NewMemorySink()
+	sender := NewSender(memorySources([]loopFile{{"a.bin", data}}), Options{RateLimit: 10000})
+	receiver := NewReceiver(sink, Options{})
+	l := newLoopback(t, sender, receiver)
+	start := l.clock
+	l.run()
+
+	if sender.GetState() != StateCompleted || receiver.GetState() != StateCompleted {
+		t.Fatalf("状态 = %s (%v) / %s (%v)", sender.GetState(), sender.GetError(), receiver.GetState(), receiver.GetError())
+	}
+	if files := sink.Files(); len(files) != 1 || !bytes.Equal(files[0].Data, data) {
+		t.Fatal("接收到的文件与原文件不一致")
+	}
+	// 开始时的额度和最后一个数据子包不需要等待，其余每 10000 字节需要 1 秒
+	if elapsed := l.clock.Sub(start); elapsed < 9500*time.Millisecond || elapsed > 11*time.Second {
+		t.Errorf("传输用时 %v，期望约 10 秒", elapsed)
+	}
+	stats := sender.Stats()
+	if stats.BlockSize != 1000 || stats.RateLimit != 10000 {
+		t.Errorf("数据子包 %d 字节，限速 %d，期望 1000、10000", stats.BlockSize, stats.RateLimit)
+	}
+}
+
+// TestRateLimitChange 传输中修改限速立即生效，修改写入协议记录，回放结果一致
+func TestRateLimitChange(t *testing.T) {
+	data := testPayload(200000)
+	sender := NewSender(memorySources([]loopFile{{"a.bin", data}}), Options{RateLimit: 5000})
+	receiver := NewReceiver(NewMemorySink(), Options{})
+	l := newLoopback(t, sender, receiver)
+	l.toReceiver.latency = 10 * time.Millisecond
+	l.toSender.latency = 10 * time.Millisecond
+
+	var trace bytes.Buffer
+	if err := sender.StartTrace(&trace); err != nil {
+		t.Fatal(err)
+	}
+
+	start := l.clock
+	var changedAt time.Time
+	l.onStep = func(l *loopback) {
+		if changedAt.IsZero() && sender.GetTransferred() >= 20000 {
+			sender.SetRateLimit(0)
+			changedAt = l.clock
+		}
+	}
+	l.run()
+
+	if sender.GetState() != StateCompleted || receiver.GetState() != StateCompleted {
+		t.Fatalf("状态 = %s (%v) / %s (%v)", sender.GetState(), sender.GetError(), receiver.GetState(), receiver.GetError())
+	}
+	if before := changedAt.Sub(start); before < 3500*time.Millisecond {
+		t.Errorf("以 5000 字节/秒发送 20000 字节只用了 %v", before)
+	}
+	if after := l.clock.Sub(changedAt); after > time.Second {
+		t.Errorf("取消限速后剩余数据用了 %v", after)
+	}
+	if sender.RateLimit() != 0 {
+		t.Errorf("限速 = %d，期望 0", sender.RateLimit())
+	}
+
+	rec, err := ReadTrace(&trace)
+	if err != nil {
+		t.Fatalf("读取记录失败: %v", err)
+	}
+	if rec.Options.RateLimit != 5000 {
+		t.Errorf("记录的选项中限速 = %d，期望 5000", rec.Options.RateLimit)
+	}
+	result, err := rec.Replay(ReplayConfig{Sources: memorySources([]loopFile{{"a.bin", data}})})
+	if err != nil || result.Diff != nil {
+		t.Fatalf("回放不一致: %v %+v", err, result.Diff)
+	}
+}
+
+// TestRateLimitShared 共享的限速器与会话自己的限速同时生效，以较低的为准；新会话使用全局限速器
+func TestRateLimitShared(t *testing.T) {
+	data := testPayload(50000)
+	sender := NewSender(memorySources([]loopFile{{"a.bin", data}}), Options{RateLimit: 100000})
+	sender.SetSharedLimiter(NewRateLimiter(5000))
+	receiver := NewReceiver(NewMemorySink(), Options{})
+	l := newLoopback(t, sender, receiver)
+	start := l.clock
+	l.run()
+
+	if sender.GetState() != StateCompleted || receiver.GetState() != StateCompleted {
+		t.Fatalf("状态 = %s (%v) / %s (%v)", sender.GetState(), sender.GetError(), receiver.GetState(), receiver.GetError())
+	}
+	if elapsed := l.clock.Sub(start); elapsed < 9*time.Second {
+		t.Errorf("传输用时 %v，期望按共享限速约 10 秒", elapsed)
+	}
+
+	impl := NewSender(memorySources([]loopFile{{"b.bin", data}}), Options{})
+	session, err := NewSession(modeSend, "b.bin", impl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveSession(session.ID)
+	SetGlobalRateLimit(20000)
+	defer SetGlobalRateLimit(0)
+	impl.mu.Lock()
+	shared := impl.shared
+	impl.mu.Unlock()
+	if shared == nil || shared.Rate() != 20000 || GlobalRateLimit() != 20000 {
+		t.Error("新会话没有使用全局限速器")
+	}
+}
@@ -0,0 +1,298 @@
+package zmodem
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// receiverCaps 接收方在 ZRINIT 中声明的能力：全双工、边收边写、32 位 CRC（与 lrzsz rz 一致）
+const receiverCaps = CANFDX | CANOVIO | CANFC32
+
+// receiver 接收方状态
+type receiver struct {
+	sink       Sink       // 为每个文件创建写入目标
+	writer     FileWriter // 当前文件的写入目标
+	discarding bool       // 已要求重传，丢弃数据直到位置正确的 ZDATA 帧头
+}
+
+// NewReceiver 创建接收文件的引擎
+// 引擎会发送 ZRINIT，之后每收到一个 ZFILE 都通过 sink 创建写入目标
+func NewReceiver(sink Sink, opts Options) *ZmodemImpl {
+	z := newImpl(modeReceive, opts)
+	z.mu.Lock()
+	defer z.unlock()
+	z.sink = sink
+	z.emit(Event{Type: EventSessionStart, Direction: "receive"})
+	z.setState(StateReceivingHeader, "waiting for sender")
+	z.sendHeader(BuildZRINITFrame(z.zrinitCaps()))
+	return z
+}
+
+// zrinitCaps 本端在 ZRINIT 中声明的能力，EscapeControl 时要求发送方转义所有控制字符
+func (z *ZmodemImpl) zrinitCaps() uint8 {
+	if z.opts.EscapeControl {
+		return receiverCaps | ESCCTL
+	}
+	return receiverCaps
+}
+
+// closeReceiver 放弃未完成的文件，并关闭 Sink 持有的资源
+func (z *ZmodemImpl) closeReceiver() error {
+	firstErr := z.abortFile()
+	if c, ok := z.sink.(io.Closer); ok {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// handleReceiverFrame 接收方处理发送方发来的帧
+func (z *ZmodemImpl) handleReceiverFrame(frame *ZmodemFrame) {
+	switch frame.Type {
+	case FrameZRQINIT:
+		// 发送方（重新）请求初始化
+		if z.state == StateReceivingHeader {
+			z.sendHeader(BuildZRINITFrame(z.zrinitCaps()))
+		}
+
+	case FrameZSINIT:
+		// 发送方初始化（携带 Attn 序列，这里不使用），以 ZACK 确认
+		z.reply(BuildZACKFrame(1))
+
+	case FrameZFILE:
+		switch z.state {
+		case StateReceivingHeader:
+			z.openFile(frame)
+		case StateReceivingData:
+			// 发送方没有收到我们的 ZRPOS，重发 ZFILE
+			z.sendHeader(BuildZRPOSFrame(uint32(z.transferred)))
+		}
+
+	case FrameZDATA:
+		if z.state != StateReceivingData {
+			return // 已跳过的文件或过期的数据，忽略
+		}
+		if frame.Subpacket {
+			z.writeSubpacket(frame)
+			return
+		}
+		if int64(frame.Position()) != z.transferred {
+			// 位置不一致（之前的数据丢失），要求从当前位置重传
+			z.requestRetransmit(fmt.Sprintf("unexpected ZDATA offset %d", frame.Position()))
+			return
+		}
+		if !z.paused {
+			z.discarding = false // 暂停期间丢弃所有数据，恢复时再要求重传
+		}
+
+	case FrameZEOF:
+		if z.state != StateReceivingData {
+			return
+		}
+		// 位置不一致的 ZEOF 可能是在我们发出 ZRPOS 之前发出的，忽略，等待重传
+		if int64(frame.Position()) != z.transferred {
+			z.logf(LogDebug, "忽略位置不一致的 ZEOF: %d, 当前位置: %d", frame.Position(), z.transferred)
+			return
+		}
+		z.finishFile()
+
+	case FrameZFIN:
+		// 发送方结束会话，回 ZFIN 并等待 "OO"；未收完的文件不提交，记为失败
+		if r := z.currentResult(); r != nil && !fileDone(*r) {
+			r.Err = fmt.Errorf("%w: 文件传输完成前收到 ZFIN", ErrPeerCancelled)
+			z.emitFile(EventFileFailed, r.Err.Error())
+		}
+		z.abortFile()
+		z.answerFin()
+
+	case FrameZFREECNT:
+		// 发送方查询剩余空间
+		z.replyFreeSpace()
+
+	case FrameZABORT, FrameZFERR:
+		z.fail(fmt.Errorf("%w: 收到 %s", ErrPeerCancelled, frame.Type))
+	}
+}
+
+// openFile 处理 ZFILE：创建写入目标并以 ZRPOS 要求发送方从头（或续传位置）开始发送数据
+func (z *ZmodemImpl) openFile(frame *ZmodemFrame) {
+	info := decodeFileInfo(frame.Data, z.names)
+	info.Clobber = frame.F1&ZMMASK == ZMCLOB
+	z.filename = info.Name
+	z.fileSize = info.Size
+	z.transferred = 0
+	z.discarding = false
+	z.digest = newFileDigest(z.opts.MD5)
+	z.results = append(z.results, FileResult{Name: info.Name, Size: info.Size})
+	z.emitOffered(info)
+
+	writer, err := z.sink.Create(info)
+	if errors.Is(err, ErrSkipFile) {
+		z.logf(LogInfo, "跳过文件: %s (%v)", info.Name, err)
+		result := z.currentResult()
+		result.Skipped = true
+		if err != ErrSkipFile {
+			result.Err = err // 记录跳过的原因，如 ErrUnsafePath
+		}
+		reason := ""
+		if result.Err != nil {
+			reason = result.Err.Error()
+		}
+		z.emitFile(EventFileSkipped, reason)
+		z.sendHeader(BuildZSKIPFrame())
+		return
+	}
+	if err != nil {
+		z.fail(err)
+		return
+	}
+
+	// 续传：从已有数据之后开始接收
+	if r, ok := writer.(resumer); ok {
+		if off := r.ResumeOffset(); off > 0 {
+			z.transferred = off
+			z.currentResult().Transferred = off
+			// 已有数据也要计入摘要，无法读回时摘要不可用
+			if ra, ok := writer.(io.ReaderAt); ok {
+				z.digest.fill(ra, off)
+			} else {
+				z.digest.broken = true
+			}
+		}
+	}
+
+	z.writer = writer
+	z.setState(StateReceivingData, "receiving "+info.Name)
+	z.sendHeader(BuildZRPOSFrame(uint32(z.transferred)))
+}
+
+// writeSubpacket 将 ZDATA 的数据子包写入当前文件
+func (z *ZmodemImpl) writeSubpacket(frame *ZmodemFrame) {
+	if z.discarding {
+		return
+	}
+	if len(frame.Data) > 0 {
+		if _, err := z.writer.WriteAt(frame.Data, z.transferred); err != nil {
+			z.fail(fmt.Errorf("写入文件失败: %w", err))
+			return
+		}
+		z.digest.add(frame.Data, z.transferred)
+		z.transferred += int64(len(frame.Data))
+		z.currentResult().Transferred = z.transferred
+		z.stats.addData(z.now(), len(frame.Data))
+		z.emitFile(EventFileProgress, "")
+	}
+	// ZCRCQ/ZCRCW 要求确认当前位置
+	if frame.End == ZCRCQ || frame.End == ZCRCW {
+		z.reply(BuildZACKFrame(uint32(z.transferred)))
+	}
+}
+
+// requestRetransmit 要求发送方从当前位置重传，并丢弃之后的数据子包直到位置正确的 ZDATA
+// reason 为重传原因（英文短语），用于 retry 事件
+func (z *ZmodemImpl) requestRetransmit(reason string) {
+	z.parser.CleanupBuffer()
+	if z.discarding {
+		return // 已经发出过 ZRPOS，等待发送方响应（超时后会重发）
+	}
+	z.discarding = true
+	z.sendHeader(BuildZRPOSFrame(uint32(z.transferred)))
+	z.setState(StateReceivingData, fmt.Sprintf("retrying at offset %d", z.transferred))
+	z.retry(reason)
+}
+
+// finishFile 当前文件接收完成，提交写入目标后以 ZRINIT 表示可以接收下一个文件
+// 收到的字节数与 ZFILE 声明的大小不一致时不提交（声明为 0 时视为大小未知）
+func (z *ZmodemImpl) finishFile() {
+	if z.fileSize > 0 && z.transferred != z.fileSize {
+		z.fail(fmt.Errorf("%w: 文件大小不一致，声明 %d 字节，实际收到 %d 字节", ErrProtocol, z.fileSize, z.transferred))
+		return
+	}
+	writer := z.writer
+	z.writer = nil
+	if err := writer.Commit(); err != nil {
+		z.fail(fmt.Errorf("提交文件失败: %w", err))
+		return
+	}
+	z.currentResult().Completed = true
+	z.recordDigest()
+	z.emitFile(EventFileComplete, "")
+	z.setState(StateReceivingHeader, "file received, waiting for next file")
+	z.sendHeader(BuildZRINITFrame(z.zrinitCaps()))
+}
+
+// abortFile 放弃当前未完成的文件
+func (z *ZmodemImpl) abortFile() error {
+	if z.writer == nil {
+		return nil
+	}
+	err := z.writer.Abort()
+	z.writer = nil
+	return err
+}
+
+// retryReceive 接收方等待响应超时后的重试
+func (z *ZmodemImpl) retryReceive() {
+	if z.state == StateReceivingData {
+		// 数据中断，要求发送方从当前位置继续
+		z.discarding = true
+		z.parser.CleanupBuffer()
+		z.sendHeader(BuildZRPOSFrame(uint32(z.transferred)))
+		return
+	}
+	if z.lastHeader != nil {
+		z.outputBuf.Write(z.lastHeader)
+	}
+}
+
+// replyFreeSpace 响应 ZFREECNT：以 ZACK 返回本地接收目录的剩余空间
+// 位置字段只有 32 位，超出部分（或无法获取时）按 0xFFFFFFFF（不限）上报
+func (z *ZmodemImpl) replyFreeSpace() {
+	free := uint64(0xFFFFFFFF)
+	if fs, ok := z.sink.(freeSpacer); ok {
+		n, err := fs.FreeSpace()
+		if err != nil {
+			z.logf(LogWarn, "获取剩余空间失败: %v", err)
+		} else if n < free {
+			free = n
+		}
+	}
+	z.outputBuf.Write(BuildZACKFrame(uint32(free)))
+	z.logf(LogDebug, "响应 ZFREECNT，剩余空间: %d", free)
+}
+
+// decodeFileInfo 解析 ZFILE 数据子包：文件名\0大小 修改时间(八进制) 权限(八进制) ...\0
+// 文件名按会话的远端字符集转换为 UTF-8；之后的字段都是可选的，缺失或无法解析时保持零值
+func decodeFileInfo(data []byte, names nameCodec) FileInfo {
+	var info FileInfo
+	name, rest, _ := bytes.Cut(data, []byte{0})
+	info.Name = names.decode(name)
+	if i := bytes.IndexByte(rest, 0); i >= 0 {
+		rest = rest[:i]
+	}
+
+	fields := strings.Fields(string(rest))
+	if len(fields) > 0 {
+		if size, err := strconv.ParseInt(fields[0], 10, 64); err == nil && size >= 0 {
+			info.Size = size
+		}
+	}
+	if len(fields) > 1 {
+		if mtime, err := strconv.ParseInt(fields[1], 8, 64); err == nil && mtime > 0 {
+			info.ModTime = time.Unix(mtime, 0)
+		}
+	}
+	if len(fields) > 2 {
+		if mode, err := strconv.ParseUint(fields[2], 8, 32); err == nil {
+			info.Mode = os.FileMode(mode).Perm()
+		}
+	}
+	return info
+}
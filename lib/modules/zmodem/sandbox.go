@@ -0,0 +1,138 @@
+package zmodem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CollisionPolicy 接收的文件与已有文件同名时的处理方式
+type CollisionPolicy int
+
+const (
+	CollisionRename    CollisionPolicy = iota // 添加序号另存（默认）
+	CollisionOverwrite                        // 完整收到后覆盖已有文件
+	CollisionSkip                             // 跳过该文件（回复 ZSKIP）
+	CollisionResume                           // 从保留的 .part 文件续传，已有完整文件时跳过
+)
+
+var collisionPolicyNames = map[CollisionPolicy]string{
+	CollisionRename:    "rename",
+	CollisionOverwrite: "overwrite",
+	CollisionSkip:      "skip",
+	CollisionResume:    "resume",
+}
+
+// String 返回策略名称
+func (p CollisionPolicy) String() string {
+	if name, ok := collisionPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("collision(%d)", int(p))
+}
+
+// UnmarshalText 从 "rename"/"overwrite"/"skip"/"resume" 解析策略（用于 JSON 会话选项）
+func (p *CollisionPolicy) UnmarshalText(text []byte) error {
+	for policy, name := range collisionPolicyNames {
+		if name == string(text) {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("未知的同名文件策略: %q", text)
+}
+
+// MarshalText 输出策略名称
+func (p CollisionPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// reservedDeviceNames Windows 保留的设备名，无论扩展名是什么都不能作为文件名
+var reservedDeviceNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// isDeviceName 判断路径组件是否为设备名（如 "CON"、"nul.txt"、"COM1 "）
+func isDeviceName(component string) bool {
+	base := component
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	base = strings.TrimRight(base, " ")
+	return reservedDeviceNames[strings.ToUpper(base)]
+}
+
+// resolveInRoot 将对方提供的文件名解析为 root 下的路径
+//
+// 文件名可以包含相对子目录（"/" 或 "\" 分隔），但以下情况会被拒绝（返回 ErrUnsafePath）：
+// 绝对路径或盘符、".." 组件、设备名，以及经由符号链接指向 root 之外的目录或文件。
+// 每个组件都会经过 sanitizeFilename 清理。需要的子目录会被创建。
+func resolveInRoot(root, name string) (string, error) {
+	if name == "" || strings.IndexByte(name, 0) >= 0 {
+		return "", fmt.Errorf("%w: 文件名为空或包含 NUL", ErrUnsafePath)
+	}
+	normalized := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(normalized, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" ||
+		(len(normalized) >= 2 && normalized[1] == ':') {
+		return "", fmt.Errorf("%w: 不允许绝对路径 %q", ErrUnsafePath, name)
+	}
+
+	var parts []string
+	for _, part := range strings.Split(normalized, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("%w: 不允许 \"..\" %q", ErrUnsafePath, name)
+		}
+		if isDeviceName(part) {
+			return "", fmt.Errorf("%w: 不允许设备名 %q", ErrUnsafePath, name)
+		}
+		parts = append(parts, sanitizeFilename(part))
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("%w: 文件名无效 %q", ErrUnsafePath, name)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("解析接收目录失败: %w", err)
+	}
+
+	// 逐级检查已有的子目录，拒绝符号链接，避免 MkdirAll 跟随链接在 root 之外创建目录
+	dir := root
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		fi, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(dir, 0755); err != nil {
+				return "", fmt.Errorf("创建目录失败: %w", err)
+			}
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("检查目录失败: %w", err)
+		}
+		if fi.Mode()&os.ModeSymlink != 0 || !fi.IsDir() {
+			return "", fmt.Errorf("%w: %q 不是普通目录", ErrUnsafePath, dir)
+		}
+	}
+
+	target := filepath.Join(dir, parts[len(parts)-1])
+	if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("%w: 目标 %q 是符号链接", ErrUnsafePath, target)
+	}
+
+	// 最后再确认实际目录仍在 root 之内（防止检查期间被替换）
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("解析目录失败: %w", err)
+	}
+	if rel, err := filepath.Rel(realRoot, realDir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %q 位于接收目录之外", ErrUnsafePath, name)
+	}
+	return target, nil
+}
@@ -0,0 +1,289 @@
+package zmodem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveInRootRejectsTraversal(t *testing.T) {
+	root := t.TempDir()
+	names := []string{
+		"",
+		"../../.bashrc",
+		"..",
+		"a/../../b",
+		"sub/../../escape",
+		`..\..\windows\system.ini`,
+		"/etc/passwd",
+		`\\server\share\x`,
+		`C:\Windows\win.ini`,
+		"c:relative.txt",
+		"CON",
+		"nul.txt",
+		"sub/COM1.log",
+		"lpt9 ",
+		"a\x00b",
+		"./",
+	}
+	for _, name := range names {
+		if _, err := resolveInRoot(root, name); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("resolveInRoot(%q) 错误 = %v，期望 ErrUnsafePath", name, err)
+		}
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 0 {
+		t.Errorf("被拒绝的文件名在接收目录中创建了 %d 项", len(entries))
+	}
+}
+
+func TestResolveInRootAccepts(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"a.txt", "a.txt"},
+		{"./b.txt", "b.txt"},
+		{"sub/dir/c.txt", filepath.Join("sub", "dir", "c.txt")},
+		{`win\style.txt`, filepath.Join("win", "style.txt")},
+		{"we:ird*.txt", "we_ird_.txt"},
+		{"console.log", "console.log"},
+	}
+	for _, tt := range tests {
+		got, err := resolveInRoot(root, tt.name)
+		if err != nil {
+			t.Errorf("resolveInRoot(%q) 失败: %v", tt.name, err)
+			continue
+		}
+		if want := filepath.Join(root, tt.want); got != want {
+			t.Errorf("resolveInRoot(%q) = %q，期望 %q", tt.name, got, want)
+		}
+	}
+}
+
+func TestResolveInRootSymlinkEscape(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("不支持符号链接: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "target"), filepath.Join(root, "file")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"link/evil", "link/sub/evil", "file"} {
+		if _, err := resolveInRoot(root, name); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("resolveInRoot(%q) 错误 = %v，期望 ErrUnsafePath", name, err)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("经由符号链接在接收目录之外创建了 %d 项", len(entries))
+	}
+}
+
+func TestDirSinkSkipsUnsafeName(t *testing.T) {
+	sink := NewDirSink(t.TempDir())
+	_, err := sink.Create(FileInfo{Name: "../evil", Size: 1})
+	if !errors.Is(err, ErrSkipFile) || !errors.Is(err, ErrUnsafePath) {
+		t.Fatalf("Create 错误 = %v，期望 ErrSkipFile 包装 ErrUnsafePath", err)
+	}
+}
+
+// TestDirSinkRejectsPlantedPart 预先放置的 .part 符号链接或目录不能把写入引到接收目录之外
+func TestDirSinkRejectsPlantedPart(t *testing.T) {
+	for _, policy := range []CollisionPolicy{CollisionOverwrite, CollisionResume, CollisionRename} {
+		t.Run(policy.String(), func(t *testing.T) {
+			root := t.TempDir()
+			outside := filepath.Join(t.TempDir(), "pwned")
+			if err := os.WriteFile(outside, []byte("keep"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink(outside, filepath.Join(root, "a.txt"+partSuffix)); err != nil {
+				t.Skipf("不支持符号链接: %v", err)
+			}
+			if err := os.Mkdir(filepath.Join(root, "d.txt"+partSuffix), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			sink := &DirSink{Dir: root, Collision: policy}
+			for _, name := range []string{"a.txt", "d.txt"} {
+				err := receiveOne(t, sink, name, []byte("evil"))
+				if !errors.Is(err, ErrSkipFile) || !errors.Is(err, ErrUnsafePath) {
+					t.Errorf("%s: 错误 = %v，期望 ErrSkipFile 包装 ErrUnsafePath", name, err)
+				}
+			}
+			if data, _ := os.ReadFile(outside); string(data) != "keep" {
+				t.Errorf("接收目录之外的文件被改写: %q", data)
+			}
+		})
+	}
+
+	// C API 的下载路径同样检查
+	dir := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "pwned")
+	if err := os.Symlink(outside, filepath.Join(dir, "b.txt"+partSuffix)); err != nil {
+		t.Skipf("不支持符号链接: %v", err)
+	}
+	if _, err := newPathSink(filepath.Join(dir, "b.txt"), Options{Collision: CollisionResume}); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("newPathSink 错误 = %v，期望 ErrUnsafePath", err)
+	}
+	if _, err := os.Lstat(outside); !os.IsNotExist(err) {
+		t.Errorf("符号链接的目标被创建")
+	}
+}
+
+// receiveOne 通过 sink 接收一个文件并提交
+func receiveOne(t *testing.T, sink *DirSink, name string, data []byte) error {
+	t.Helper()
+	w, err := sink.Create(FileInfo{Name: name, Size: int64(len(data))})
+	if err != nil {
+		return err
+	}
+	if _, err := w.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	return w.Commit()
+}
+
+func TestDirSinkCollisionPolicies(t *testing.T) {
+	tests := []struct {
+		policy  CollisionPolicy
+		wantErr error
+		want    map[string]string
+	}{
+		{CollisionRename, nil, map[string]string{"f.txt": "old", "f_1.txt": "new"}},
+		{CollisionOverwrite, nil, map[string]string{"f.txt": "new"}},
+		{CollisionSkip, ErrSkipFile, map[string]string{"f.txt": "old"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "f.txt"), []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			sink := &DirSink{Dir: dir, Collision: tt.policy}
+			if err := receiveOne(t, sink, "f.txt", []byte("new")); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("接收错误 = %v，期望 %v", err, tt.wantErr)
+			}
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != len(tt.want) {
+				t.Errorf("目录中有 %d 个文件，期望 %d 个", len(entries), len(tt.want))
+			}
+			for name, content := range tt.want {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil || string(data) != content {
+					t.Errorf("%s = %q (%v)，期望 %q", name, data, err, content)
+				}
+			}
+		})
+	}
+}
+
+func TestDirSinkResume(t *testing.T) {
+	dir := t.TempDir()
+	sink := &DirSink{Dir: dir, Collision: CollisionResume}
+
+	// 已有完整文件：跳过
+	if err := os.WriteFile(filepath.Join(dir, "done.bin"), []byte("123456"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sink.Create(FileInfo{Name: "done.bin", Size: 6}); err != ErrSkipFile {
+		t.Errorf("已有完整文件: 错误 = %v，期望 ErrSkipFile", err)
+	}
+
+	// 有 .part：从其长度续传
+	if err := os.WriteFile(filepath.Join(dir, "half.bin"+partSuffix), []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := sink.Create(FileInfo{Name: "half.bin", Size: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off := w.(resumer).ResumeOffset(); off != 3 {
+		t.Fatalf("ResumeOffset = %d，期望 3", off)
+	}
+	w.WriteAt([]byte("def"), 3)
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "half.bin")); string(data) != "abcdef" {
+		t.Errorf("续传后的文件 = %q，期望 %q", data, "abcdef")
+	}
+
+	// .part 比声明的大小还长：不是同一个文件，从头接收
+	if err := os.WriteFile(filepath.Join(dir, "long.bin"+partSuffix), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err = sink.Create(FileInfo{Name: "long.bin", Size: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Abort()
+	if off := w.(resumer).ResumeOffset(); off != 0 {
+		t.Errorf("ResumeOffset = %d，期望 0", off)
+	}
+}
+
+func TestReceiveSandboxAndResume(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Dir(dir)
+	payload := make([]byte, 10000)
+	for i := range payload {
+		payload[i] = byte(i % 251)
+	}
+	// 上次中断留下的前 4000 字节（用不同的内容标记，确认这部分没有重新接收）
+	kept := bytes.Repeat([]byte{'R'}, 4000)
+	if err := os.WriteFile(filepath.Join(dir, "big.bin"+partSuffix), kept, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []FileSource{
+		NewMemorySource(FileInfo{Name: "../escaped.txt"}, []byte("evil")),
+		NewMemorySource(FileInfo{Name: "big.bin"}, payload),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	type outcome struct {
+		results []FileResult
+		err     error
+	}
+	sent := make(chan outcome, 1)
+	go func() {
+		r, err := Send(ctx, a, files, Options{})
+		sent <- outcome{r, err}
+	}()
+	results, err := Receive(ctx, b, &DirSink{Dir: dir, Collision: CollisionResume}, Options{})
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if s := <-sent; s.err != nil {
+		t.Fatalf("Send: %v", s.err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("收到 %d 个结果，期望 2 个", len(results))
+	}
+	if !results[0].Skipped || !errors.Is(results[0].Err, ErrUnsafePath) {
+		t.Errorf("escaped.txt 的结果 = %+v，期望以 ErrUnsafePath 跳过", results[0])
+	}
+	if _, err := os.Stat(filepath.Join(outside, "escaped.txt")); !os.IsNotExist(err) {
+		t.Errorf("escaped.txt 被写到了接收目录之外")
+	}
+	if !results[1].Completed {
+		t.Errorf("big.bin 的结果 = %+v，期望完成", results[1])
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "big.bin"))
+	if want := append(kept, payload[4000:]...); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("big.bin 内容不一致，没有从续传位置开始 (%v)", err)
+	}
+}
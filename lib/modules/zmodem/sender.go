@@ -0,0 +1,360 @@
+package zmodem
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// subpacketSize 每个数据子包携带的文件数据长度（与 lrzsz 默认值一致）
+const subpacketSize = 1024
+
+// sender 发送方状态
+type sender struct {
+	files   []FileSource // 待发送的文件
+	fileIdx int          // 当前文件下标
+	src     FileSource   // 当前文件
+
+	useCRC32   bool   // 接收方支持 CANFC32 时使用 32 位 CRC
+	escapeCtl  bool   // 接收方要求转义所有控制字符（ESCCTL）
+	streaming  bool   // 接收方支持全双工流式接收，无需等待应答
+	window     int64  // 非流式时，等待应答前最多发送的字节数
+	waitingAck bool   // 已发送 ZCRCW，等待接收方 ZACK
+	ackPos     int64  // 接收方最近确认的位置
+	needHeader bool   // 下一个数据子包之前需要先发送 ZDATA 帧头
+	syncWait   bool   // 重传的第一个数据子包以 ZCRCW 结束，等对方确认后再继续（与 lrzsz sz 一致）
+	rposCount  int    // 连续收到 ZRPOS 的次数，用于放弃无法恢复的传输
+	readBuf    []byte // 读取文件的缓冲区
+}
+
+// NewSender 创建发送文件的引擎
+// 引擎会发送 ZRQINIT 请求接收方初始化，然后依次发送 files 中的文件
+func NewSender(files []FileSource, opts Options) *ZmodemImpl {
+	z := newImpl(modeSend, opts)
+	z.mu.Lock()
+	defer z.unlock()
+	z.files = files
+	z.readBuf = make([]byte, subpacketSize)
+	z.emit(Event{Type: EventSessionStart, Direction: "send"})
+	z.setState(StateSendingInit, "waiting for receiver")
+	z.sendHeader(BuildZRQINITFrame())
+	return z
+}
+
+// closeSources 关闭所有待发送的文件
+func (z *ZmodemImpl) closeSources() error {
+	var firstErr error
+	for _, f := range z.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	z.files = nil
+	z.src = nil
+	return firstErr
+}
+
+// handleSenderFrame 发送方处理接收方发来的帧
+func (z *ZmodemImpl) handleSenderFrame(frame *ZmodemFrame) {
+	switch frame.Type {
+	case FrameZRINIT:
+		switch z.state {
+		case StateSendingInit:
+			z.applyReceiverCaps(frame)
+			if z.opts.CheckFreeSpace {
+				// 先查询远端剩余空间，收到 ZACK 后再决定是否发送 ZFILE
+				z.setState(StateQueryingFreeSpace, "querying receiver free space")
+				z.sendHeader(BuildZFREECNTFrame())
+				return
+			}
+			z.startFile()
+		case StateSendingEOF:
+			// ZEOF 之后接收方以 ZRINIT 请求下一个文件
+			if r := z.currentResult(); r != nil {
+				r.Transferred = z.transferred
+				r.Completed = true
+				z.digest.fill(z.src, z.transferred)
+				z.recordDigest()
+				z.emitFile(EventFileComplete, "")
+			}
+			z.nextFile()
+		}
+		// 其他状态下的 ZRINIT 是接收方重发的初始化帧，忽略
+
+	case FrameZACK:
+		switch z.state {
+		case StateQueryingFreeSpace:
+			z.checkRemoteFreeSpace(frame.Position())
+		case StateSendingData:
+			z.ackPos = int64(frame.Position())
+			z.rposCount = 0
+			if z.waitingAck {
+				z.waitingAck = false
+				z.needHeader = true
+			}
+		}
+
+	case FrameZRPOS:
+		// sending_header 时是对 ZFILE 的响应（位置非 0 表示断点续传），
+		// 发送数据过程中则表示接收方要求从该位置重传
+		switch z.state {
+		case StateSendingHeader:
+			z.rewind(int64(frame.Position()))
+			z.setState(StateSendingData, fmt.Sprintf("sending from offset %d", z.transferred))
+		case StateSendingData, StateSendingEOF:
+			// 暂停期间接收方等待超时发来的 ZRPOS 不计入重传上限
+			if !z.paused {
+				z.rposCount++
+				if z.rposCount > maxRetries {
+					z.fail(fmt.Errorf("%w，放弃传输", ErrRetriesExhausted))
+					return
+				}
+			}
+			z.rewind(int64(frame.Position()))
+			z.syncWait = true
+			z.setState(StateSendingData, fmt.Sprintf("retrying at offset %d", z.transferred))
+			z.retry(fmt.Sprintf("receiver requested offset %d", z.transferred))
+		}
+
+	case FrameZSKIP:
+		// 接收方跳过当前文件
+		if z.state == StateSendingHeader || z.state == StateSendingData || z.state == StateSendingEOF {
+			if r := z.currentResult(); r != nil {
+				z.recordAcked()
+				r.Skipped = true
+				z.emitFile(EventFileSkipped, "skipped by receiver")
+			}
+			z.outputBuf.Reset()
+			z.nextFile()
+		}
+
+	case FrameZNAK:
+		// 接收方没能正确收到上一个帧头，重发
+		if z.lastHeader != nil && z.state != StateSendingData {
+			z.outputBuf.Write(z.lastHeader)
+			z.retry("header rejected by receiver")
+		}
+
+	case FrameZCRC:
+		// 接收方请求文件前 N 字节的 CRC（用于断点续传时比对），N 在位置字段中，0 表示整个文件
+		if z.src != nil {
+			n := int64(frame.Position())
+			if n == 0 || n > z.fileSize {
+				n = z.fileSize
+			}
+			crc, err := sourceCRC32(z.src, n)
+			if err != nil {
+				z.fail(err)
+				return
+			}
+			z.outputBuf.Write(BuildZCRCFrame(crc))
+		}
+
+	case FrameZFIN:
+		// 接收方回复 ZFIN，发送 "OO" 结束会话
+		if z.state == StateSendingFin {
+			z.outputBuf.Write([]byte("OO"))
+			z.setState(StateCompleted, "transfer complete")
+		}
+
+	case FrameZABORT, FrameZFERR:
+		z.fail(fmt.Errorf("%w: 收到 %s", ErrPeerCancelled, frame.Type))
+	}
+}
+
+// applyReceiverCaps 根据 ZRINIT 中的能力标志和缓冲区大小确定发送方式
+func (z *ZmodemImpl) applyReceiverCaps(frame *ZmodemFrame) {
+	caps := frame.F0
+	bufSize := int64(frame.F3) | int64(frame.F2)<<8
+	z.useCRC32 = caps&CANFC32 != 0
+	z.escapeCtl = caps&ESCCTL != 0 || z.opts.EscapeControl
+	z.streaming = caps&CANFDX != 0 && caps&CANOVIO != 0 && bufSize == 0
+	z.window = bufSize
+	if z.window == 0 || z.window > subpacketSize*8 {
+		z.window = subpacketSize
+	}
+	z.logf(LogDebug, "接收方能力: caps=0x%02x, bufSize=%d, crc32=%v, streaming=%v", caps, bufSize, z.useCRC32, z.streaming)
+}
+
+// checkRemoteFreeSpace 处理 ZFREECNT 的 ZACK 响应，空间足够则发送 ZFILE 开始传输
+// 0xFFFFFFFF 表示对方不限制或无法获取
+func (z *ZmodemImpl) checkRemoteFreeSpace(free uint32) {
+	var total int64
+	for _, f := range z.files {
+		total += f.Info().Size
+	}
+	if free != 0xFFFFFFFF && total > int64(free) {
+		z.fail(fmt.Errorf("远端%w: 需要 %d 字节，可用 %d 字节", ErrDiskFull, total, free))
+		return
+	}
+	z.logf(LogDebug, "远端剩余空间: %d，批次大小: %d，开始发送 ZFILE", free, total)
+	z.startFile()
+}
+
+// startFile 发送当前文件的 ZFILE，没有更多文件时发送 ZFIN 结束会话
+func (z *ZmodemImpl) startFile() {
+	if z.fileIdx >= len(z.files) {
+		z.finishSending()
+		return
+	}
+
+	z.src = z.files[z.fileIdx]
+	info := z.src.Info()
+	z.filename = info.Name
+	z.fileSize = info.Size
+	z.transferred = 0
+	z.ackPos = 0
+	z.rposCount = 0
+	z.waitingAck = false
+	z.digest = newFileDigest(z.opts.MD5)
+	z.results = append(z.results, FileResult{Name: info.Name, Size: info.Size})
+	z.emitOffered(info)
+
+	var bytesLeft int64
+	for _, f := range z.files[z.fileIdx:] {
+		bytesLeft += f.Info().Size
+	}
+	fileInfo := encodeFileInfo(info, z.names, len(z.files)-z.fileIdx, bytesLeft)
+
+	conv := uint8(ZCBIN)
+	if z.opts.Resume {
+		conv = ZCRESUM // 请求接收方从已有部分之后继续
+	}
+	manage := uint8(0)
+	if z.opts.Clobber {
+		manage = ZMCLOB // 要求接收方覆盖已有文件
+	}
+	z.setState(StateSendingHeader, "waiting for receiver")
+	z.sendHeader(BuildZFILEFrame(fileInfo, conv, manage, z.useCRC32, z.escapeCtl))
+}
+
+// nextFile 结束当前文件，开始发送下一个文件
+func (z *ZmodemImpl) nextFile() {
+	if z.src != nil {
+		z.src.Close()
+		z.src = nil
+	}
+	z.fileIdx++
+	z.startFile()
+}
+
+// finishSending 发送方结束会话：发送 ZFIN，等待对方回 ZFIN
+func (z *ZmodemImpl) finishSending() {
+	z.setState(StateSendingFin, "closing session")
+	z.sendHeader(BuildZFINFrame())
+}
+
+// rewind 将待发送位置移动到 pos（用于 ZRPOS 断点续传或重传），并丢弃尚未发出的数据
+func (z *ZmodemImpl) rewind(pos int64) {
+	if pos > z.fileSize {
+		pos = z.fileSize
+	}
+	z.outputBuf.Reset()
+	z.transferred = pos
+	z.ackPos = pos
+	z.waitingAck = false
+	z.needHeader = true
+	z.syncWait = false
+}
+
+// recordAcked 当前文件未完成时（出错、被跳过或中止），以接收方最近确认的位置作为已传输的字节数
+func (z *ZmodemImpl) recordAcked() {
+	if r := z.currentResult(); r != nil && !r.Completed {
+		r.Transferred = z.ackPos
+	}
+}
+
+// retrySend 发送方等待响应超时后的重试
+func (z *ZmodemImpl) retrySend() {
+	if z.state == StateSendingData {
+		// 等待 ZCRCW 应答超时，从对方最近确认的位置重新发送
+		z.rewind(z.ackPos)
+		z.syncWait = true
+		return
+	}
+	if z.lastHeader != nil {
+		z.outputBuf.Write(z.lastHeader)
+	}
+}
+
+// fillData 从文件读取下一段数据并生成数据子包，文件结束时追加 ZEOF
+func (z *ZmodemImpl) fillData() {
+	if z.needHeader {
+		z.outputBuf.Write(BuildZDATAHeader(uint32(z.transferred), z.useCRC32, z.escapeCtl))
+		z.needHeader = false
+	}
+
+	chunk := z.readBuf
+	if n := z.throttleChunk(); n > 0 && n < len(chunk) {
+		chunk = chunk[:n]
+	}
+	if !z.streaming {
+		if room := z.ackPos + z.window - z.transferred; room < int64(len(chunk)) && room > 0 {
+			chunk = chunk[:room]
+		}
+	}
+
+	// 对方要求从更靠后的位置开始（续传）时，先补齐跳过部分的摘要
+	z.digest.fill(z.src, z.transferred)
+	n, err := z.src.ReadAt(chunk, z.transferred)
+	if err != nil && err != io.EOF {
+		z.fail(fmt.Errorf("读取文件失败: %w", err))
+		return
+	}
+	z.digest.add(chunk[:n], z.transferred)
+	z.transferred += int64(n)
+	if n > 0 {
+		z.stats.addData(z.now(), n)
+		z.throttleTake(z.now(), n)
+	}
+	z.emitFile(EventFileProgress, "")
+	z.lastActivity = z.now()
+
+	atEOF := err == io.EOF || z.transferred >= z.fileSize
+	var end byte
+	switch {
+	case atEOF:
+		end = ZCRCE
+	case z.syncWait, !z.streaming && z.transferred-z.ackPos >= z.window:
+		end = ZCRCW
+		z.waitingAck = true
+		z.syncWait = false
+	default:
+		end = ZCRCG
+	}
+	z.outputBuf.Write(BuildDataSubpacket(chunk[:n], end, z.useCRC32, z.escapeCtl))
+
+	if atEOF {
+		z.fileSize = z.transferred
+		z.setState(StateSendingEOF, "waiting for receiver to confirm EOF")
+		z.sendHeader(BuildZEOFFrame(uint32(z.transferred), z.useCRC32, z.escapeCtl))
+	}
+}
+
+// encodeFileInfo 生成 ZFILE 数据子包：文件名\0大小 修改时间(八进制) 权限(八进制) 序列号 剩余文件数 剩余字节数\0
+// 文件名按会话的远端字符集编码
+func encodeFileInfo(info FileInfo, names nameCodec, filesLeft int, bytesLeft int64) []byte {
+	var mtime int64
+	if !info.ModTime.IsZero() {
+		mtime = info.ModTime.Unix()
+	}
+	mode := uint32(info.Mode.Perm())
+	if mode != 0 {
+		mode |= 0100000 // 普通文件
+	}
+	name := names.encode(info.Name)
+	buf := make([]byte, 0, len(name)+64)
+	buf = append(buf, name...)
+	buf = append(buf, 0)
+	buf = append(buf, fmt.Sprintf("%d %o %o 0 %d %d", info.Size, mtime, mode, filesLeft, bytesLeft)...)
+	return append(buf, 0)
+}
+
+// sourceCRC32 计算文件前 size 字节的 CRC32（响应 ZCRC）
+func sourceCRC32(src FileSource, size int64) (uint32, error) {
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, io.NewSectionReader(src, 0, size)); err != nil {
+		return 0, fmt.Errorf("计算文件 CRC 失败: %w", err)
+	}
+	return h.Sum32(), nil
+}
@@ -2,7 +2,12 @@ package zmodem
 
 import (
 	"C"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 )
 
 // SessionStatus 会话状态
@@ -28,22 +33,56 @@ type Session struct {
 	Mode     int // 0=upload, 1=download
 	FilePath string
 	Status   SessionStatus
-	Progress Progress
 	ErrorMsg string
+	ErrCode  ErrorCode // 错误码（Status 为 StatusError 时有效）
 	mu       sync.RWMutex
 	impl     *ZmodemImpl
+
+	// 事件回调（见 SetCallbacks）
+	stop    chan struct{} // 关闭后会话 goroutine 不再发起回调
+	wake    chan struct{} // 有新输入时唤醒会话 goroutine
+	done    chan struct{} // 会话 goroutine 退出时关闭
+	stopped bool
+	unacked int64 // 已交给 Output 回调、尚未被宿主确认的字节数（见 Options.OutputWindow）
 }
 
 // SessionManager 会话管理器
 type SessionManager struct {
-	sessions map[int]*Session
-	nextID   int
-	mu       sync.RWMutex
+	sessions   map[int]*Session
+	nextID     int
+	limiter    *RateLimiter  // 所有会话共享的限速（见 SetGlobalRateLimit）
+	limits     SessionLimits // 会话数上限与空闲回收（见 SetSessionLimits）
+	reaperStop chan struct{} // 关闭后回收空闲会话的 goroutine 退出，nil 表示没有运行
+	mu         sync.RWMutex
+}
+
+// SessionLimits 会话管理器的限制（由宿主以 JSON 传入，未设置的字段表示不限制）
+type SessionLimits struct {
+	// MaxSessions 同时进行中（未结束）的会话数上限，达到上限时创建会话返回 ErrTooManySessions，0 表示不限制
+	MaxSessions int `json:"maxSessions"`
+	// IdleTimeoutMs 会话超过该毫秒数没有输入输出时被回收：中止传输、关闭文件并删除未完成的 .part，0 表示不回收
+	IdleTimeoutMs int64 `json:"idleTimeoutMs"`
+}
+
+// SessionInfo 会话的诊断信息（C API 的 ZmodemListSessions 以 JSON 数组返回）
+type SessionInfo struct {
+	ID          int    `json:"id"`
+	Mode        string `json:"mode"`            // "send" 或 "receive"
+	FilePath    string `json:"filePath"`        // 创建会话时指定的路径
+	State       string `json:"state"`           // 协议状态（见 State）
+	File        string `json:"file"`            // 当前文件名，尚未开始传输文件时为空
+	Transferred int64  `json:"transferred"`     // 当前文件已传输字节数
+	Total       int64  `json:"total"`           // 当前文件大小
+	Paused      bool   `json:"paused"`          // 已暂停（见 Pause）
+	Callbacks   bool   `json:"callbacks"`       // 已注册事件回调
+	IdleMs      int64  `json:"idleMs"`          // 距离最近一次输入或输出的毫秒数
+	Error       string `json:"error,omitempty"` // 会话出错时的错误消息
 }
 
 var sessionManager = &SessionManager{
 	sessions: make(map[int]*Session),
 	nextID:   1,
+	limiter:  NewRateLimiter(0),
 }
 
 // NewSession 创建新会话
@@ -51,6 +90,10 @@ func NewSession(mode int, filePath string, impl *ZmodemImpl) (*Session, error) {
 	sessionManager.mu.Lock()
 	defer sessionManager.mu.Unlock()
 
+	if limit := sessionManager.limits.MaxSessions; limit > 0 && sessionManager.activeCount() >= limit {
+		return nil, fmt.Errorf("%w（上限 %d）", ErrTooManySessions, limit)
+	}
+
 	id := sessionManager.nextID
 	sessionManager.nextID++
 
@@ -62,6 +105,9 @@ func NewSession(mode int, filePath string, impl *ZmodemImpl) (*Session, error) {
 		impl:     impl,
 	}
 
+	if impl != nil {
+		impl.SetSharedLimiter(sessionManager.limiter)
+	}
 	sessionManager.sessions[id] = session
 	return session, nil
 }
@@ -73,24 +119,169 @@ func GetSession(id int) *Session {
 	return sessionManager.sessions[id]
 }
 
-// RemoveSession 移除会话
+// RemoveSession 移除会话，停止其事件回调并等待正在执行的回调返回
 func RemoveSession(id int) {
+	takeSession(id)
+}
+
+// takeSession 移除会话并停止其事件回调，返回被移除的会话，不存在时为 nil
+func takeSession(id int) *Session {
 	sessionManager.mu.Lock()
-	defer sessionManager.mu.Unlock()
+	session := sessionManager.sessions[id]
 	delete(sessionManager.sessions, id)
+	sessionManager.mu.Unlock()
+
+	// 不持有 sessionManager.mu 等待，回调中可能还在查询会话
+	if session != nil {
+		session.stopCallbacks()
+	}
+	return session
 }
 
-// UpdateProgress 更新进度
-func (s *Session) UpdateProgress(transferred, total int64) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.Progress.Transferred = transferred
-	s.Progress.Total = total
-	if total > 0 {
-		s.Progress.Percent = float64(transferred) / float64(total) * 100
+// closeSession 移除会话，以 reason 中止未结束的传输并释放文件；会话不存在时 ok 为 false
+func closeSession(id int, reason error) (ok bool, err error) {
+	session := takeSession(id)
+	if session == nil {
+		return false, nil
+	}
+	if impl := session.GetImpl(); impl != nil {
+		impl.Abort(reason)
+		err = impl.Close()
+	}
+	return true, err
+}
+
+// CleanupAll 移除并关闭所有会话（宿主退出时调用）：中止未结束的传输并释放文件，返回第一个释放失败的错误
+func CleanupAll() error {
+	var firstErr error
+	for _, session := range allSessions() {
+		if _, err := closeSession(session.ID, ErrCancelled); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// allSessions 按 ID 顺序返回所有会话
+func allSessions() []*Session {
+	sessionManager.mu.RLock()
+	sessions := make([]*Session, 0, len(sessionManager.sessions))
+	for _, s := range sessionManager.sessions {
+		sessions = append(sessions, s)
+	}
+	sessionManager.mu.RUnlock()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
+
+// activeCount 进行中（未结束）的会话数（调用方持有 sessionManager.mu）
+func (m *SessionManager) activeCount() int {
+	n := 0
+	for _, s := range m.sessions {
+		if impl := s.GetImpl(); impl != nil && !impl.GetState().IsTerminal() {
+			n++
+		}
+	}
+	return n
+}
+
+// ListSessions 按 ID 顺序返回所有会话的诊断信息
+func ListSessions() []SessionInfo {
+	sessions := allSessions()
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, s.Info())
+	}
+	return infos
+}
+
+// ParseSessionLimits 解析 JSON 格式的会话限制，空字符串表示不限制
+func ParseSessionLimits(data string) (SessionLimits, error) {
+	var limits SessionLimits
+	if data == "" {
+		return limits, nil
+	}
+	if err := json.Unmarshal([]byte(data), &limits); err != nil {
+		return limits, fmt.Errorf("解析会话限制失败: %w", err)
+	}
+	if limits.MaxSessions < 0 || limits.IdleTimeoutMs < 0 {
+		return limits, errors.New("解析会话限制失败: 取值不能为负数")
+	}
+	return limits, nil
+}
+
+// SetSessionLimits 设置会话数上限和空闲回收时间，对已有的会话同样生效
+// 降低上限不会关闭已在进行的会话，只拒绝之后创建的会话
+func SetSessionLimits(limits SessionLimits) {
+	sessionManager.mu.Lock()
+	defer sessionManager.mu.Unlock()
+	sessionManager.limits = limits
+	if sessionManager.reaperStop != nil {
+		close(sessionManager.reaperStop)
+		sessionManager.reaperStop = nil
+	}
+	if limits.IdleTimeoutMs > 0 {
+		stop := make(chan struct{})
+		sessionManager.reaperStop = stop
+		go runReaper(time.Duration(limits.IdleTimeoutMs)*time.Millisecond, stop)
 	}
 }
 
+// reapInterval 检查空闲会话的间隔
+func reapInterval(timeout time.Duration) time.Duration {
+	return min(max(timeout/4, time.Second), 30*time.Second)
+}
+
+// runReaper 定期回收空闲超过 timeout 的会话，直到 stop 被关闭
+func runReaper(timeout time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(reapInterval(timeout))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reapIdle(timeout)
+		}
+	}
+}
+
+// reapIdle 回收空闲超过 timeout 的会话（宿主没有调用 ZmodemCleanup 就丢下的会话），返回被回收的会话 ID
+func reapIdle(timeout time.Duration) []int {
+	var reaped []int
+	for _, session := range allSessions() {
+		impl := session.GetImpl()
+		if impl == nil || !impl.reapable(timeout) {
+			continue
+		}
+		ok, err := closeSession(session.ID, fmt.Errorf("%w: 会话空闲超过 %v", ErrCancelled, timeout))
+		if !ok {
+			continue // 宿主已清理
+		}
+		if err != nil {
+			logWarnf("回收空闲会话 %d 时释放文件失败: %v", session.ID, err)
+		}
+		logWarnf("会话 %d 空闲超过 %v，已回收", session.ID, timeout)
+		reaped = append(reaped, session.ID)
+	}
+	return reaped
+}
+
+// SetGlobalRateLimit 设置所有会话共享的上传限速（字节/秒），0 表示不限速
+// 与各会话自己的限速（Options.RateLimit）同时生效，修改后立即影响正在进行的传输
+func SetGlobalRateLimit(bytesPerSec int64) {
+	sessionManager.limiter.SetRate(bytesPerSec)
+	// 唤醒正在等待限速的会话，按新的限速重新计算等待时间
+	for _, s := range allSessions() {
+		s.Wake()
+	}
+}
+
+// GlobalRateLimit 所有会话共享的上传限速（字节/秒），0 表示不限速
+func GlobalRateLimit() int64 {
+	return sessionManager.limiter.Rate()
+}
+
 // SetStatus 设置状态
 func (s *Session) SetStatus(status SessionStatus) {
 	s.mu.Lock()
@@ -106,6 +297,25 @@ func (s *Session) SetError(msg string) {
 	s.ErrorMsg = msg
 }
 
+// Fail 以 err 将会话标记为出错，同时记录错误消息和错误码
+func (s *Session) Fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Status = StatusError
+	s.ErrorMsg = err.Error()
+	s.ErrCode = CodeOf(err)
+}
+
+// GetErrorCode 获取错误码
+func (s *Session) GetErrorCode() ErrorCode {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.Status == StatusError && s.ErrCode == CodeOK {
+		return CodeInternal // 只通过 SetError 设置了消息
+	}
+	return s.ErrCode
+}
+
 // GetStatus 获取状态
 func (s *Session) GetStatus() SessionStatus {
 	s.mu.RLock()
@@ -113,11 +323,70 @@ func (s *Session) GetStatus() SessionStatus {
 	return s.Status
 }
 
-// GetProgress 获取进度
+// GetProgress 获取当前文件的进度（取自引擎的传输统计）
 func (s *Session) GetProgress() Progress {
+	stats := s.Stats()
+	return Progress{Transferred: stats.Transferred, Total: stats.Total, Percent: stats.Percent}
+}
+
+// Stats 获取传输统计，引擎不存在时为零值
+func (s *Session) Stats() TransferStats {
+	if impl := s.GetImpl(); impl != nil {
+		return impl.Stats()
+	}
+	return TransferStats{ETAMs: -1}
+}
+
+// Info 获取会话的诊断信息
+func (s *Session) Info() SessionInfo {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.Progress
+	info := SessionInfo{
+		ID:        s.ID,
+		Mode:      "send",
+		FilePath:  s.FilePath,
+		State:     StateIdle.String(),
+		Callbacks: s.stop != nil && !s.stopped,
+		Error:     s.ErrorMsg,
+	}
+	impl := s.impl
+	s.mu.RUnlock()
+	if s.Mode == modeReceive {
+		info.Mode = "receive"
+	}
+	if impl == nil {
+		return info
+	}
+
+	stats := impl.Stats()
+	info.State = impl.GetState().String()
+	info.Transferred = stats.Transferred
+	info.Total = stats.Total
+	info.Paused = stats.Paused
+	info.IdleMs = impl.idle().Milliseconds()
+	if results := impl.Results(); len(results) > 0 {
+		info.File = results[len(results)-1].Name
+	}
+	if err := impl.GetError(); err != nil {
+		info.Error = err.Error()
+	}
+	return info
+}
+
+// idle 距离最近一次输入或输出的时间
+func (z *ZmodemImpl) idle() time.Duration {
+	z.mu.Lock()
+	defer z.unlock()
+	return z.now().Sub(z.lastUsed)
+}
+
+// reapable 会话是否空闲超过 timeout 而应被回收；暂停中的会话没有输入输出是正常的，不回收
+func (z *ZmodemImpl) reapable(timeout time.Duration) bool {
+	z.mu.Lock()
+	defer z.unlock()
+	if z.paused && !z.state.IsTerminal() {
+		return false
+	}
+	return z.now().Sub(z.lastUsed) >= timeout
 }
 
 // GetError 获取错误消息
@@ -0,0 +1,185 @@
+package zmodem
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// withSessionLimits 在测试期间使用 limits，结束时恢复为不限制并清理所有会话
+func withSessionLimits(t *testing.T, limits SessionLimits) {
+	t.Helper()
+	SetSessionLimits(limits)
+	t.Cleanup(func() {
+		SetSessionLimits(SessionLimits{})
+		CleanupAll()
+	})
+}
+
+// newTestSession 创建发送 a.bin 的会话，closed 在文件被关闭时置为 true
+func newTestSession(t *testing.T, closed *bool) (*Session, error) {
+	t.Helper()
+	src := &FuncSource{
+		FileInfo:   FileInfo{Name: "a.bin", Size: 1024},
+		ReadAtFunc: NewMemorySource(FileInfo{}, testPayload(1024)).ReadAt,
+		CloseFunc: func() error {
+			if closed != nil {
+				*closed = true
+			}
+			return nil
+		},
+	}
+	return NewSession(modeSend, "a.bin", NewSender([]FileSource{src}, Options{}))
+}
+
+// TestSessionLimitsMaxSessions 进行中的会话达到上限时拒绝创建新会话，已结束的会话不计入
+func TestSessionLimitsMaxSessions(t *testing.T) {
+	withSessionLimits(t, SessionLimits{MaxSessions: 2})
+
+	first, err := newTestSession(t, nil)
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	if _, err := newTestSession(t, nil); err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	_, err = newTestSession(t, nil)
+	if !errors.Is(err, ErrTooManySessions) || CodeOf(err) != CodeTooManySessions {
+		t.Fatalf("超过上限时的错误 = %v，期望 ErrTooManySessions", err)
+	}
+
+	first.GetImpl().Abort(ErrCancelled)
+	if _, err := newTestSession(t, nil); err != nil {
+		t.Fatalf("会话结束后仍不能创建新会话: %v", err)
+	}
+}
+
+// TestReapIdleSessions 空闲超时的会话被中止并移除，文件被关闭、未完成的 .part 被删除；仍有输入输出的会话保留
+func TestReapIdleSessions(t *testing.T) {
+	withSessionLimits(t, SessionLimits{})
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := func() time.Time { return clock }
+
+	dir := t.TempDir()
+	receiver := NewReceiver(NewDirSink(dir), Options{})
+	receiver.now = now
+	stale, err := NewSession(modeReceive, dir, receiver)
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	data := testPayload(10000)
+	info := encodeFileInfo(FileInfo{Name: "a.bin", Size: int64(len(data))}, nameCodec{}, 0, 0)
+	feedReceiver(t, receiver,
+		BuildZFILEFrame(info, 0, 0, true, false),
+		append(BuildZDATAHeader(0, true, false), BuildDataSubpacket(data[:2000], ZCRCG, true, false)...),
+	)
+	if _, err := os.Stat(filepath.Join(dir, "a.bin.part")); err != nil {
+		t.Fatalf("没有创建 .part 文件: %v", err)
+	}
+
+	closed := false
+	active, err := newTestSession(t, &closed)
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	active.GetImpl().now = now
+	drain(active.GetImpl())
+
+	clock = clock.Add(50 * time.Second)
+	feedReceiver(t, active.GetImpl(), BuildZRINITFrame(CANFDX|CANOVIO|CANFC32))
+	clock = clock.Add(20 * time.Second)
+
+	reaped := reapIdle(time.Minute)
+	if len(reaped) != 1 || reaped[0] != stale.ID {
+		t.Fatalf("回收的会话 = %v，期望 [%d]", reaped, stale.ID)
+	}
+	if GetSession(stale.ID) != nil || GetSession(active.ID) == nil {
+		t.Fatal("应只移除空闲的会话")
+	}
+	if receiver.GetState() != StateError || !errors.Is(receiver.GetError(), ErrCancelled) {
+		t.Errorf("被回收的会话状态 = %s (%v)，期望以取消结束", receiver.GetState(), receiver.GetError())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("回收后目录中仍有文件: %v", entries)
+	}
+
+	clock = clock.Add(time.Minute)
+	if reaped := reapIdle(time.Minute); len(reaped) != 1 || !closed {
+		t.Errorf("回收的会话 = %v，文件已关闭 = %v", reaped, closed)
+	}
+}
+
+// TestReapSkipsPausedSessions 暂停中的会话不被回收；恢复后重新开始计时，再次空闲超时后回收
+func TestReapSkipsPausedSessions(t *testing.T) {
+	withSessionLimits(t, SessionLimits{})
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	session, err := newTestSession(t, nil)
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	impl := session.GetImpl()
+	impl.now = func() time.Time { return clock }
+	drain(impl)
+
+	impl.Pause()
+	clock = clock.Add(time.Hour)
+	if reaped := reapIdle(time.Minute); len(reaped) != 0 || GetSession(session.ID) == nil {
+		t.Fatalf("暂停中的会话被回收: %v", reaped)
+	}
+
+	impl.Resume()
+	clock = clock.Add(30 * time.Second)
+	if reaped := reapIdle(time.Minute); len(reaped) != 0 {
+		t.Fatalf("恢复后未超时的会话被回收: %v", reaped)
+	}
+	clock = clock.Add(time.Minute)
+	if reaped := reapIdle(time.Minute); len(reaped) != 1 || reaped[0] != session.ID {
+		t.Fatalf("回收的会话 = %v，期望 [%d]", reaped, session.ID)
+	}
+}
+
+// TestListSessionsAndCleanupAll 列出会话的诊断信息；CleanupAll 中止并清理所有会话
+func TestListSessionsAndCleanupAll(t *testing.T) {
+	withSessionLimits(t, SessionLimits{})
+	closed := [2]bool{}
+	var ids [2]int
+	for i := range ids {
+		session, err := newTestSession(t, &closed[i])
+		if err != nil {
+			t.Fatalf("创建会话失败: %v", err)
+		}
+		ids[i] = session.ID
+	}
+	GetSession(ids[1]).GetImpl().Pause()
+
+	infos := ListSessions()
+	if len(infos) != 2 || infos[0].ID != ids[0] || infos[1].ID != ids[1] {
+		t.Fatalf("会话列表 = %+v，期望 ID %v", infos, ids)
+	}
+	if info := infos[1]; info.Mode != "send" || info.FilePath != "a.bin" || info.State != "sending_init" || !info.Paused || info.Callbacks {
+		t.Errorf("会话信息 = %+v", info)
+	}
+	data, err := json.Marshal(infos[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(data, &obj); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"callbacks", "file", "filePath", "id", "idleMs", "mode", "paused", "state", "total", "transferred"}
+	if got := jsonKeys(t, obj); !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON 字段 = %v，期望 %v", got, want)
+	}
+
+	if err := CleanupAll(); err != nil {
+		t.Fatalf("CleanupAll 失败: %v", err)
+	}
+	if infos := ListSessions(); len(infos) != 0 || !closed[0] || !closed[1] {
+		t.Errorf("清理后会话列表 = %+v，文件已关闭 = %v", infos, closed)
+	}
+}
@@ -0,0 +1,321 @@
+package zmodem
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileInfo 传输中的文件信息（对应 ZFILE 数据子包中的字段）
+type FileInfo struct {
+	Name    string      // 文件名（发送时为对方看到的名字，接收时为对方提供的名字）
+	Size    int64       // 文件大小，未知时为 0
+	ModTime time.Time   // 修改时间
+	Mode    os.FileMode // 权限位
+	Clobber bool        // 接收时：对方要求覆盖已有文件（ZFILE 的 ZF1 为 ZMCLOB，如 lrzsz 的 sz -y）
+}
+
+// FileSource 待发送的文件
+type FileSource interface {
+	io.ReaderAt
+	io.Closer
+	Info() FileInfo
+}
+
+// FileWriter 接收文件的写入目标
+// 文件完整收到（ZEOF 位置一致）后调用 Commit；跳过、出错或会话取消时调用 Abort。两者只会调用其一，且只调用一次
+type FileWriter interface {
+	io.WriterAt
+	Commit() error
+	Abort() error
+}
+
+// Sink 接收方为每个 ZFILE 创建写入目标
+// 返回 ErrSkipFile 表示跳过该文件，返回其他错误会中止整个会话
+type Sink interface {
+	Create(info FileInfo) (FileWriter, error)
+}
+
+// freeSpacer 可以报告剩余空间的 Sink（用于响应 ZFREECNT）
+type freeSpacer interface {
+	FreeSpace() (uint64, error)
+}
+
+// fileSource 基于本地文件的 FileSource
+type fileSource struct {
+	*os.File
+	info FileInfo
+}
+
+// OpenFileSource 打开本地文件作为发送源
+func OpenFileSource(path string) (FileSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("获取文件信息失败: %w", err)
+	}
+	return &fileSource{
+		File: f,
+		info: FileInfo{
+			Name:    filepath.Base(path),
+			Size:    stat.Size(),
+			ModTime: stat.ModTime(),
+			Mode:    stat.Mode().Perm(),
+		},
+	}, nil
+}
+
+// Info 返回文件信息
+func (s *fileSource) Info() FileInfo {
+	return s.info
+}
+
+// DirSink 将收到的文件保存到指定目录
+//
+// 对方提供的文件名只能落在 Dir 之内：绝对路径、".." 组件、设备名以及经由符号链接的逃逸
+// 都会被拒绝（该文件以 ZSKIP 跳过，结果中记录 ErrUnsafePath），允许的相对子目录会被创建。
+// 文件先写入同目录下的 "<目标文件名>.part"，完整收到后才重命名为目标文件，
+// 中断的传输不会留下看起来完整的文件，也不会破坏已有文件。
+type DirSink struct {
+	Dir string
+	// KeepPartial 传输失败时保留 .part 文件（供之后续传），默认删除
+	KeepPartial bool
+	// Collision 与已有文件同名时的处理方式，默认添加序号另存；
+	// 为默认的 CollisionRename 时，对方要求覆盖（FileInfo.Clobber）的文件直接覆盖
+	Collision CollisionPolicy
+}
+
+// NewDirSink 创建保存到目录 dir 的 Sink
+func NewDirSink(dir string) *DirSink {
+	return &DirSink{Dir: dir}
+}
+
+// Create 在目录中按同名文件策略选择目标文件，并创建（或续用）对应的 .part 临时文件
+func (s *DirSink) Create(info FileInfo) (FileWriter, error) {
+	target, err := resolveInRoot(s.Dir, info.Name)
+	if errors.Is(err, ErrUnsafePath) {
+		return nil, fmt.Errorf("%w: %w", ErrSkipFile, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	collision := s.Collision
+	if info.Clobber && collision == CollisionRename {
+		collision = CollisionOverwrite // 对方要求覆盖（sz -y）；宿主明确选择的跳过、续传不受影响
+	}
+
+	existing, statErr := os.Stat(target)
+	exists := statErr == nil
+	if exists && existing.IsDir() && collision != CollisionRename {
+		return nil, fmt.Errorf("%w: %q 是已存在的目录", ErrSkipFile, target)
+	}
+
+	resume := false
+	switch collision {
+	case CollisionRename:
+		if target, err = uniquePath(filepath.Dir(target), filepath.Base(target)); err != nil {
+			return nil, err
+		}
+	case CollisionSkip:
+		if exists {
+			return nil, ErrSkipFile
+		}
+	case CollisionResume:
+		if exists && info.Size > 0 && existing.Size() >= info.Size {
+			return nil, ErrSkipFile // 已有完整的文件
+		}
+		resume = true
+	}
+
+	w, err := createPartFile(target, resume, s.KeepPartial)
+	if errors.Is(err, ErrUnsafePath) {
+		return nil, fmt.Errorf("%w: %w", ErrSkipFile, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := w.setInfo(info); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+// FreeSpace 返回目录所在磁盘的剩余空间
+func (s *DirSink) FreeSpace() (uint64, error) {
+	return diskFreeSpace(s.Dir)
+}
+
+// partSuffix 下载过程中临时文件的后缀
+const partSuffix = ".part"
+
+// resumer 可以续传的 FileWriter：接收方以 ZRPOS 要求对方从 ResumeOffset 开始发送
+type resumer interface {
+	ResumeOffset() int64
+}
+
+// fileWriter 写入本地 .part 临时文件的 FileWriter，提交时重命名为目标文件
+type fileWriter struct {
+	*os.File
+	target      string
+	info        FileInfo
+	keepPartial bool
+	offset      int64 // 续传时 .part 中已有的数据长度
+}
+
+// createPartFile 为 target 创建 .part 临时文件；resume 为 true 时保留已有内容用于续传，否则重新创建
+//
+// 已有的 .part 必须是普通文件：预先放置的符号链接会让写入落到接收目录之外（返回 ErrUnsafePath）。
+// 新文件以 O_EXCL 创建，续用的文件以 O_NOFOLLOW 打开（Unix），检查之后被替换为链接也不会跟随。
+func createPartFile(target string, resume, keepPartial bool) (*fileWriter, error) {
+	part := target + partSuffix
+	fi, err := os.Lstat(part)
+	exists := err == nil
+	switch {
+	case exists && !fi.Mode().IsRegular():
+		return nil, fmt.Errorf("%w: 临时文件 %q 不是普通文件", ErrUnsafePath, part)
+	case exists && !resume:
+		if err := os.Remove(part); err != nil {
+			return nil, fmt.Errorf("删除旧的临时文件失败: %w", err)
+		}
+		exists = false
+	case err != nil && !os.IsNotExist(err):
+		return nil, fmt.Errorf("检查临时文件失败: %w", err)
+	}
+
+	flags := os.O_RDWR | oNoFollow
+	if !exists {
+		flags |= os.O_CREATE | os.O_EXCL
+	}
+	f, err := os.OpenFile(part, flags, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("获取临时文件信息失败: %w", err)
+	}
+	if !stat.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("%w: 临时文件 %q 不是普通文件", ErrUnsafePath, part)
+	}
+	return &fileWriter{File: f, target: target, keepPartial: keepPartial, offset: stat.Size()}, nil
+}
+
+// setInfo 设置对方提供的文件信息；已有数据比声明的大小还长时说明不是同一个文件，从头接收
+func (w *fileWriter) setInfo(info FileInfo) error {
+	w.info = info
+	if w.offset > 0 && info.Size > 0 && w.offset > info.Size {
+		if err := w.File.Truncate(0); err != nil {
+			return fmt.Errorf("截断临时文件失败: %w", err)
+		}
+		w.offset = 0
+	}
+	return nil
+}
+
+// ResumeOffset 返回续传的起始位置
+func (w *fileWriter) ResumeOffset() int64 {
+	return w.offset
+}
+
+// Commit 将数据刷到磁盘后把临时文件重命名为目标文件，并按对方提供的修改时间设置文件时间
+// 对方提供的权限位不会应用到本地文件，避免远端随意设置可执行权限。
+// 失败时与 Abort 一样按 keepPartial 删除或保留临时文件（之后不会再调用 Abort）
+func (w *fileWriter) Commit() error {
+	if err := w.commit(); err != nil {
+		if !w.keepPartial {
+			os.Remove(w.File.Name())
+		}
+		return err
+	}
+	if !w.info.ModTime.IsZero() {
+		os.Chtimes(w.target, w.info.ModTime, w.info.ModTime)
+	}
+	return nil
+}
+
+// commit 同步、关闭临时文件并重命名为目标文件
+func (w *fileWriter) commit() error {
+	if err := w.File.Sync(); err != nil {
+		w.File.Close()
+		return fmt.Errorf("同步文件失败: %w", err)
+	}
+	if err := w.File.Close(); err != nil {
+		return fmt.Errorf("关闭文件失败: %w", err)
+	}
+	if err := os.Rename(w.File.Name(), w.target); err != nil {
+		return fmt.Errorf("重命名文件失败: %w", err)
+	}
+	return nil
+}
+
+// Abort 关闭临时文件，按 keepPartial 删除或保留；目标文件不受影响
+func (w *fileWriter) Abort() error {
+	err := w.File.Close()
+	if !w.keepPartial {
+		os.Remove(w.File.Name())
+	}
+	return err
+}
+
+// pathSink C API 的下载目标：第一个文件写入宿主选择的路径，
+// 批量传输中的后续文件保存到同一目录（受 DirSink 的沙箱和同名文件策略约束）
+type pathSink struct {
+	path  string
+	dir   DirSink
+	first *fileWriter
+}
+
+// newPathSink 创建下载目标，立即创建临时文件以便尽早报告路径错误
+// 宿主选择的路径视为已确认覆盖；只有 "resume" 策略会影响第一个文件（续用已有的 .part）
+func newPathSink(path string, opts Options) (*pathSink, error) {
+	first, err := createPartFile(path, opts.Collision == CollisionResume, opts.KeepPartial)
+	if err != nil {
+		return nil, err
+	}
+	return &pathSink{
+		path:  path,
+		dir:   DirSink{Dir: filepath.Dir(path), KeepPartial: opts.KeepPartial, Collision: opts.Collision},
+		first: first,
+	}, nil
+}
+
+// Create 第一个文件使用预先创建的临时文件，之后的文件在同一目录中创建
+func (s *pathSink) Create(info FileInfo) (FileWriter, error) {
+	if s.first != nil {
+		w := s.first
+		s.first = nil
+		if err := w.setInfo(info); err != nil {
+			w.Abort()
+			return nil, err
+		}
+		return w, nil
+	}
+	return s.dir.Create(info)
+}
+
+// FreeSpace 返回目标目录所在磁盘的剩余空间
+func (s *pathSink) FreeSpace() (uint64, error) {
+	return s.dir.FreeSpace()
+}
+
+// Close 删除尚未使用的临时文件
+func (s *pathSink) Close() error {
+	if s.first != nil {
+		w := s.first
+		s.first = nil
+		w.keepPartial = w.offset > 0 // 续用的 .part 不删除
+		return w.Abort()
+	}
+	return nil
+}
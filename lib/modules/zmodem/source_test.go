@@ -0,0 +1,49 @@
+package zmodem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCommitFailureRemovesPart 提交失败（重命名失败）时按 KeepPartial 删除或保留 .part，会话以错误结束
+func TestCommitFailureRemovesPart(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		t.Run(map[bool]string{false: "remove", true: "keep partial"}[keep], func(t *testing.T) {
+			dir := t.TempDir()
+			target := filepath.Join(dir, "a.txt")
+			sink := SinkFunc(func(FileInfo) (FileWriter, error) {
+				w, err := createPartFile(target, false, keep)
+				if err != nil {
+					return nil, err
+				}
+				// 临时文件创建之后目标位置被一个非空目录占用，重命名必然失败
+				return w, os.MkdirAll(filepath.Join(target, "sub"), 0o755)
+			})
+			z := NewReceiver(sink, Options{KeepPartial: keep})
+			drain(z)
+
+			data := []byte("hello")
+			info := encodeFileInfo(FileInfo{Name: "a.txt", Size: int64(len(data))}, nameCodec{}, 0, 0)
+			feedReceiver(t, z,
+				BuildZFILEFrame(info, 0, 0, true, false),
+				append(BuildZDATAHeader(0, true, false), BuildDataSubpacket(data, ZCRCE, true, false)...),
+				BuildZEOFFrame(uint32(len(data)), true, false),
+			)
+
+			if state := z.GetState(); state != StateError {
+				t.Fatalf("状态 = %s，期望 error", state)
+			}
+			if results := z.Results(); len(results) != 1 || results[0].Err == nil || results[0].Completed {
+				t.Fatalf("传输结果 = %+v，期望提交失败", results)
+			}
+			_, err := os.Lstat(filepath.Join(dir, "a.txt.part"))
+			if keep && err != nil {
+				t.Fatalf("KeepPartial 时应保留 .part: %v", err)
+			}
+			if !keep && !os.IsNotExist(err) {
+				t.Fatalf("提交失败后 .part 未删除: %v", err)
+			}
+		})
+	}
+}
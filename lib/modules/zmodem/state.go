@@ -0,0 +1,125 @@
+package zmodem
+
+import "fmt"
+
+// State ZMODEM 会话的协议状态
+type State int
+
+const (
+	StateIdle              State = iota // 尚未开始
+	StateSendingInit                    // 上传：已发送 ZRQINIT，等待接收方的 ZRINIT
+	StateQueryingFreeSpace              // 上传：已发送 ZFREECNT，等待接收方返回剩余空间
+	StateSendingHeader                  // 上传：已发送 ZFILE，等待接收方确认起始位置
+	StateSendingData                    // 上传：正在发送文件数据
+	StateSendingEOF                     // 上传：已发送 ZEOF，等待接收方确认
+	StateSendingFin                     // 上传：已发送 ZFIN，等待接收方回复 ZFIN
+	StateReceivingHeader                // 下载：已发送 ZRINIT，等待 ZFILE
+	StateReceivingData                  // 下载：正在接收文件数据
+	StateWaitingOO                      // 下载：已回复 ZFIN，等待发送方的 "OO"
+	StateCompleted                      // 会话正常结束
+	StateError                          // 会话出错
+)
+
+var stateNames = map[State]string{
+	StateIdle:              "idle",
+	StateSendingInit:       "sending_init",
+	StateQueryingFreeSpace: "querying_free_space",
+	StateSendingHeader:     "sending_header",
+	StateSendingData:       "sending_data",
+	StateSendingEOF:        "sending_eof",
+	StateSendingFin:        "sending_fin",
+	StateReceivingHeader:   "receiving_header",
+	StateReceivingData:     "receiving_data",
+	StateWaitingOO:         "waiting_oo",
+	StateCompleted:         "completed",
+	StateError:             "error",
+}
+
+// String 返回状态名称（稳定的英文标识，可供宿主映射显示文案）
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+// stateTransitions 合法的状态转换表（同状态之间的转换总是允许的，用于更新原因）
+// 任何未结束的状态都可以转换到 StateError，因此不在表中重复列出
+var stateTransitions = map[State][]State{
+	StateIdle:              {StateSendingInit, StateReceivingHeader},
+	StateSendingInit:       {StateQueryingFreeSpace, StateSendingHeader, StateSendingFin},
+	StateQueryingFreeSpace: {StateSendingHeader, StateSendingFin},
+	StateSendingHeader:     {StateSendingData, StateSendingFin},
+	StateSendingData:       {StateSendingEOF, StateSendingHeader, StateSendingFin},
+	StateSendingEOF:        {StateSendingData, StateSendingHeader, StateSendingFin},
+	StateSendingFin:        {StateCompleted},
+	StateReceivingHeader:   {StateReceivingData, StateWaitingOO},
+	StateReceivingData:     {StateReceivingHeader, StateWaitingOO},
+	StateWaitingOO:         {StateCompleted},
+}
+
+// IsTerminal 是否为结束状态
+func (s State) IsTerminal() bool {
+	return s == StateCompleted || s == StateError
+}
+
+// CanTransition 判断是否允许从 s 转换到 to
+func (s State) CanTransition(to State) bool {
+	if s == to {
+		return !s.IsTerminal()
+	}
+	if to == StateError {
+		return !s.IsTerminal()
+	}
+	for _, next := range stateTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionStatus 将协议状态归并为宿主使用的会话状态
+func (s State) SessionStatus() SessionStatus {
+	switch s {
+	case StateIdle:
+		return StatusIdle
+	case StateCompleted:
+		return StatusCompleted
+	case StateError:
+		return StatusError
+	default:
+		return StatusActive
+	}
+}
+
+// StateInfo 状态详情：当前状态、最近一次转换的原因及当时的文件偏移
+type StateInfo struct {
+	State    State
+	Reason   string
+	Position int64
+}
+
+// setState 执行状态转换
+// reason 为英文短语（如 "waiting for receiver"），宿主可直接展示。
+// 非法转换说明引擎与对方的状态已不一致：未结束的会话以 ErrProtocol 结束，已结束的会话保持不变
+func (z *ZmodemImpl) setState(to State, reason string) {
+	if !z.state.CanTransition(to) {
+		z.logf(LogWarn, "拒绝非法状态转换: %s -> %s (%s)", z.state, to, reason)
+		if !z.state.IsTerminal() {
+			z.fail(fmt.Errorf("%w: 非法状态转换 %s -> %s", ErrProtocol, z.state, to))
+		}
+		return
+	}
+	if z.state != to {
+		z.logf(LogDebug, "状态转换: %s -> %s (%s)", z.state, to, reason)
+	}
+	entering := !z.state.IsTerminal() && to.IsTerminal()
+	z.state = to
+	z.stateReason = reason
+	z.statePosition = z.transferred
+	if entering {
+		z.stats.ended = z.now()
+		z.emitSessionEnd()
+	}
+}
@@ -0,0 +1,87 @@
+package zmodem
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestCanTransition 状态转换表中的合法与非法转换
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to State
+		want     bool
+	}{
+		// 上传
+		{StateIdle, StateSendingInit, true},
+		{StateSendingInit, StateQueryingFreeSpace, true},
+		{StateSendingInit, StateSendingHeader, true},
+		{StateQueryingFreeSpace, StateSendingHeader, true},
+		{StateSendingHeader, StateSendingData, true},
+		{StateSendingData, StateSendingEOF, true},
+		{StateSendingEOF, StateSendingData, true},
+		{StateSendingEOF, StateSendingHeader, true},
+		{StateSendingEOF, StateSendingFin, true},
+		{StateSendingFin, StateCompleted, true},
+		// 下载
+		{StateIdle, StateReceivingHeader, true},
+		{StateReceivingHeader, StateReceivingData, true},
+		{StateReceivingData, StateReceivingHeader, true},
+		{StateReceivingData, StateWaitingOO, true},
+		{StateWaitingOO, StateCompleted, true},
+		// 同状态与出错
+		{StateSendingData, StateSendingData, true},
+		{StateReceivingData, StateError, true},
+		{StateIdle, StateError, true},
+
+		// 非法：跳过步骤、上传与下载混用、从结束状态离开
+		{StateIdle, StateSendingData, false},
+		{StateIdle, StateCompleted, false},
+		{StateSendingInit, StateSendingData, false},
+		{StateSendingHeader, StateCompleted, false},
+		{StateSendingData, StateReceivingData, false},
+		{StateReceivingHeader, StateSendingHeader, false},
+		{StateReceivingHeader, StateCompleted, false},
+		{StateReceivingData, StateCompleted, false},
+		{StateWaitingOO, StateReceivingHeader, false},
+		{StateCompleted, StateCompleted, false},
+		{StateCompleted, StateError, false},
+		{StateCompleted, StateReceivingHeader, false},
+		{StateError, StateError, false},
+		{StateError, StateIdle, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransition(tt.to); got != tt.want {
+			t.Errorf("%s -> %s = %v，期望 %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+// TestIllegalTransitionFailsSession 未结束的会话遇到非法转换时以 ErrProtocol 结束，已结束的会话不受影响
+func TestIllegalTransitionFailsSession(t *testing.T) {
+	z := NewReceiver(NewMemorySink(), Options{})
+	drain(z)
+	if state := z.GetState(); state != StateReceivingHeader {
+		t.Fatalf("状态 = %s，期望 receiving_header", state)
+	}
+
+	z.mu.Lock()
+	z.setState(StateSendingData, "bogus")
+	z.mu.Unlock()
+	if state := z.GetState(); state != StateError {
+		t.Fatalf("非法转换后状态 = %s，期望 error", state)
+	}
+	if err := z.GetError(); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("错误 = %v，期望 ErrProtocol", err)
+	}
+	if out := drain(z); len(out) == 0 {
+		t.Fatal("非法转换后没有向对方发送取消序列")
+	}
+
+	reason := z.GetStateInfo().Reason
+	z.mu.Lock()
+	z.setState(StateReceivingHeader, "bogus")
+	z.mu.Unlock()
+	if info := z.GetStateInfo(); info.State != StateError || info.Reason != reason {
+		t.Fatalf("已结束的会话被修改: %+v", info)
+	}
+}
@@ -0,0 +1,127 @@
+package zmodem
+
+import "time"
+
+const (
+	// statsWindow 瞬时速度的统计窗口
+	statsWindow = 3 * time.Second
+	// statsSampleInterval 速度采样的最小间隔
+	statsSampleInterval = 100 * time.Millisecond
+)
+
+// TransferStats 会话的传输统计（C API 的 ZmodemGetStats 以 JSON 返回）
+type TransferStats struct {
+	Transferred    int64   `json:"transferred"`    // 当前文件已传输字节数
+	Total          int64   `json:"total"`          // 当前文件大小（0 表示未知）
+	Percent        float64 `json:"percent"`        // 当前文件的完成百分比
+	Bytes          int64   `json:"bytes"`          // 会话累计收发的文件数据（含重传）
+	ElapsedMs      int64   `json:"elapsedMs"`      // 会话开始至今（或至结束）的毫秒数
+	BytesPerSec    float64 `json:"bytesPerSec"`    // 最近 3 秒的速度
+	AvgBytesPerSec float64 `json:"avgBytesPerSec"` // 整个会话的平均速度
+	ETAMs          int64   `json:"etaMs"`          // 当前文件预计剩余毫秒数，-1 表示未知
+	Retransmits    int     `json:"retransmits"`    // 重传次数（与 retry 事件一致）
+	CRCErrors      int     `json:"crcErrors"`      // 收到的 CRC 错误的帧数
+	BlockSize      int     `json:"blockSize"`      // 最近一个数据子包的大小
+	Paused         bool    `json:"paused"`         // 已暂停（见 Pause）
+	RateLimit      int64   `json:"rateLimit"`      // 本会话的限速（字节/秒），0 表示不限速
+}
+
+// statsSample 速度采样：采样时间及当时累计的字节数
+type statsSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// transferStats 引擎内部的统计数据（由 z.mu 保护）
+type transferStats struct {
+	started     time.Time // 第一次输入或取出输出的时间
+	ended       time.Time // 会话结束的时间
+	bytes       int64
+	retransmits int
+	crcErrors   int
+	blockSize   int
+	samples     []statsSample // 统计窗口内的采样，按时间顺序
+}
+
+// start 记录会话开始的时间
+func (s *transferStats) start(now time.Time) {
+	if s.started.IsZero() {
+		s.started = now
+	}
+}
+
+// addData 记录一个数据子包
+func (s *transferStats) addData(now time.Time, n int) {
+	s.bytes += int64(n)
+	s.blockSize = n
+	if k := len(s.samples); k > 0 && now.Sub(s.samples[k-1].at) < statsSampleInterval {
+		return
+	}
+	// 丢弃窗口外的采样
+	i := 0
+	for i < len(s.samples) && now.Sub(s.samples[i].at) > statsWindow {
+		i++
+	}
+	s.samples = append(s.samples[i:], statsSample{at: now, bytes: s.bytes})
+}
+
+// rate 统计窗口内的速度，窗口内没有数据时为 0
+func (s *transferStats) rate(now time.Time) float64 {
+	for _, sample := range s.samples {
+		if now.Sub(sample.at) > statsWindow {
+			continue
+		}
+		if dt := now.Sub(sample.at).Seconds(); dt > 0 && s.bytes > sample.bytes {
+			return float64(s.bytes-sample.bytes) / dt
+		}
+		break
+	}
+	return 0
+}
+
+// Stats 获取传输统计
+func (z *ZmodemImpl) Stats() TransferStats {
+	z.mu.Lock()
+	defer z.unlock()
+	z.checkOOTimeout()
+
+	now := z.now()
+	s := &z.stats
+	out := TransferStats{
+		Transferred: z.transferred,
+		Total:       z.fileSize,
+		Bytes:       s.bytes,
+		ETAMs:       -1,
+		Retransmits: s.retransmits,
+		CRCErrors:   s.crcErrors,
+		BlockSize:   s.blockSize,
+		Paused:      z.paused,
+		RateLimit:   z.limiter.Rate(),
+	}
+	if z.fileSize > 0 {
+		out.Percent = float64(z.transferred) / float64(z.fileSize) * 100
+	}
+	if !s.started.IsZero() {
+		end := now
+		if !s.ended.IsZero() {
+			end = s.ended
+		}
+		elapsed := end.Sub(s.started)
+		out.ElapsedMs = elapsed.Milliseconds()
+		if elapsed > 0 {
+			out.AvgBytesPerSec = float64(s.bytes) / elapsed.Seconds()
+		}
+	}
+	if s.ended.IsZero() {
+		out.BytesPerSec = s.rate(now)
+	}
+
+	speed := out.BytesPerSec
+	if speed == 0 {
+		speed = out.AvgBytesPerSec
+	}
+	if remaining := z.fileSize - z.transferred; z.fileSize > 0 && remaining >= 0 && s.ended.IsZero() && !z.paused && speed > 0 {
+		out.ETAMs = int64(float64(remaining) / speed * 1000)
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+package zmodem
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTransferStatsRate 瞬时速度按最近 3 秒的采样计算，采样间隔至少 100ms，没有数据流动后归零
+func TestTransferStatsRate(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var s transferStats
+	for i := 0; i <= 10; i++ {
+		s.addData(t0.Add(time.Duration(i)*100*time.Millisecond), 1000)
+	}
+	if len(s.samples) != 11 {
+		t.Fatalf("采样数 = %d，期望 11", len(s.samples))
+	}
+	// 间隔不足 100ms 的数据只累计字节数，不增加采样
+	s.addData(t0.Add(1050*time.Millisecond), 500)
+	if len(s.samples) != 11 || s.bytes != 11500 {
+		t.Fatalf("采样数 = %d，字节数 = %d，期望 11 和 11500", len(s.samples), s.bytes)
+	}
+	if got := s.rate(t0.Add(time.Second + 50*time.Millisecond)); got < 9900 || got > 10500 {
+		t.Errorf("速度 = %.0f，期望约 10000 字节/秒", got)
+	}
+
+	// 窗口外的采样被丢弃
+	s.addData(t0.Add(5*time.Second), 1000)
+	if len(s.samples) != 1 {
+		t.Errorf("窗口外的采样没有丢弃: %d", len(s.samples))
+	}
+	if got := s.rate(t0.Add(10 * time.Second)); got != 0 {
+		t.Errorf("没有数据流动时速度 = %.0f，期望 0", got)
+	}
+}
+
+// TestStatsETA 预计剩余时间按最近的速度和当前文件的剩余字节计算
+func TestStatsETA(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	z := NewReceiver(NewMemorySink(), Options{})
+	z.now = func() time.Time { return clock }
+	drain(z)
+
+	data := testPayload(10000)
+	info := encodeFileInfo(FileInfo{Name: "a.bin", Size: int64(len(data))}, nameCodec{}, 0, 0)
+	feedReceiver(t, z,
+		BuildZFILEFrame(info, 0, 0, true, false),
+		append(BuildZDATAHeader(0, true, false), BuildDataSubpacket(data[:2000], ZCRCG, true, false)...),
+	)
+	clock = clock.Add(time.Second)
+	feedReceiver(t, z, BuildDataSubpacket(data[2000:4000], ZCRCG, true, false))
+
+	stats := z.Stats()
+	if stats.Transferred != 4000 || stats.Total != 10000 || stats.Percent != 40 {
+		t.Fatalf("进度 = %d/%d (%.0f%%)，期望 4000/10000 (40%%)", stats.Transferred, stats.Total, stats.Percent)
+	}
+	if stats.BytesPerSec != 2000 || stats.ETAMs != 3000 {
+		t.Errorf("速度 = %.0f，剩余 %dms，期望 2000 字节/秒、3000ms", stats.BytesPerSec, stats.ETAMs)
+	}
+	if stats.AvgBytesPerSec != 4000 || stats.ElapsedMs != 1000 || stats.BlockSize != 2000 {
+		t.Errorf("平均速度 = %.0f，耗时 %dms，块大小 %d，期望 4000、1000、2000", stats.AvgBytesPerSec, stats.ElapsedMs, stats.BlockSize)
+	}
+}
+
+// TestStatsCounters 传输中的数据错误计入双方的重传次数和接收方的 CRC 错误数，
+// 重传次数与 retry 事件一致；会话结束后耗时不再增长，速度归零
+func TestStatsCounters(t *testing.T) {
+	data := testPayload(100000)
+	sender := NewSender(memorySources([]loopFile{{"a.bin", data}}), Options{})
+	receiver := NewReceiver(NewMemorySink(), Options{})
+	l := newLoopback(t, sender, receiver)
+	l.toReceiver.latency = 10 * time.Millisecond
+	l.toSender.latency = 10 * time.Millisecond
+	l.toReceiver.impairments = []impairment{corruptAt(20000)}
+	l.run()
+
+	for name, z := range map[string]*ZmodemImpl{"sender": sender, "receiver": receiver} {
+		if z.GetState() != StateCompleted {
+			t.Fatalf("%s 状态 = %s (%v)", name, z.GetState(), z.GetError())
+		}
+		retries := 0
+		for _, ev := range pollAll(z) {
+			if ev.Type == EventRetry {
+				retries++
+			}
+		}
+		stats := z.Stats()
+		if stats.Retransmits == 0 || stats.Retransmits != retries {
+			t.Errorf("%s 重传次数 = %d，retry 事件 %d 个", name, stats.Retransmits, retries)
+		}
+		if stats.Transferred != int64(len(data)) || stats.Percent != 100 || stats.BlockSize == 0 {
+			t.Errorf("%s 统计 = %+v", name, stats)
+		}
+		if stats.ElapsedMs <= 0 || stats.BytesPerSec != 0 || stats.ETAMs != -1 {
+			t.Errorf("%s 结束后的统计 = %+v，期望耗时大于 0、速度为 0、剩余时间未知", name, stats)
+		}
+		l.clock = l.clock.Add(time.Minute)
+		if later := z.Stats(); later.ElapsedMs != stats.ElapsedMs {
+			t.Errorf("%s 会话结束后耗时仍在增长: %d -> %d", name, stats.ElapsedMs, later.ElapsedMs)
+		}
+	}
+
+	if got := receiver.Stats().CRCErrors; got == 0 {
+		t.Error("接收方没有记录 CRC 错误")
+	}
+	// 发送方重发了出错位置之后的数据
+	if got := sender.Stats().Bytes; got <= int64(len(data)) {
+		t.Errorf("发送方累计字节数 = %d，期望大于文件大小 %d（含重传）", got, len(data))
+	}
+}
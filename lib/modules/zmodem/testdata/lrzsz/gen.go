@@ -0,0 +1,391 @@
+//go:build ignore
+
+// gen.go 生成 lrzsz 互通语料
+//
+// 对端字节按 lrzsz 0.12.20（zm.c / lsz.c / lrz.c）的线路格式合成：十六进制帧头由 zshhdr 发出，
+// 二进制帧头和数据子包由 zsbhdr/zsdata32 经 zsendline 转义发出。转义规则与本库不同：
+// 默认不转义 CR，只有紧跟在 '@' 之后的 CR 才转义（turbo_escape 关闭时的行为），-e 时转义所有控制字符。
+//
+// 为了让语料能发现本库编码器的回归，这里不使用被测的 zmodem 包：协议常量按 zmodem.h 重新定义，
+// CRC-16 按 lrzsz crctab.c 的查表法（updcrc）计算，CRC-32 使用标准库 hash/crc32，帧头也在这里独立编码。
+//
+// 在 lib 目录下运行：go run ./modules/zmodem/testdata/lrzsz/gen.go
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	blockLen = 1024 // 38400 波特率及以上时 sz 的块大小
+	mtime    = 1700000000
+	mode     = 0o100644
+)
+
+// zmodem.h 中的常量
+const (
+	zpad   = '*'
+	zdle   = 0x18
+	zhex   = 'B'
+	zbin32 = 'C'
+	xon    = 0x11
+	xoff   = 0x13
+
+	zcrce = 'h'
+	zcrcg = 'i'
+	zcrcw = 'k'
+
+	zcresum = 3    // ZF0：续传（sz -r）
+	zmclob  = 4    // ZF1：覆盖已有文件（sz -y）
+	tescctl = 0x40 // ZSINIT 的 ZF0：要求转义控制字符
+)
+
+// 帧类型
+const (
+	zrqinit = 0
+	zrinit  = 1
+	zsinit  = 2
+	zack    = 3
+	zfile   = 4
+	zskip   = 5
+	zfin    = 8
+	zrpos   = 9
+	zdata   = 10
+	zeof    = 11
+)
+
+// crctab lrzsz crctab.c 的 CRC-16 表（多项式 0x1021）
+var crctab [256]uint16
+
+func init() {
+	for i := range crctab {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		crctab[i] = crc
+	}
+}
+
+// updcrc lrzsz 的 updcrc 宏：每次移入一个字节，计算结束时再移入两个 0
+func updcrc(cp byte, crc uint16) uint16 {
+	return crctab[crc>>8] ^ crc<<8 ^ uint16(cp)
+}
+
+// hexHeader zshhdr：ZPAD ZPAD ZDLE ZHEX + 小写十六进制的 type/hdr/CRC-16 + CR LF|0x80，除 ZFIN/ZACK 外追加 XON
+func hexHeader(t byte, hdr [4]byte) []byte {
+	const digits = "0123456789abcdef"
+	out := []byte{zpad, zpad, zdle, zhex}
+	raw := append([]byte{t}, hdr[:]...)
+	var crc uint16
+	for _, c := range raw {
+		crc = updcrc(c, crc)
+	}
+	crc = updcrc(0, updcrc(0, crc))
+	raw = append(raw, byte(crc>>8), byte(crc))
+	for _, c := range raw {
+		out = append(out, digits[c>>4], digits[c&0x0f])
+	}
+	out = append(out, '\r', '\n'|0x80)
+	if t != zfin && t != zack {
+		out = append(out, xon)
+	}
+	return out
+}
+
+// lrzszLine 模拟 zsendline：lastSent 为上一个经 zsendline 发出的字节
+type lrzszLine struct {
+	ctlEsc   bool
+	lastSent byte
+}
+
+func (l *lrzszLine) send(dst []byte, c byte) []byte {
+	escape := false
+	if c&0x60 == 0 {
+		switch c {
+		case zdle, xon, xoff, xon | 0x80, xoff | 0x80, 0x10, 0x90:
+			escape = true
+		case '\r', '\r' | 0x80:
+			escape = l.ctlEsc || l.lastSent&0x7f == '@'
+		default:
+			escape = l.ctlEsc
+		}
+	}
+	if escape {
+		dst = append(dst, zdle)
+		c ^= 0x40
+	}
+	l.lastSent = c
+	return append(dst, c)
+}
+
+func (l *lrzszLine) sendAll(dst []byte, data []byte) []byte {
+	for _, c := range data {
+		dst = l.send(dst, c)
+	}
+	return dst
+}
+
+// crc32Bytes CRC-32（小端）
+func crc32Bytes(data []byte) []byte {
+	crc := crc32.ChecksumIEEE(data)
+	return []byte{byte(crc), byte(crc >> 8), byte(crc >> 16), byte(crc >> 24)}
+}
+
+// binHeader zsbhdr：ZPAD ZDLE ZBIN32 + 转义后的 type/hdr/CRC-32
+func (l *lrzszLine) binHeader(t byte, hdr [4]byte) []byte {
+	raw := []byte{t, hdr[0], hdr[1], hdr[2], hdr[3]}
+	out := []byte{zpad, zdle, zbin32}
+	out = l.sendAll(out, raw)
+	return l.sendAll(out, crc32Bytes(raw))
+}
+
+// subpacket zsdata32：转义数据 + ZDLE end + 转义后的 CRC-32，ZCRCW 之后追加 XON
+func (l *lrzszLine) subpacket(data []byte, end byte) []byte {
+	out := l.sendAll(nil, data)
+	out = append(out, zdle, end)
+	out = l.sendAll(out, crc32Bytes(append(append([]byte{}, data...), end)))
+	if end == zcrcw {
+		out = append(out, xon)
+	}
+	return out
+}
+
+func pos(p int) [4]byte {
+	return [4]byte{byte(p), byte(p >> 8), byte(p >> 16), byte(p >> 24)}
+}
+
+// flags 线路顺序为 F3 F2 F1 F0
+func flags(f0, f1 byte) [4]byte {
+	return [4]byte{0, 0, f1, f0}
+}
+
+// file 语料中传输的文件
+type file struct {
+	name string
+	data []byte
+}
+
+// writer 逐行写出语料
+type writer struct {
+	b strings.Builder
+}
+
+func (w *writer) line(format string, args ...any) {
+	fmt.Fprintf(&w.b, format+"\n", args...)
+}
+
+func (w *writer) peer(data []byte) {
+	w.line("peer %s", quote(data))
+}
+
+// quote 按字节写成 Go 字符串字面量，不可打印字节一律为 \xNN（不合并为 \u 转义）
+func quote(data []byte) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range data {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// szOptions sz 的命令行选项
+type szOptions struct {
+	ctlEsc bool // -e
+	conv   byte // -r：ZCRESUM
+	manage byte // -y：ZMCLOB
+}
+
+// szSession 合成 "sz <files>" 的输出（本端为接收方）
+// resumeAt 为接收方对每个文件回复的 ZRPOS 位置
+func szSession(w *writer, files []file, resumeAt []int, o szOptions) {
+	l := &lrzszLine{ctlEsc: o.ctlEsc}
+	w.line("expect ZRINIT")
+	w.line("# sz 启动时输出 \"rz\\r\" 和 ZRQINIT")
+	w.peer(append([]byte("rz\r"), hexHeader(zrqinit, [4]byte{})...))
+	w.line("expect ZRINIT")
+
+	if o.ctlEsc {
+		w.line("# -e：接收方的 ZRINIT 没有 TESCCTL，sz 以 ZSINIT 要求转义控制字符（Attn 为空串）")
+		w.peer(append(l.binHeader(zsinit, flags(tescctl, 0)), l.subpacket([]byte{0}, zcrcw)...))
+		w.line("expect ZACK 1")
+	}
+
+	total := 0
+	for _, f := range files {
+		total += len(f.data)
+	}
+	for i, f := range files {
+		// wctxpn：文件名 NUL "%lu %lo %o 0 %d %ld" NUL
+		info := fmt.Sprintf("%s\x00%d %o %o 0 %d %d\x00", f.name, len(f.data), mtime, mode, len(files)-i, total)
+		total -= len(f.data)
+		w.line("# ZFILE %s", f.name)
+		w.peer(append(l.binHeader(zfile, flags(o.conv, o.manage)), l.subpacket([]byte(info), zcrcw)...))
+		start := resumeAt[i]
+		w.line("expect ZRPOS %d", start)
+
+		w.line("# ZDATA %d，每块 %d 字节，最后一块以 ZCRCE 结束", start, blockLen)
+		w.peer(l.binHeader(zdata, pos(start)))
+		for p := start; ; p += blockLen {
+			n := min(blockLen, len(f.data)-p)
+			end := byte(zcrcg)
+			if n < blockLen {
+				end = zcrce
+			}
+			w.peer(l.subpacket(f.data[p:p+n], end))
+			if end == zcrce {
+				break
+			}
+		}
+		w.peer(l.binHeader(zeof, pos(len(f.data))))
+		w.line("expect ZRINIT")
+	}
+
+	w.line("# saybibi：ZFIN，收到对方的 ZFIN 后输出 \"OO\"")
+	w.peer(hexHeader(zfin, [4]byte{}))
+	w.line("expect ZFIN")
+	w.peer([]byte("OO"))
+	w.line("end completed")
+}
+
+// rzReply rz 对每个 ZFILE 的回复
+type rzReply struct {
+	skip bool
+	pos  int
+}
+
+// rzSession 合成 "rz" 的回复（本端为发送方）
+func rzSession(w *writer, files []file, replies []rzReply) {
+	w.line("send %s", names(files))
+	w.line("expect ZRQINIT")
+	w.line("# rz 启动时的 ZRINIT 已被终端检测消费；这是 rz 对 ZRQINIT 的回复（CANFDX|CANOVIO|CANFC32）")
+	w.peer(hexHeader(zrinit, flags(0x23, 0)))
+	for i, f := range files {
+		w.line("expect ZFILE %s", f.name)
+		if replies[i].skip {
+			w.line("# 本地已有同名文件，rz 跳过")
+			w.peer(hexHeader(zskip, [4]byte{}))
+			continue
+		}
+		w.peer(hexHeader(zrpos, pos(replies[i].pos)))
+		w.line("expect ZDATA %d", replies[i].pos)
+		w.line("expect ZEOF %d", len(f.data))
+		w.peer(hexHeader(zrinit, flags(0x23, 0)))
+	}
+	w.line("expect ZFIN")
+	w.line("# ackbibi：回复 ZFIN 后等待 \"OO\"")
+	w.peer(hexHeader(zfin, [4]byte{}))
+	w.line("expect OO")
+	w.line("end completed")
+}
+
+func names(files []file) string {
+	var s []string
+	for _, f := range files {
+		s = append(s, f.name)
+	}
+	return strings.Join(s, " ")
+}
+
+// writeCase 写出 <名称>.transcript 及其 .files/.setup 目录
+func writeCase(dir, name, title string, body func(w *writer), files, setup []file) {
+	w := &writer{}
+	w.line("# %s", title)
+	w.line("# 按 lrzsz 0.12.20 的线路格式合成（gen.go），不是实际抓包")
+	body(w)
+	must(os.WriteFile(filepath.Join(dir, name+".transcript"), []byte(w.b.String()), 0o644))
+	for sub, list := range map[string][]file{".files": files, ".setup": setup} {
+		must(os.RemoveAll(filepath.Join(dir, name+sub)))
+		for _, f := range list {
+			must(os.MkdirAll(filepath.Join(dir, name+sub), 0o755))
+			must(os.WriteFile(filepath.Join(dir, name+sub, f.name), f.data, 0o644))
+		}
+	}
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	dir := filepath.Join("modules", "zmodem", "testdata", "lrzsz")
+
+	text := file{"a.txt", []byte("hello, lrzsz\n")}
+	// b.bin 恰好两块，覆盖所有字节值以及 "@\r"（lrzsz 只在 '@' 之后转义 CR）
+	bin := make([]byte, 0, 2*blockLen)
+	bin = append(bin, "login: user@\r\n@\r@\r\x18\x18"...)
+	for i := 0; len(bin) < 2*blockLen; i++ {
+		bin = append(bin, byte(i))
+	}
+	b := file{"b.bin", bin}
+	cdata := make([]byte, 3000)
+	for i := range cdata {
+		cdata[i] = byte(i*31 + 7)
+	}
+	c := file{"c.bin", cdata}
+
+	writeCase(dir, "sz-single", "sz a.txt", func(w *writer) {
+		w.line("mode receive")
+		szSession(w, []file{text}, []int{0}, szOptions{})
+	}, []file{text}, nil)
+
+	writeCase(dir, "sz-batch", "sz a.txt b.bin：ZFILE 中带剩余文件数和字节数", func(w *writer) {
+		w.line("mode receive")
+		szSession(w, []file{text, b}, []int{0, 0}, szOptions{})
+	}, []file{text, b}, nil)
+
+	writeCase(dir, "sz-escape", "sz -e b.bin：ZSINIT 要求转义，之后所有控制字符都被转义", func(w *writer) {
+		w.line("mode receive")
+		szSession(w, []file{b}, []int{0}, szOptions{ctlEsc: true})
+	}, []file{b}, nil)
+
+	writeCase(dir, "sz-overwrite", "sz -y a.txt：ZF1 = ZMCLOB，默认选项下覆盖已有的 a.txt", func(w *writer) {
+		w.line("mode receive")
+		szSession(w, []file{text}, []int{0}, szOptions{manage: zmclob})
+	}, []file{text}, []file{{"a.txt", []byte("old\n")}})
+
+	writeCase(dir, "sz-resume", "sz -r c.bin：ZF0 = ZCRESUM，从保留的 .part 文件续传", func(w *writer) {
+		w.line("mode receive")
+		w.line(`options {"collision":"resume"}`)
+		szSession(w, []file{c}, []int{blockLen}, szOptions{conv: zcresum})
+	}, []file{c}, []file{{"c.bin.part", cdata[:blockLen]}})
+
+	writeCase(dir, "rz-single", "rz，本端上传 a.txt", func(w *writer) {
+		w.line("mode send")
+		rzSession(w, []file{text}, []rzReply{{}})
+	}, []file{text}, nil)
+
+	writeCase(dir, "rz-batch", "rz，本端上传 a.txt b.bin c.bin，rz 跳过已存在的 c.bin", func(w *writer) {
+		w.line("mode send")
+		rzSession(w, []file{text, b, c}, []rzReply{{}, {}, {skip: true}})
+	}, []file{text, b, c}, nil)
+
+	writeCase(dir, "rz-resume", "rz，本端以 resume 上传 c.bin，rz 从已有的 1024 字节之后开始", func(w *writer) {
+		w.line("mode send")
+		w.line(`options {"resume":true}`)
+		rzSession(w, []file{c}, []rzReply{{pos: blockLen}})
+	}, []file{c}, nil)
+}
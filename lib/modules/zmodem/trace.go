@@ -0,0 +1,372 @@
+package zmodem
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// 记录文件格式（所有整数均为 uvarint）：
+//
+//	文件头: "ZTRACE\x01" | 头部长度 | 头部 JSON（traceHeader）
+//	记录:   类型（1 字节）| 距上一条记录的微秒数 | [缓冲区大小（仅 TraceOutput）] | 数据长度 | 数据
+//
+// 记录只包含引擎的输入输出，回放时按顺序重新输入并比较输出，因此与宿主、连接方式无关。
+const traceMagic = "ZTRACE\x01"
+
+// TraceKind 记录类型
+type TraceKind byte
+
+const (
+	TraceInput       TraceKind = '<' // 输入引擎的数据（FeedData）
+	TraceOutput      TraceKind = '>' // 引擎的输出（GetOutputData），没有输出但状态变化（如超时）时数据为空
+	TraceAbort       TraceKind = 'x' // Abort，数据为错误消息
+	TraceInputClosed TraceKind = 'e' // InputClosed，数据为错误消息（可为空）
+	TracePause       TraceKind = 'p' // Pause，没有数据
+	TraceResume      TraceKind = 'r' // Resume，没有数据
+	TraceRateLimit   TraceKind = 'l' // SetRateLimit，数据为十进制的限速（字节/秒）
+)
+
+// maxTraceChunk 单条记录的最大数据长度，用于拒绝损坏的记录文件
+const maxTraceChunk = 64 << 20
+
+// traceHeader 记录文件头部
+type traceHeader struct {
+	Mode    string    `json:"mode"` // "send" 或 "receive"
+	Options Options   `json:"options"`
+	Start   time.Time `json:"start"`
+}
+
+// TraceRecord 一条输入或输出记录
+type TraceRecord struct {
+	Kind TraceKind
+	At   time.Duration // 相对记录开始的时间
+	Cap  int           // TraceOutput：取输出时缓冲区的大小
+	Data []byte
+}
+
+// Trace 读取的会话记录
+type Trace struct {
+	Mode    int // modeSend 或 modeReceive（与 C API 的 mode 一致）
+	Options Options
+	Start   time.Time
+	Records []TraceRecord
+}
+
+// traceRecorder 将引擎的输入输出写入记录文件
+type traceRecorder struct {
+	w     io.Writer
+	start time.Time
+	last  time.Duration
+	buf   []byte
+}
+
+// StartTrace 开始把会话的输入输出记录到 w，w 实现 io.Closer 时在 Close 时关闭
+// 应在输入第一批数据之前调用，否则记录无法回放
+func (z *ZmodemImpl) StartTrace(w io.Writer) error {
+	z.mu.Lock()
+	defer z.unlock()
+	if z.trace != nil {
+		return errors.New("会话已在记录")
+	}
+
+	opts := z.opts
+	opts.Trace = ""
+	header := traceHeader{Mode: "receive", Options: opts, Start: z.now()}
+	if z.mode == modeSend {
+		header.Mode = "send"
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("编码记录头部失败: %w", err)
+	}
+
+	buf := append([]byte(traceMagic), binary.AppendUvarint(nil, uint64(len(data)))...)
+	if _, err := w.Write(append(buf, data...)); err != nil {
+		return fmt.Errorf("写入记录失败: %w", err)
+	}
+	z.trace = &traceRecorder{w: w, start: header.Start}
+	return nil
+}
+
+// StartTraceFile 开始把会话的输入输出记录到文件 path（已存在时覆盖）
+func (z *ZmodemImpl) StartTraceFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建记录文件失败: %w", err)
+	}
+	if err := z.StartTrace(f); err != nil {
+		f.Close()
+		return err
+	}
+	return nil
+}
+
+// stopTrace 停止记录并关闭记录文件（调用方持有 z.mu）
+func (z *ZmodemImpl) stopTrace() error {
+	t := z.trace
+	z.trace = nil
+	if t == nil {
+		return nil
+	}
+	if c, ok := t.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// traceData 记录一次输入或输出（调用方持有 z.mu）
+func (z *ZmodemImpl) traceData(kind TraceKind, capacity int, data []byte) {
+	if z.trace == nil {
+		return
+	}
+	if err := z.trace.record(kind, z.now(), capacity, data); err != nil {
+		// 记录失败不影响传输，停止记录即可
+		z.logf(LogWarn, "写入记录失败，停止记录: %v", err)
+		z.stopTrace()
+	}
+}
+
+// traceEvent 记录 Abort/InputClosed/Pause/Resume（调用方持有 z.mu）
+func (z *ZmodemImpl) traceEvent(kind TraceKind, err error) {
+	var msg []byte
+	if err != nil {
+		msg = []byte(err.Error())
+	}
+	z.traceData(kind, 0, msg)
+}
+
+// record 编码一条记录并以一次 Write 写出，进程崩溃时已写出的记录仍然完整
+func (t *traceRecorder) record(kind TraceKind, now time.Time, capacity int, data []byte) error {
+	at := now.Sub(t.start)
+	if at < t.last {
+		at = t.last
+	}
+	delta := (at - t.last) / time.Microsecond
+	t.last += delta * time.Microsecond
+	b := append(t.buf[:0], byte(kind))
+	b = binary.AppendUvarint(b, uint64(delta))
+	if kind == TraceOutput {
+		b = binary.AppendUvarint(b, uint64(capacity))
+	}
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	b = append(b, data...)
+	t.buf = b
+	_, err := t.w.Write(b)
+	return err
+}
+
+// ReadTrace 读取 StartTrace 写出的记录，末尾不完整的记录（如进程崩溃时）会被忽略
+func ReadTrace(r io.Reader) (*Trace, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(traceMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != traceMagic {
+		return nil, errors.New("不是有效的记录文件")
+	}
+	data, err := readTraceChunk(br)
+	if err != nil {
+		return nil, fmt.Errorf("读取记录头部失败: %w", err)
+	}
+	var header traceHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("解析记录头部失败: %w", err)
+	}
+
+	t := &Trace{Mode: modeReceive, Options: header.Options, Start: header.Start}
+	switch header.Mode {
+	case "send":
+		t.Mode = modeSend
+	case "receive":
+	default:
+		return nil, fmt.Errorf("未知的会话方向: %q", header.Mode)
+	}
+
+	var at time.Duration
+	for {
+		kind, err := br.ReadByte()
+		if err == io.EOF {
+			return t, nil
+		}
+		rec, err := readTraceRecord(br, TraceKind(kind))
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return t, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取第 %d 条记录失败: %w", len(t.Records), err)
+		}
+		at += rec.At
+		rec.At = at
+		t.Records = append(t.Records, rec)
+	}
+}
+
+// readTraceRecord 读取类型之后的记录内容，At 为距上一条记录的时间
+func readTraceRecord(br *bufio.Reader, kind TraceKind) (TraceRecord, error) {
+	rec := TraceRecord{Kind: kind}
+	switch kind {
+	case TraceInput, TraceOutput, TraceAbort, TraceInputClosed, TracePause, TraceResume, TraceRateLimit:
+	default:
+		return rec, fmt.Errorf("未知的记录类型: 0x%02x", byte(kind))
+	}
+	delta, err := binary.ReadUvarint(br)
+	if err != nil {
+		return rec, err
+	}
+	rec.At = time.Duration(delta) * time.Microsecond
+	if kind == TraceOutput {
+		capacity, err := binary.ReadUvarint(br)
+		if err != nil {
+			return rec, err
+		}
+		if capacity > maxTraceChunk {
+			return rec, fmt.Errorf("缓冲区大小无效: %d", capacity)
+		}
+		rec.Cap = int(capacity)
+	}
+	rec.Data, err = readTraceChunk(br)
+	return rec, err
+}
+
+// readTraceChunk 读取以长度开头的数据
+func readTraceChunk(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxTraceChunk {
+		return nil, fmt.Errorf("数据长度无效: %d", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ReplayConfig 回放使用的文件源和写入目标
+type ReplayConfig struct {
+	// Sources 回放发送会话时读取的文件（内容应与记录时相同）
+	Sources []FileSource
+	// Sink 回放接收会话时的写入目标，nil 表示保存到内存
+	Sink Sink
+}
+
+// ReplayResult 回放结果
+type ReplayResult struct {
+	State   State
+	Err     error
+	Results []FileResult
+	// Diff 第一处与记录不一致的输出，nil 表示所有输出都与记录相同
+	Diff *TraceDiff
+}
+
+// TraceDiff 回放输出与记录不一致之处
+type TraceDiff struct {
+	Record int // 记录下标
+	Offset int // 第一个不同字节在该条输出中的位置
+	Want   []byte
+	Got    []byte
+}
+
+func (d *TraceDiff) String() string {
+	return fmt.Sprintf("第 %d 条记录的输出在第 %d 字节处不同:\n  记录: %s\n  回放: %s",
+		d.Record, d.Offset, diffContext(d.Want, d.Offset), diffContext(d.Got, d.Offset))
+}
+
+// diffContext 返回 off 附近数据的十六进制表示
+func diffContext(data []byte, off int) string {
+	start, end := off-8, off+24
+	if start < 0 {
+		start = 0
+	}
+	if end > len(data) {
+		end = len(data)
+	}
+	if start >= end {
+		return fmt.Sprintf("(%d bytes)", len(data))
+	}
+	return fmt.Sprintf("(%d bytes) [%d:] % x", len(data), start, data[start:end])
+}
+
+// Replay 用记录的输入驱动一个新的引擎，并与记录的输出逐条比较
+// 时钟按记录中的时间推进，因此超时重试也会在相同的位置发生
+func (t *Trace) Replay(cfg ReplayConfig) (*ReplayResult, error) {
+	opts := t.Options
+	opts.Trace = ""
+
+	var z *ZmodemImpl
+	if t.Mode == modeSend {
+		if len(cfg.Sources) == 0 {
+			return nil, errors.New("回放发送会话需要提供文件源")
+		}
+		z = NewSender(cfg.Sources, opts)
+	} else {
+		sink := cfg.Sink
+		if sink == nil {
+			sink = NewMemorySink()
+		}
+		z = NewReceiver(sink, opts)
+	}
+	defer z.Close()
+
+	base := t.Start
+	clock := base
+	z.mu.Lock()
+	z.now = func() time.Time { return clock }
+	z.lastActivity = base
+	z.unlock()
+
+	result := &ReplayResult{}
+	for i, rec := range t.Records {
+		clock = base.Add(rec.At)
+		switch rec.Kind {
+		case TraceInput:
+			z.FeedData(rec.Data)
+		case TraceOutput:
+			buf := make([]byte, rec.Cap)
+			n, _ := z.GetOutputData(buf)
+			if result.Diff == nil && !bytes.Equal(buf[:n], rec.Data) {
+				result.Diff = &TraceDiff{Record: i, Offset: firstDiff(rec.Data, buf[:n]), Want: rec.Data, Got: buf[:n]}
+			}
+		case TraceAbort:
+			z.Abort(errors.New(string(rec.Data)))
+		case TraceInputClosed:
+			var err error
+			if len(rec.Data) > 0 {
+				err = errors.New(string(rec.Data))
+			}
+			z.InputClosed(err)
+		case TracePause:
+			z.Pause()
+		case TraceResume:
+			z.Resume()
+		case TraceRateLimit:
+			rate, err := strconv.ParseInt(string(rec.Data), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 条记录的限速无效: %w", i, err)
+			}
+			z.SetRateLimit(rate)
+		}
+	}
+
+	result.State = z.GetState()
+	result.Err = z.GetError()
+	result.Results = z.Results()
+	return result, nil
+}
+
+// firstDiff 返回 a、b 第一个不同字节的位置
+func firstDiff(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,199 @@
+package zmodem
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testPayload 生成确定的伪随机数据
+func testPayload(n int) []byte {
+	data := make([]byte, n)
+	x := uint32(2463534242)
+	for i := range data {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		data[i] = byte(x)
+	}
+	return data
+}
+
+// recordLoopback 记录一次带数据损坏的传输，返回发送方和接收方的记录
+func recordLoopback(t *testing.T, data []byte) (sendTrace, recvTrace []byte) {
+	t.Helper()
+	info := FileInfo{Name: "a.bin", Size: int64(len(data))}
+	sender := NewSender([]FileSource{NewMemorySource(info, data)}, Options{})
+	sink := NewMemorySink()
+	receiver := NewReceiver(sink, Options{MD5: true})
+
+	// 先连接（使用虚拟时钟）再开始记录，记录的时间与回放时一致
+	l := newLoopback(t, sender, receiver)
+	// 在数据中间翻转一个字节，触发 ZRPOS 重传
+	l.toReceiver.impairments = []impairment{corruptAt(int64(len(data) / 2))}
+
+	var sendBuf, recvBuf bytes.Buffer
+	if err := sender.StartTrace(&sendBuf); err != nil {
+		t.Fatal(err)
+	}
+	if err := receiver.StartTrace(&recvBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	l.run()
+	sender.Close()
+	receiver.Close()
+
+	retried := false
+	for e, ok := receiver.PollEvent(); ok; e, ok = receiver.PollEvent() {
+		retried = retried || e.Type == EventRetry
+	}
+	if !retried {
+		t.Fatal("损坏的数据应触发重传")
+	}
+
+	files := sink.Files()
+	if receiver.GetState() != StateCompleted || len(files) != 1 || !bytes.Equal(files[0].Data, data) {
+		t.Fatalf("传输失败: state=%s, err=%v", receiver.GetState(), receiver.GetError())
+	}
+	return sendBuf.Bytes(), recvBuf.Bytes()
+}
+
+func readTestTrace(t *testing.T, data []byte) *Trace {
+	t.Helper()
+	trace, err := ReadTrace(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadTrace: %v", err)
+	}
+	return trace
+}
+
+func TestTraceReplay(t *testing.T) {
+	data := testPayload(20000)
+	sendTrace, recvTrace := recordLoopback(t, data)
+
+	recv := readTestTrace(t, recvTrace)
+	if recv.Mode != modeReceive || !recv.Options.MD5 {
+		t.Fatalf("记录头部不正确: mode=%d, options=%+v", recv.Mode, recv.Options)
+	}
+	sink := NewMemorySink()
+	result, err := recv.Replay(ReplayConfig{Sink: sink})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Diff != nil {
+		t.Fatalf("接收方回放不一致: %s", result.Diff)
+	}
+	if result.State != StateCompleted || len(sink.Files()) != 1 || !bytes.Equal(sink.Files()[0].Data, data) {
+		t.Fatalf("接收方回放结果不正确: state=%s, err=%v", result.State, result.Err)
+	}
+
+	send := readTestTrace(t, sendTrace)
+	info := FileInfo{Name: "a.bin", Size: int64(len(data))}
+	if _, err := send.Replay(ReplayConfig{}); err == nil {
+		t.Fatal("回放发送会话时没有文件源应返回错误")
+	}
+	result, err = send.Replay(ReplayConfig{Sources: []FileSource{NewMemorySource(info, data)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Diff != nil {
+		t.Fatalf("发送方回放不一致: %s", result.Diff)
+	}
+	if result.State != StateCompleted {
+		t.Fatalf("发送方回放结果不正确: state=%s, err=%v", result.State, result.Err)
+	}
+}
+
+func TestTraceReplayDetectsDivergence(t *testing.T) {
+	data := testPayload(8000)
+	sendTrace, _ := recordLoopback(t, data)
+
+	// 文件内容与记录时不同，发送方的输出应在数据部分出现差异
+	changed := append([]byte(nil), data...)
+	changed[100] ^= 0xff
+	send := readTestTrace(t, sendTrace)
+	info := FileInfo{Name: "a.bin", Size: int64(len(data))}
+	result, err := send.Replay(ReplayConfig{Sources: []FileSource{NewMemorySource(info, changed)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Diff == nil {
+		t.Fatal("文件内容改变后回放应报告差异")
+	}
+	if d := result.Diff; send.Records[d.Record].Kind != TraceOutput || d.Offset >= len(d.Want) {
+		t.Fatalf("差异位置不正确: %s", d)
+	}
+}
+
+func TestReadTraceTruncated(t *testing.T) {
+	_, recvTrace := recordLoopback(t, testPayload(4000))
+	full := readTestTrace(t, recvTrace)
+
+	// 进程崩溃时最后一条记录可能不完整，应忽略而不是报错
+	truncated := readTestTrace(t, recvTrace[:len(recvTrace)-3])
+	if len(truncated.Records) != len(full.Records)-1 {
+		t.Fatalf("截断后应少一条记录: %d, %d", len(truncated.Records), len(full.Records))
+	}
+
+	if _, err := ReadTrace(strings.NewReader("not a trace")); err == nil {
+		t.Fatal("无效的记录文件应返回错误")
+	}
+}
+
+// TestReplayTestdata 回放 testdata/traces 中的记录：把用户提供的记录（选项 "trace"）放到该目录即可成为回归测试。
+// 发送会话的记录需要同名的 "<记录>.files" 目录提供原始文件，按文件名顺序作为文件源。
+func TestReplayTestdata(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "traces", "*.ztrace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			trace := readTestTrace(t, data)
+
+			var cfg ReplayConfig
+			if trace.Mode == modeSend {
+				cfg.Sources = openTraceSources(t, path+".files")
+			}
+			result, err := trace.Replay(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Diff != nil {
+				t.Fatalf("回放不一致: %s", result.Diff)
+			}
+		})
+	}
+}
+
+// openTraceSources 打开 dir 中的文件作为发送会话的文件源
+func openTraceSources(t *testing.T, dir string) []FileSource {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("发送会话的记录需要文件目录: %v", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	var sources []FileSource
+	for _, name := range names {
+		src, err := OpenFileSource(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
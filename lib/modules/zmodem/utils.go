@@ -20,13 +20,8 @@ func sanitizeFilename(filename string) string {
 	return string(result)
 }
 
-// extractBasename 从完整路径提取文件名
-func extractBasename(path string) string {
-	return filepath.Base(path)
-}
-
-// createSafeFile 创建安全文件名（避免覆盖系统文件）
-func createSafeFile(basePath string, suggestedName string) (*os.File, string, error) {
+// uniquePath 在 basePath 下为建议的文件名选择一个不存在的路径（已存在时添加序号）
+func uniquePath(basePath string, suggestedName string) (string, error) {
 	// 清理建议的文件名
 	safeName := sanitizeFilename(suggestedName)
 	if safeName == "" {
@@ -34,7 +29,7 @@ func createSafeFile(basePath string, suggestedName string) (*os.File, string, er
 	}
 
 	fullPath := filepath.Join(basePath, safeName)
-	
+
 	// 如果文件已存在，添加序号
 	counter := 1
 	for {
@@ -46,15 +41,8 @@ func createSafeFile(basePath string, suggestedName string) (*os.File, string, er
 		fullPath = filepath.Join(basePath, fmt.Sprintf("%s_%d%s", nameWithoutExt, counter, ext))
 		counter++
 		if counter > 1000 {
-			return nil, "", fmt.Errorf("无法创建文件：已存在太多同名文件")
+			return "", fmt.Errorf("无法创建文件：已存在太多同名文件")
 		}
 	}
-
-	file, err := os.Create(fullPath)
-	if err != nil {
-		return nil, "", fmt.Errorf("创建文件失败: %w", err)
-	}
-
-	return file, fullPath, nil
+	return fullPath, nil
 }
-
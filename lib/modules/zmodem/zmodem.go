@@ -3,598 +3,559 @@ package zmodem
 import (
 	"C"
 	"bytes"
-	"encoding/binary"
-	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
 	"sync"
 	"time"
 )
 
-// zmodemDebugLog 调试日志函数（共享）
-// 为了便于排查问题，这里**总是**写入到日志文件 `/tmp/zmodem-debug.log`，
-// 不再依赖 ZMODEM_DEBUG 环境变量。
-func zmodemDebugLog(format string, args ...interface{}) {
-	logFile := os.Getenv("ZMODEM_LOG_FILE")
-	if logFile == "" {
-		logFile = "/tmp/zmodem-debug.log"
-	}
+// 会话角色（与 C API 的 mode 参数一致）
+const (
+	modeSend    = 0 // upload (rz)：本端发送文件
+	modeReceive = 1 // download (sz)：本端接收文件
+)
 
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err == nil {
-		defer f.Close()
-		timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-		msg := fmt.Sprintf("[%s] %s\n", timestamp, fmt.Sprintf(format, args...))
-		f.WriteString(msg)
-		f.Sync() // 强制刷新到磁盘
-	}
+const (
+	// ooTimeout 回复 ZFIN 后等待发送方 "OO" 的最长时间，超时后直接视为会话结束
+	ooTimeout = time.Second
+	// retryInterval 等待对方响应的超时时间，超时后重发最近的帧头
+	retryInterval = 10 * time.Second
+	// maxRetries 连续重试的最大次数，超过后会话以 ErrTimeout 结束
+	maxRetries = 10
+	// maxTrailing 会话结束后为宿主保留的输入字节数上限（见 Trailing），超出部分丢弃
+	maxTrailing = 64 * 1024
+)
 
-	// 同时输出到 stderr，方便在开发环境直接观察
-	fmt.Fprintf(os.Stderr, "[ZMODEM] %s\n", fmt.Sprintf(format, args...))
+// FileResult 单个文件的传输结果
+type FileResult struct {
+	Name        string // 文件名
+	Size        int64  // 文件大小（接收时为对方声明的大小）
+	Transferred int64  // 实际传输的字节数（发送方未完成的文件为接收方最近确认的位置）
+	Skipped     bool   // 是否被对方或本端跳过
+	Completed   bool   // 是否完整传输（接收方已提交文件）
+	Err         error  // 该文件的错误（未出错时为 nil）
+	SHA256      string // 完整传输时文件内容的 SHA-256（十六进制）
+	MD5         string // 启用 Options.MD5 时文件内容的 MD5（十六进制）
 }
 
-// ZmodemImpl ZMODEM 实现接口
+// ZmodemImpl ZMODEM 协议引擎
+//
+// 引擎本身不做 I/O：FeedData 输入对方发来的数据，GetOutputData 取出需要发给对方的数据。
+// C API 直接以这种推/拉方式驱动；Go 代码可以使用 Send/Receive 在 io.ReadWriter 上运行。
 type ZmodemImpl struct {
-	file        *os.File
-	fileSize    int64
 	mu          sync.Mutex
-	readBuf     []byte       // 读取缓冲区
-	writeBuf    []byte       // 写入缓冲区
-	writePos    int          // 写入位置
-	inputBuf    bytes.Buffer // 输入缓冲区（累积接收的数据）
-	outputBuf   bytes.Buffer // 输出缓冲区（待发送的数据）
-	state       string       // 状态：idle, receiving_header, receiving_data, sending_header, sending_data, completed
-	transferred int64        // 已传输字节数
-	mode        int          // 0=upload, 1=download
-	parser      *FrameParser // 帧解析器
-	filename    string       // 文件名（从 ZFILE 帧提取）
-}
-
-// NewZmodemImpl 创建 ZMODEM 实现实例
-func NewZmodemImpl(mode int, filePath string) (*ZmodemImpl, error) {
-	impl := &ZmodemImpl{
-		mode:     mode,
-		state:    "idle",
-		parser:   NewFrameParser(),
-		filename: filePath, // 初始文件名
-	}
-	
-	// 测试日志（不依赖环境变量）
-	testLogFile := "/tmp/zmodem-debug.log"
-	if f, err := os.OpenFile(testLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
-		timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-		msg := fmt.Sprintf("[%s] [ZMODEM] NewZmodemImpl: mode=%d, filePath=%s\n", timestamp, mode, filepath.Base(filePath))
-		f.WriteString(msg)
-		f.Sync()
-		f.Close()
-	}
+	outputBuf   bytes.Buffer  // 输出缓冲区（待发送的数据）
+	state       State         // 协议状态（只能通过 setState 修改）
+	fileSize    int64         // 当前文件大小
+	transferred int64         // 当前文件已传输字节数（即当前文件偏移）
+	mode        int           // modeSend 或 modeReceive
+	parser      *FrameParser  // 帧解析器
+	filename    string        // 当前文件名
+	opts        Options       // 会话选项
+	names       nameCodec     // 远端文件名字符集转换
+	err         error         // 会话级错误（state 为 error 时有效）
+	ooDeadline  time.Time     // 等待发送方 "OO" 的截止时间（state 为 waiting_oo 时有效）
+	ooSeen      int           // 已连续收到的 'O' 个数
+	trailing    []byte        // 会话结束后收到的、不属于协议的输入（见 Trailing）
+	results     []FileResult  // 每个文件的传输结果，最后一个为当前文件
+	digest      *fileDigest   // 当前文件的摘要
+	events      []Event       // 等待宿主取出的事件（见 PollEvent）
+	stats       transferStats // 传输统计（见 Stats）
+	logs        []logEntry    // 持有 z.mu 期间排队的日志（见 unlock）
+	paused      bool          // 已暂停（见 Pause）
+	heldReply   []byte        // 暂停期间暂存的应答，恢复时发出
+	limiter     *RateLimiter  // 本会话的限速（见 SetRateLimit）
+	shared      *RateLimiter  // 所有会话共享的限速（见 SetSharedLimiter），nil 表示没有
+
+	stateReason   string // 最近一次状态转换的原因
+	statePosition int64  // 最近一次状态转换时的文件偏移
+
+	// 超时重试
+	lastHeader   []byte    // 最近发送的、需要对方响应的帧头，超时后重发
+	lastActivity time.Time // 最近一次收到有效帧（或发出数据）的时间
+	retries      int       // 连续重试次数
+	lastUsed     time.Time // 最近一次输入或输出的时间，用于回收空闲的会话
+
+	now   func() time.Time // 时钟（回放记录时使用记录中的时间）
+	trace *traceRecorder   // 协议数据记录（见 StartTrace），nil 表示未开启
+
+	sender
+	receiver
+}
 
-	var err error
-	if mode == 0 { // upload (rz) - 发送文件
-		impl.file, err = os.Open(filePath)
+// NewZmodemImpl 创建 C API 使用的 ZMODEM 会话
+// mode 为 0 时发送 filePath 指向的文件；为 1 时接收文件并保存到 filePath
+func NewZmodemImpl(mode int, filePath string, opts Options) (*ZmodemImpl, error) {
+	if mode == modeSend {
+		src, err := OpenFileSource(filePath)
 		if err != nil {
-			return nil, fmt.Errorf("打开文件失败: %w", err)
+			return nil, err
 		}
-		stat, err := impl.file.Stat()
-		if err != nil {
-			impl.file.Close()
-			return nil, fmt.Errorf("获取文件信息失败: %w", err)
-		}
-		impl.fileSize = stat.Size()
-
-		// 上传模式：准备发送 ZFILE 头
-		impl.state = "sending_header"
-		// 使用二进制格式的 ZFILE 帧
-		baseFilename := filepath.Base(filePath)
-		zfile := BuildZFILEFrameBinary(baseFilename, impl.fileSize)
-		impl.outputBuf.Write(zfile)
-		zmodemDebugLog("NewZmodemImpl: 初始 ZFILE 帧 hex=%x", zfile)
-		
-		// 测试日志
-		if f, err := os.OpenFile("/tmp/zmodem-debug.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
-			timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-			msg := fmt.Sprintf("[%s] [ZMODEM] NewZmodemImpl: 构建 ZFILE 帧，大小: %d bytes, 文件名: %s, 文件大小: %d\n", 
-				timestamp, len(zfile), baseFilename, impl.fileSize)
-			f.WriteString(msg)
-			f.Sync()
-			f.Close()
-		}
-	} else { // download (sz) - 接收文件
-		impl.file, err = os.Create(filePath)
-		if err != nil {
-			return nil, fmt.Errorf("创建文件失败: %w", err)
-		}
-		impl.state = "receiving_header"
-
-		// 下载模式：发送 ZRINIT 响应（使用二进制格式）
-		zrinit := BuildZRINITFrame()
-		impl.outputBuf.Write(zrinit)
+		return NewSender([]FileSource{src}, opts), nil
 	}
 
-	return impl, nil
-}
-
-// Read 读取数据
-func (z *ZmodemImpl) Read(p []byte) (int, error) {
-	z.mu.Lock()
-	defer z.mu.Unlock()
-	if z.file == nil {
-		return 0, io.EOF
+	sink, err := newPathSink(filePath, opts)
+	if err != nil {
+		return nil, err
 	}
-	return z.file.Read(p)
+	return NewReceiver(sink, opts), nil
 }
 
-// Write 写入数据
-func (z *ZmodemImpl) Write(p []byte) (int, error) {
-	z.mu.Lock()
-	defer z.mu.Unlock()
-	if z.file == nil {
-		return 0, fmt.Errorf("文件未打开")
+// newImpl 创建引擎的公共部分
+func newImpl(mode int, opts Options) *ZmodemImpl {
+	z := &ZmodemImpl{
+		mode:         mode,
+		state:        StateIdle,
+		parser:       NewFrameParser(),
+		opts:         opts,
+		names:        newNameCodec(opts.RemoteCharset),
+		limiter:      NewRateLimiter(opts.RateLimit),
+		lastActivity: time.Now(),
+		lastUsed:     time.Now(),
+		now:          time.Now,
 	}
-	return z.file.Write(p)
+	z.names.logf = z.logf
+	return z
 }
 
-// Close 关闭文件
+// Close 释放会话持有的文件
 func (z *ZmodemImpl) Close() error {
 	z.mu.Lock()
-	defer z.mu.Unlock()
-	if z.file != nil {
-		err := z.file.Close()
-		z.file = nil
-		return err
+	defer z.unlock()
+	traceErr := z.stopTrace()
+	var err error
+	if z.mode == modeSend {
+		err = z.closeSources()
+	} else {
+		err = z.closeReceiver()
 	}
-	return nil
+	if err == nil {
+		err = traceErr
+	}
+	return err
 }
 
-// GetFileSize 获取文件大小
+// GetFileSize 获取当前文件大小
 func (z *ZmodemImpl) GetFileSize() int64 {
 	z.mu.Lock()
-	defer z.mu.Unlock()
+	defer z.unlock()
 	return z.fileSize
 }
 
-// GetTransferred 获取已传输字节数
+// GetTransferred 获取当前文件已传输字节数
 func (z *ZmodemImpl) GetTransferred() int64 {
 	z.mu.Lock()
-	defer z.mu.Unlock()
+	defer z.unlock()
 	return z.transferred
 }
 
-// GetState 获取当前状态
-func (z *ZmodemImpl) GetState() string {
+// GetState 获取当前状态（等待 "OO" 超时时会在此推进到 completed）
+func (z *ZmodemImpl) GetState() State {
 	z.mu.Lock()
-	defer z.mu.Unlock()
+	defer z.unlock()
+	z.checkOOTimeout()
 	return z.state
 }
 
-// isControlChar 判断是否为控制字符或终端控制序列
-func isControlChar(b byte) bool {
-	// 跳过 ASCII 控制字符 (0x00-0x1F)，但保留换行符和回车符用于判断
-	if b < 0x20 && b != 0x0A && b != 0x0D {
-		return true
+// GetStateInfo 获取状态详情（当前状态、最近一次转换原因及偏移）
+func (z *ZmodemImpl) GetStateInfo() StateInfo {
+	z.mu.Lock()
+	defer z.unlock()
+	z.checkOOTimeout()
+	return StateInfo{
+		State:    z.state,
+		Reason:   z.stateReason,
+		Position: z.statePosition,
+	}
+}
+
+// GetError 获取会话级错误（未出错时返回 nil）
+func (z *ZmodemImpl) GetError() error {
+	z.mu.Lock()
+	defer z.unlock()
+	return z.err
+}
+
+// fileResultJSON FileResult 的 JSON 表示（C API 的 ZmodemGetResults 使用）
+type fileResultJSON struct {
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	Transferred int64     `json:"transferred"`
+	Skipped     bool      `json:"skipped"`
+	Completed   bool      `json:"completed"`
+	Error       string    `json:"error,omitempty"`
+	Code        ErrorCode `json:"code,omitempty"`
+	SHA256      string    `json:"sha256,omitempty"`
+	MD5         string    `json:"md5,omitempty"`
+}
+
+// MarshalJSON 以 JSON 输出传输结果，Err 输出为错误信息
+func (r FileResult) MarshalJSON() ([]byte, error) {
+	out := fileResultJSON{
+		Name:        r.Name,
+		Size:        r.Size,
+		Transferred: r.Transferred,
+		Skipped:     r.Skipped,
+		Completed:   r.Completed,
+		SHA256:      r.SHA256,
+		MD5:         r.MD5,
 	}
-	// 跳过 ANSI 转义序列开始符 (0x1B = ESC)
-	if b == 0x1B {
-		return true
+	if r.Err != nil {
+		out.Error = r.Err.Error()
+		out.Code = CodeOf(r.Err)
 	}
-	// 跳过 ZMODEM 协议控制字符
-	// ZDLE = 0x18, ZPAD = 0x2A (但 **B00 序列包含 0x2A，需要特殊处理)
-	// ZPAD2 = 0x4F, ZDLEE = 0x5E
-	if b == 0x18 || b == 0x4F || b == 0x5E {
-		return true
+	return json.Marshal(out)
+}
+
+// recordDigest 将当前文件的摘要记入传输结果
+func (z *ZmodemImpl) recordDigest() {
+	if r := z.currentResult(); r != nil && z.digest != nil {
+		r.SHA256, r.MD5 = z.digest.sums()
 	}
-	return false
 }
 
-// filterControlChars 过滤控制字符，只保留可打印字符和换行回车
-func filterControlChars(data []byte) []byte {
-	var result []byte
-	skipUntilNewline := false
+// Results 获取每个文件的传输结果
+func (z *ZmodemImpl) Results() []FileResult {
+	z.mu.Lock()
+	defer z.unlock()
+	return append([]FileResult(nil), z.results...)
+}
 
-	for _, b := range data {
-		// 如果遇到 ESC 序列，跳过直到换行
-		if b == 0x1B {
-			skipUntilNewline = true
-			continue
-		}
-		if skipUntilNewline {
-			if b == 0x0A || b == 0x0D {
-				skipUntilNewline = false
-			}
-			continue
+// Abort 中止会话：向对方发送取消序列，会话以 err 结束
+// 会话已结束时不做任何事
+func (z *ZmodemImpl) Abort(err error) {
+	z.mu.Lock()
+	defer z.unlock()
+	if z.state.IsTerminal() {
+		return
+	}
+	z.traceEvent(TraceAbort, err)
+	z.fail(err)
+}
+
+// InputClosed 通知引擎对方的数据流已结束
+// 等待 "OO" 时视为正常结束，其他未结束的状态视为连接中断
+func (z *ZmodemImpl) InputClosed(err error) {
+	z.mu.Lock()
+	defer z.unlock()
+	z.traceEvent(TraceInputClosed, err)
+	switch {
+	case z.state == StateWaitingOO:
+		z.setState(StateCompleted, "transfer complete")
+	case !z.state.IsTerminal():
+		if err == nil {
+			err = io.ErrUnexpectedEOF
 		}
+		z.fail(fmt.Errorf("%w: %w", ErrConnectionClosed, err))
+	}
+}
+
+// currentResult 返回当前文件的结果记录
+func (z *ZmodemImpl) currentResult() *FileResult {
+	if len(z.results) == 0 {
+		return nil
+	}
+	return &z.results[len(z.results)-1]
+}
 
-		// 保留可打印字符和换行回车
-		if b >= 0x20 && b < 0x7F || b == 0x0A || b == 0x0D {
-			result = append(result, b)
-		} else if !isControlChar(b) {
-			// 对于其他字符，如果不是明确的控制字符，也保留（可能是二进制数据）
-			result = append(result, b)
+// fail 将会话置为错误状态，并向对方发送取消序列
+// 错误通过 GetError 暴露，而不是直接从 FeedData 返回，保证取消序列能被宿主发送出去
+func (z *ZmodemImpl) fail(err error) {
+	if r := z.currentResult(); r != nil && r.Err == nil && !r.Skipped && !r.Completed {
+		if z.mode == modeSend {
+			z.recordAcked()
 		}
-		// 否则跳过控制字符
+		r.Err = err
+		z.emitFile(EventFileFailed, err.Error())
+	}
+	z.err = err
+	z.setState(StateError, err.Error())
+	if z.mode == modeReceive {
+		z.abortFile()
 	}
+	z.outputBuf.Write(BuildAbortSequence())
+	z.logf(LogError, "会话出错: %v", err)
+}
 
-	return result
+// sendHeader 发送一个需要对方响应的帧头，超时未收到响应时会重发
+func (z *ZmodemImpl) sendHeader(frame []byte) {
+	z.lastHeader = frame
+	z.reply(frame)
 }
 
-// parseZFILEFrame 解析 ZFILE 帧，提取文件名和文件信息
-func (z *ZmodemImpl) parseZFILEFrame(frame *ZmodemFrame) error {
-	// ZFILE 帧的数据格式：
-	// 文件名（以 \0 结尾）+ 文件大小（8字节，可选）+ 其他信息（权限等）
+// checkTimers 处理 "OO" 等待超时，以及等待对方响应的超时重试
+func (z *ZmodemImpl) checkTimers(now time.Time) {
+	z.checkOOTimeout()
+	if z.state.IsTerminal() || z.state == StateWaitingOO || z.state == StateIdle || z.paused {
+		return
+	}
+	if z.mode == modeSend && z.state == StateSendingData && !z.waitingAck {
+		return // 正在流式发送，不需要等待对方
+	}
+	if now.Sub(z.lastActivity) < retryInterval {
+		return
+	}
 
-	// 也可以从 F0-F3 字段获取信息
-	// F0 可能包含文件名长度的某些信息
-	// F1-F3 可能包含文件大小的高位字节
+	z.lastActivity = now
+	z.retries++
+	if z.retries > maxRetries {
+		z.fail(ErrTimeout)
+		return
+	}
+	z.logf(LogWarn, "等待对方响应超时，第 %d 次重试，状态: %s", z.retries, z.state)
+	z.retry(fmt.Sprintf("timeout in %s, attempt %d", z.state, z.retries))
+	if z.mode == modeSend {
+		z.retrySend()
+	} else {
+		z.retryReceive()
+	}
+}
 
-	// 方法1：从 Data 字段解析
-	if len(frame.Data) > 0 {
-		// 查找文件名（以第一个 \0 结尾）
-		nullIdx := -1
-		for i, b := range frame.Data {
-			if b == 0 {
-				nullIdx = i
-				break
-			}
+// timerDelay 距离 checkTimers 下一次需要处理超时的时间，没有待处理的超时时 ok 为 false
+func (z *ZmodemImpl) timerDelay() (d time.Duration, ok bool) {
+	z.mu.Lock()
+	defer z.unlock()
+	switch {
+	case z.state.IsTerminal() || z.state == StateIdle || z.paused:
+		return 0, false
+	case z.state == StateWaitingOO:
+		return z.ooDeadline.Sub(z.now()), true
+	case z.mode == modeSend && z.state == StateSendingData && !z.waitingAck:
+		// 正在流式发送，由输出驱动；受限速时在可以继续发送时醒来
+		if d := z.throttleDelay(z.now()); d > 0 {
+			return d, true
 		}
+		return 0, false
+	}
+	return z.lastActivity.Add(retryInterval).Sub(z.now()), true
+}
 
-		if nullIdx > 0 {
-			z.filename = string(frame.Data[:nullIdx])
+// answerFin 接收方响应 ZFIN：回 ZFIN 后等待发送方的 "OO"，
+// 在 "OO" 到达（或超时）之前不把会话标记为完成，避免 "OO" 漏到终端
+func (z *ZmodemImpl) answerFin() {
+	z.outputBuf.Write(BuildZFINFrame())
+	z.setState(StateWaitingOO, "closing session")
+	z.ooSeen = 0
+	z.ooDeadline = z.now().Add(ooTimeout)
+	z.logf(LogDebug, "收到 ZFIN，已回复 ZFIN，等待 OO")
+}
 
-			// 解析文件大小（如果有，在 \0 之后）
-			if nullIdx+1+8 <= len(frame.Data) {
-				sizeBytes := frame.Data[nullIdx+1 : nullIdx+1+8]
-				size := int64(binary.BigEndian.Uint64(sizeBytes))
-				if size > 0 {
-					z.fileSize = size
-				}
+// consumeOO 在 waiting_oo 状态下吞掉发送方紧跟在 ZFIN 之后的 "OO"，返回会话是否已结束
+// 只接受连续的两个 'O'（之前可以有 XON/XOFF）；遇到其他字节说明对方没有发送 "OO"，
+// 会话同样结束，该字节及之后的数据（如 shell 提示符）都留给宿主（见 Trailing）
+func (z *ZmodemImpl) consumeOO(data []byte) bool {
+	for i, b := range data {
+		switch {
+		case b == 'O':
+			z.ooSeen++
+			if z.ooSeen == 2 {
+				z.setState(StateCompleted, "transfer complete")
+				z.keepTrailing(data[i+1:])
+				return true
+			}
+		case z.ooSeen == 0 && (b == XON || b == XOFF):
+		default:
+			if z.ooSeen == 1 {
+				z.keepTrailing([]byte{'O'})
 			}
-		} else if len(frame.Data) > 0 {
-			// 没有找到 \0，整个数据都是文件名
-			z.filename = string(frame.Data)
+			z.setState(StateCompleted, "OO missing")
+			z.keepTrailing(data[i:])
+			return true
 		}
 	}
+	return false
+}
+
+// keepTrailing 保留会话结束后的输入，供宿主交还给终端
+func (z *ZmodemImpl) keepTrailing(data []byte) {
+	n := min(len(data), maxTrailing-len(z.trailing))
+	z.trailing = append(z.trailing, data[:n]...)
+}
 
-	// 方法2：从 F0-F3 字段获取文件大小（如果 Data 中没有）
-	if z.fileSize == 0 {
-		// F0-F3 可能包含文件大小的部分信息
-		// 简化：这里不解析，因为通常文件大小在 Data 字段中
+// Trailing 取出会话结束后收到的、不属于协议的数据（如 "OO" 之后的 shell 提示符），取出后清空
+// 会话结束后继续 FeedData 的数据也会保留在这里（最多 64KB）
+func (z *ZmodemImpl) Trailing() []byte {
+	z.mu.Lock()
+	defer z.unlock()
+	data := z.trailing
+	z.trailing = nil
+	return data
+}
+
+// checkOOTimeout 发送方可能不发 "OO"（或已丢失），超时后结束会话
+func (z *ZmodemImpl) checkOOTimeout() {
+	if z.state == StateWaitingOO && z.now().After(z.ooDeadline) {
+		z.setState(StateCompleted, "OO timed out")
 	}
+}
 
-	// 注意：z.filename 存储的是远程文件名（用于日志等）
-	// 实际文件路径已由 ZMODEMManager 在 start() 时通过对话框选择
-	// 这里不需要重新创建文件，只需记录文件名信息
+// zcomplRefused 拒绝执行远端命令时 ZCOMPL 返回的退出码（非 0 表示失败）
+const zcomplRefused = 1
 
-	return nil
+// refuseCommand 处理 ZCOMMAND：出于安全考虑从不执行远端命令，
+// 按协议以 ZCOMPL 返回失败状态，对方随后以 ZFIN 结束会话
+func (z *ZmodemImpl) refuseCommand(frame *ZmodemFrame) {
+	command := frame.Data
+	if i := bytes.IndexByte(command, 0); i >= 0 {
+		command = command[:i]
+	}
+	z.logf(LogWarn, "[SECURITY] 拒绝执行远端 ZCOMMAND: mode=%d, command=%q", z.mode, command)
+	z.outputBuf.Write(BuildZCOMPLFrame(zcomplRefused))
+}
+
+// answerChallenge 响应 ZCHALLENGE：将对方给出的随机数原样放入 ZACK 返回
+func (z *ZmodemImpl) answerChallenge(frame *ZmodemFrame) {
+	challenge := frame.Position()
+	z.logf(LogDebug, "响应 ZCHALLENGE: 0x%08x", challenge)
+	z.outputBuf.Write(BuildZACKFrame(challenge))
 }
 
 // FeedData 输入数据（从 SSH channel 接收）
+// 协议错误不会从这里返回，而是使会话进入 error 状态，并通过 GetOutputData 送出取消序列
 func (z *ZmodemImpl) FeedData(data []byte) error {
 	z.mu.Lock()
-	defer z.mu.Unlock()
-
-	// 测试日志（不依赖环境变量）
-	if f, err := os.OpenFile("/tmp/zmodem-debug.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
-		timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-		previewLen := len(data)
-		if previewLen > 32 {
-			previewLen = 32
-		}
-		msg := fmt.Sprintf("[%s] [ZMODEM] FeedData: mode=%d, state=%s, dataLen=%d, preview: %x\n", 
-			timestamp, z.mode, z.state, len(data), data[:previewLen])
-		f.WriteString(msg)
-		f.Sync()
-		f.Close()
-	}
-
-	// 累积接收的数据
-	z.inputBuf.Write(data)
-
-	if z.mode == 1 { // download (sz) - 接收文件
-		// 使用帧解析器解析 ZMODEM 帧
-		z.parser.AddData(data)
-
-		maxIterations := 100 // 防止无限循环
-		iteration := 0
-		for {
-			iteration++
-			if iteration > maxIterations {
-				break // 防止无限循环
-			}
+	defer z.unlock()
 
-			frame, err := z.parser.ParseFrame()
-			if err != nil {
-				// 解析错误，清理缓冲区
-				z.parser.CleanupBuffer()
-				// 不直接返回错误，继续尝试解析下一个帧
-				break
-			}
+	z.feed(data)
+	return nil
+}
 
-			if frame == nil {
-				// 没有更多完整帧
-				break
-			}
+// feed 解析输入数据并处理其中的帧（调用方持有 z.mu）
+func (z *ZmodemImpl) feed(data []byte) {
+	z.traceData(TraceInput, 0, data)
+	z.stats.start(z.now())
+	z.lastUsed = z.now()
+	if z.state.IsTerminal() {
+		// 会话已结束，后续数据不再属于协议，留给宿主
+		z.keepTrailing(data)
+		return
+	}
 
-			// 处理不同类型的帧
-			switch frame.Type {
-			case FrameZRQINIT:
-				// 请求初始化（发送方）
-				// 下载模式不应该收到这个，但为了兼容性处理
-
-			case FrameZSINIT:
-				// 发送方初始化
-				// 发送 ZACK 响应
-				zack := BuildZACKFrame(0)
-				z.outputBuf.Write(zack)
-
-			case FrameZFILE:
-				// 文件信息帧
-				z.parseZFILEFrame(frame)
-				z.state = "receiving_data"
-				// 发送 ZACK 确认（或 ZRPOS 如果支持断点续传）
-				zack := BuildZACKFrame(0)
-				z.outputBuf.Write(zack)
-
-			case FrameZDATA:
-				// 文件数据帧
-				if z.state == "receiving_data" && z.file != nil {
-					// 写入文件数据
-					// frame.Data 已经过 ZDLE 转义处理，可以直接写入
-					if len(frame.Data) > 0 {
-						n, err := z.file.Write(frame.Data)
-						if err != nil {
-							return fmt.Errorf("写入文件失败: %w", err)
-						}
-						z.transferred += int64(n)
-
-						// 发送确认（使用 ZRPOS 发送当前位置）
-						zrpos := BuildZRPOSFrame(uint32(z.transferred))
-						z.outputBuf.Write(zrpos)
-					}
-				} else if z.state == "receiving_header" {
-					// 如果还在接收头阶段就收到数据帧，可能需要先处理
-					// 这种情况不应该发生，但为了健壮性还是处理一下
-					z.state = "receiving_data"
-					if z.file != nil && len(frame.Data) > 0 {
-						n, err := z.file.Write(frame.Data)
-						if err == nil {
-							z.transferred += int64(n)
-						}
-					}
-				}
-
-			case FrameZEOF:
-				// 文件结束帧
-				if z.file != nil {
-					z.file.Sync() // 同步数据到磁盘
-				}
-				z.state = "completed"
-				// 发送 ZACK 确认
-				zack := BuildZACKFrame(uint32(z.transferred))
-				z.outputBuf.Write(zack)
-				// 发送 ZFIN 表示传输完成
-				zfin := BuildZFINFrame()
-				z.outputBuf.Write(zfin)
-
-			case FrameZFIN:
-				// 传输完成（另一方发送的）
-				z.state = "completed"
-				// 响应 ZFIN
-				zfin := BuildZFINFrame()
-				z.outputBuf.Write(zfin)
-
-			case FrameZRINIT:
-				// 接收方初始化（上传模式）
-
-			case FrameZACK:
-				// 确认帧（上传模式）
-				if z.state == "sending_header" {
-					z.state = "sending_data"
-				}
-
-			case FrameZNAK, FrameZABORT:
-				// 错误或取消
-				return fmt.Errorf("传输被拒绝或取消")
-
-			default:
-				// 忽略其他帧类型
-			}
+	if z.state == StateWaitingOO {
+		// 会话收尾：只消费发送方的 "OO"，其余字节不再按帧解析
+		z.consumeOO(data)
+		return
+	}
+
+	z.parser.AddData(data)
+	for !z.state.IsTerminal() && z.state != StateWaitingOO {
+		frame, err := z.parser.ParseFrame()
+		if err != nil {
+			// 出错的数据已被解析器丢弃，继续解析之后的数据
+			z.handleParseError(err)
+			continue
+		}
+		if frame == nil {
+			break
 		}
-		} else { // upload (rz) - 发送文件
-		// 使用帧解析器解析响应
-		zmodemDebugLog("FeedData (upload): 收到数据，长度: %d, 当前状态: %s", len(data), z.state)
-		z.parser.AddData(data)
-
-		maxIterations := 100 // 防止无限循环
-		iteration := 0
-		for {
-			iteration++
-			if iteration > maxIterations {
-				break // 防止无限循环
-			}
 
-			frame, err := z.parser.ParseFrame()
-			if err != nil {
-				// 解析错误，清理缓冲区，但不直接返回错误
-				// 因为可能是数据不完整，继续等待更多数据
-			// 输出调试信息（仅在调试模式下）
-			if os.Getenv("ZMODEM_DEBUG") == "1" {
-				fmt.Fprintf(os.Stderr, "[ZMODEM] 帧解析错误: %v, 数据长度: %d, hex: %s\n", err, len(data), hex.EncodeToString(data[:min(64, len(data))]))
-			}
-				z.parser.CleanupBuffer()
-				break
+		z.lastActivity = z.now()
+		z.retries = 0
+		switch frame.Type {
+		case FrameZCAN:
+			z.fail(ErrPeerCancelled)
+		case FrameZCHALLENGE:
+			// 对方校验我们是否为真实运行的程序
+			z.answerChallenge(frame)
+		case FrameZCOMMAND:
+			// 远端请求执行命令，始终拒绝
+			z.refuseCommand(frame)
+		default:
+			if z.mode == modeSend {
+				z.handleSenderFrame(frame)
+			} else {
+				z.handleReceiverFrame(frame)
 			}
+		}
+	}
 
-			if frame == nil {
-				// 没有更多完整帧
-				zmodemDebugLog("没有更多完整帧，缓冲区大小: %d", z.parser.GetBufferSize())
-				break
-			}
+	if z.state == StateWaitingOO {
+		// 同一批数据中 ZFIN 之后可能已经带上了 "OO"
+		z.consumeOO(z.parser.TakeBuffer())
+	} else if z.state == StateCompleted {
+		// 发送方收到 ZFIN 后会话结束，同一批数据中之后的字节属于终端
+		z.keepTrailing(z.parser.TakeBuffer())
+	}
+}
 
-			// 调试输出
-			zmodemDebugLog("解析到帧: Type=%d (0=ZRQINIT,1=ZRINIT,2=ZSINIT,3=ZACK,4=ZFILE,5=ZSKIP,6=ZNAK,7=ZABORT,8=ZFIN,9=ZRPOS,10=ZEOF,11=ZFERR,12=ZCRC,13=ZCHALLENGE,14=ZCOMPL,15=ZCAN,16=ZFREECNT,17=ZCOMMAND,18=ZSTDERR,19=ZDATA), FrameFormat=%d, State=%s, DataLen=%d", 
-				frame.Type, frame.FrameType, z.state, len(frame.Data))
-
-			switch frame.Type {
-			case FrameZRINIT:
-				// 接收方初始化，可以开始发送文件头（ZFILE）
-				// 如果还在 idle 或 sending_header 状态，确保 ZFILE 在输出缓冲区中
-				zmodemDebugLog("收到 ZRINIT，当前状态: %s, outputBuf长度: %d", z.state, z.outputBuf.Len())
-				if z.state == "idle" || z.state == "sending_header" {
-					// ZFILE 应该在 NewZmodemImpl 时已经写入 outputBuf
-					// 如果 outputBuf 为空，重新构建 ZFILE 帧
-					if z.outputBuf.Len() == 0 {
-						baseFilename := filepath.Base(z.filename)
-						zfile := BuildZFILEFrameBinary(baseFilename, z.fileSize)
-						z.outputBuf.Write(zfile)
-						zmodemDebugLog("重新构建 ZFILE 帧，大小: %d bytes, hex=%x", len(zfile), zfile)
-					}
-
-					// 兼容部分实现：收到 ZRINIT 后即可开始发送数据
-					// 标准协议通常通过 ZACK/ZRPOS 推进到 sending_data，但有些实现不会显式发送，
-					// 这里在首次 ZRINIT 且仍处于 sending_header 时，直接切换到 sending_data。
-					if z.state == "sending_header" {
-						z.state = "sending_data"
-						zmodemDebugLog("状态转换: sending_header -> sending_data (通过 ZRINIT 兼容路径)")
-					}
-				}
-
-			case FrameZACK:
-				// 确认，可以继续发送数据
-				// ZACK 帧的数据部分可能包含位置信息（4字节）
-				zmodemDebugLog("收到 ZACK，当前状态: %s, DataLen: %d", z.state, len(frame.Data))
-				if len(frame.Data) >= 4 {
-					// 解析位置信息（可选，用于断点续传）
-					position := binary.BigEndian.Uint32(frame.Data[:4])
-					zmodemDebugLog("ZACK 位置信息: %d", position)
-					_ = position // 暂时不使用
-				}
-				if z.state == "sending_header" {
-					z.state = "sending_data"
-					zmodemDebugLog("状态转换: sending_header -> sending_data (通过 ZACK)")
-				} else if z.state == "sending_eof" {
-					// 收到 ZEOF 的确认，传输完成
-					z.state = "completed"
-					zmodemDebugLog("状态转换: sending_eof -> completed")
-				}
-
-			case FrameZRPOS:
-				// 接收方发送位置信息（支持断点续传）
-				// ZRPOS 帧的数据部分包含位置信息（4字节）
-				zmodemDebugLog("收到 ZRPOS，当前状态: %s, DataLen: %d", z.state, len(frame.Data))
-				if len(frame.Data) >= 4 {
-					position := binary.BigEndian.Uint32(frame.Data[:4])
-					zmodemDebugLog("ZRPOS 位置信息: %d", position)
-					_ = position // 暂时不使用
-				}
-				// 如果状态还是 sending_header，说明这是对 ZFILE 的响应
-				if z.state == "sending_header" {
-					z.state = "sending_data"
-					zmodemDebugLog("状态转换: sending_header -> sending_data (通过 ZRPOS)")
-				}
-				// 可以在这里实现断点续传逻辑
-
-			case FrameZNAK, FrameZABORT:
-				// 错误或取消
-				return fmt.Errorf("传输被拒绝或取消")
-
-			default:
-				// 忽略其他帧
-			}
-		}
+// handleParseError 处理帧解析错误
+func (z *ZmodemImpl) handleParseError(err error) {
+	z.logf(LogWarn, "帧解析错误: %v, 状态: %s", err, z.state)
+	if errors.Is(err, errBadCRC) {
+		z.stats.crcErrors++
 	}
+	if z.mode == modeReceive && z.state == StateReceivingData {
+		// 数据损坏，要求发送方从当前位置重传
+		z.requestRetransmit(parseErrorReason(err))
+	}
+}
 
-	return nil
+// parseErrorReason 解析错误对应的英文短语（用于 retry 事件）
+func parseErrorReason(err error) string {
+	switch {
+	case errors.Is(err, errBadCRC):
+		return "bad CRC"
+	case errors.Is(err, errBadEscape):
+		return "bad escape sequence"
+	case errors.Is(err, errSubpacketTooLong):
+		return "subpacket too long"
+	default:
+		return "frame error"
+	}
 }
 
 // GetOutputData 获取输出数据（需要发送到 SSH channel）
+// 发送数据时按需从文件读取并生成数据子包，直到填满 buffer
 func (z *ZmodemImpl) GetOutputData(buffer []byte) (int, error) {
 	z.mu.Lock()
-	defer z.mu.Unlock()
-
-	// 优先发送输出缓冲区中的数据
-	if z.outputBuf.Len() > 0 {
-		n, _ := z.outputBuf.Read(buffer)
-		if n > 0 {
-			zmodemDebugLog("GetOutputData: 从 outputBuf 读取 %d bytes, 状态: %s, 读取后 outputBuf 长度: %d", n, z.state, z.outputBuf.Len())
-			return n, nil
-		}
-	}
+	defer z.unlock()
 
-	// 上传模式：发送文件头或文件数据
-	if z.mode == 0 && z.file != nil {
-		// 如果还在发送头阶段，优先发送 outputBuf 中的 ZFILE 帧
-		if z.state == "sending_header" {
-			// 如果 outputBuf 为空，说明 ZFILE 已经发送完，等待响应
-			if z.outputBuf.Len() == 0 {
-				return 0, nil
-			}
-			// 否则继续发送 outputBuf 中的数据（ZFILE 帧）
-		}
+	return z.readOutput(buffer), nil
+}
 
-		// 发送文件数据（在 sending_data 状态）
-		if z.state == "sending_data" {
-			// 从文件读取数据块（ZMODEM 通常使用 1024 字节的块）
-			readBuf := make([]byte, 1024)
-			n, err := z.file.Read(readBuf)
-			if err != nil && err != io.EOF {
-				return 0, fmt.Errorf("读取文件失败: %w", err)
-			}
+// Process 输入 input 中的全部数据，并取出最多 len(out) 字节的输出
+// more 为 true 表示还有输出没有取完（缓冲区已满，或发送方还可以继续生成数据），应以空输入再次调用
+func (z *ZmodemImpl) Process(input, out []byte) (n int, more bool, err error) {
+	z.mu.Lock()
+	defer z.unlock()
 
-			if n > 0 {
-				// 构建 ZDATA 帧（二进制格式）
-				zdataFrame := BuildZDATAFrame(readBuf[:n], uint32(z.transferred))
-
-				zmodemDebugLog("GetOutputData: 构建 ZDATA 帧，数据大小: %d bytes, 已传输: %d/%d, 帧总长: %d", n, z.transferred, z.fileSize, len(zdataFrame))
-
-				// 检查 buffer 大小
-				if len(buffer) < len(zdataFrame) {
-					// Buffer 太小，写入到输出缓冲区
-					z.outputBuf.Write(zdataFrame)
-					// 从输出缓冲区读取部分数据
-					nRead, _ := z.outputBuf.Read(buffer)
-					z.transferred += int64(n)
-					zmodemDebugLog("GetOutputData: buffer 较小，先写入 outputBuf 再读出 %d bytes, 当前 transferred=%d", nRead, z.transferred)
-					return nRead, nil
-				}
-
-				// 直接复制到 buffer
-				copy(buffer, zdataFrame)
-				z.transferred += int64(n)
-				zmodemDebugLog("GetOutputData: 直接写入 ZDATA 帧到 buffer，帧长=%d, 本次数据=%d, 累计 transferred=%d", len(zdataFrame), n, z.transferred)
-
-				if err == io.EOF {
-					// 文件结束，准备发送 ZEOF
-					if z.outputBuf.Len() == 0 {
-						zeof := BuildZEOFFrame(uint32(z.transferred))
-						z.outputBuf.Write(zeof)
-						z.state = "sending_eof"
-						zmodemDebugLog("GetOutputData: 文件读取完成，准备发送 ZEOF，transferred=%d", z.transferred)
-					}
-				}
-
-				return len(zdataFrame), nil
-			}
+	if len(input) > 0 {
+		z.feed(input)
+	}
+	n = z.readOutput(out)
+	return n, z.outputPending(), nil
+}
 
-			if err == io.EOF {
-				// 文件读取完成，发送 ZEOF
-				if z.outputBuf.Len() == 0 {
-					if z.transferred > 0 {
-						zeof := BuildZEOFFrame(uint32(z.transferred))
-						z.outputBuf.Write(zeof)
-					} else {
-						// 空文件，也发送 ZEOF
-						zeof := BuildZEOFFrame(0)
-						z.outputBuf.Write(zeof)
-					}
-					z.state = "sending_eof"
-					zmodemDebugLog("GetOutputData: EOF 后生成 ZEOF 帧，state=sending_eof, transferred=%d", z.transferred)
-				}
-			}
+// readOutput 处理超时并取出输出数据（调用方持有 z.mu）
+func (z *ZmodemImpl) readOutput(buffer []byte) int {
+	state := z.state
+	z.stats.start(z.now())
+	z.checkTimers(z.now())
+	if z.mode == modeSend {
+		for z.outputBuf.Len() < len(buffer) && z.canFill() {
+			z.fillData()
 		}
 	}
 
-	zmodemDebugLog("GetOutputData: 无数据可发送，state=%s, outputBufLen=%d", z.state, z.outputBuf.Len())
-	return 0, nil
+	n, _ := z.outputBuf.Read(buffer)
+	if n > 0 {
+		z.lastUsed = z.now()
+	}
+	if n > 0 || z.state != state {
+		// 没有输出也没有状态变化的轮询不影响回放，不记录
+		z.traceData(TraceOutput, len(buffer), buffer[:n])
+	}
+	return n
+}
+
+// canFill 发送方当前是否可以继续生成数据子包
+func (z *ZmodemImpl) canFill() bool {
+	return z.state == StateSendingData && !z.waitingAck && !z.paused && z.throttleDelay(z.now()) == 0
+}
+
+// outputPending 是否还有待取出的输出（调用方持有 z.mu）
+func (z *ZmodemImpl) outputPending() bool {
+	return z.outputBuf.Len() > 0 || (z.mode == modeSend && z.canFill())
 }
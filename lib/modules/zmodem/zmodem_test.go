@@ -0,0 +1,239 @@
+package zmodem
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+// drain 取出引擎的全部输出
+func drain(z *ZmodemImpl) []byte {
+	var out []byte
+	buf := make([]byte, 4096)
+	for {
+		n, _ := z.GetOutputData(buf)
+		if n == 0 {
+			return out
+		}
+		out = append(out, buf[:n]...)
+	}
+}
+
+// feedReceiver 依次向接收方输入每段数据，每段之后取出输出
+func feedReceiver(t *testing.T, z *ZmodemImpl, chunks ...[]byte) {
+	t.Helper()
+	for _, chunk := range chunks {
+		if err := z.FeedData(chunk); err != nil {
+			t.Fatalf("输入数据失败: %v", err)
+		}
+		drain(z)
+	}
+}
+
+// receiveUntilFin 让接收方完整收到一个文件，并停在发送方发出 ZFIN 之前
+func receiveUntilFin(t *testing.T, data []byte) (*ZmodemImpl, *MemorySink) {
+	t.Helper()
+	sink := NewMemorySink()
+	z := NewReceiver(sink, Options{})
+	drain(z)
+	info := encodeFileInfo(FileInfo{Name: "a.txt", Size: int64(len(data))}, nameCodec{}, 0, 0)
+	feedReceiver(t, z,
+		BuildZFILEFrame(info, 0, 0, true, false),
+		append(BuildZDATAHeader(0, true, false), BuildDataSubpacket(data, ZCRCE, true, false)...),
+		BuildZEOFFrame(uint32(len(data)), true, false),
+	)
+	if files := sink.Files(); len(files) != 1 || !bytes.Equal(files[0].Data, data) {
+		t.Fatalf("文件接收失败: %+v", files)
+	}
+	return z, sink
+}
+
+// TestReceiverOO 只吞掉紧跟 ZFIN 的连续 "OO"，其余数据通过 Trailing 交还给宿主
+func TestReceiverOO(t *testing.T) {
+	fin := BuildZFINFrame()
+	tests := []struct {
+		name         string
+		chunks       [][]byte
+		wantReason   string
+		wantTrailing string
+	}{
+		{
+			name:         "OO and prompt in one chunk",
+			chunks:       [][]byte{append(append(fin, "OO"...), "user@host:~$ "...)},
+			wantReason:   "transfer complete",
+			wantTrailing: "user@host:~$ ",
+		},
+		{
+			name:         "OO split from prompt",
+			chunks:       [][]byte{fin, []byte("O"), []byte("O\r\n$ ")},
+			wantReason:   "transfer complete",
+			wantTrailing: "\r\n$ ",
+		},
+		{
+			name:         "XON before OO",
+			chunks:       [][]byte{fin, {XON, 'O', 'O', '$'}},
+			wantReason:   "transfer complete",
+			wantTrailing: "$",
+		},
+		{
+			name:         "no OO, prompt contains O",
+			chunks:       [][]byte{append(fin, "root@BOOT:~$ "...)},
+			wantReason:   "OO missing",
+			wantTrailing: "root@BOOT:~$ ",
+		},
+		{
+			name:         "single O",
+			chunks:       [][]byte{fin, []byte("Ok\r\n")},
+			wantReason:   "OO missing",
+			wantTrailing: "Ok\r\n",
+		},
+		{
+			name:         "data after completion",
+			chunks:       [][]byte{append(fin, "OO$ "...), []byte("ls\r\n")},
+			wantReason:   "transfer complete",
+			wantTrailing: "$ ls\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z, _ := receiveUntilFin(t, []byte("hello"))
+			feedReceiver(t, z, tt.chunks...)
+
+			info := z.GetStateInfo()
+			if info.State != StateCompleted || info.Reason != tt.wantReason {
+				t.Fatalf("状态 = %s (%s)，期望 completed (%s)", info.State, info.Reason, tt.wantReason)
+			}
+			if got := string(z.Trailing()); got != tt.wantTrailing {
+				t.Fatalf("Trailing = %q，期望 %q", got, tt.wantTrailing)
+			}
+			if got := z.Trailing(); len(got) != 0 {
+				t.Fatalf("取出后 Trailing 应为空，实际为 %q", got)
+			}
+		})
+	}
+}
+
+// TestReceiverFinDuringData 文件未收完时收到 ZFIN，该文件记为失败并发出 file_failed 事件
+func TestReceiverFinDuringData(t *testing.T) {
+	sink := NewMemorySink()
+	z := NewReceiver(sink, Options{})
+	drain(z)
+	info := encodeFileInfo(FileInfo{Name: "a.txt", Size: 10}, nameCodec{}, 0, 0)
+	feedReceiver(t, z,
+		BuildZFILEFrame(info, 0, 0, true, false),
+		append(BuildZDATAHeader(0, true, false), BuildDataSubpacket([]byte("hello"), ZCRCE, true, false)...),
+		append(BuildZFINFrame(), "OO"...),
+	)
+
+	if state := z.GetState(); state != StateCompleted {
+		t.Fatalf("状态 = %s，期望 completed", state)
+	}
+	results := z.Results()
+	if len(results) != 1 || !errors.Is(results[0].Err, ErrPeerCancelled) || results[0].Completed {
+		t.Fatalf("传输结果 = %+v，期望因 ErrPeerCancelled 失败", results)
+	}
+	if files := sink.Files(); len(files) != 0 {
+		t.Fatalf("未收完的文件不应提交: %+v", files)
+	}
+
+	failed := false
+	for {
+		ev, ok := z.PollEvent()
+		if !ok {
+			break
+		}
+		if ev.Type == EventFileFailed {
+			failed = ev.Code == CodePeerCancelled
+		}
+	}
+	if !failed {
+		t.Fatal("没有发出 file_failed 事件")
+	}
+}
+
+// TestSenderResultTransferred 被跳过或中止的文件以接收方最近确认的位置作为已传输字节数
+func TestSenderResultTransferred(t *testing.T) {
+	data := testPayload(100000)
+	z := NewSender(memorySources([]loopFile{{"a.bin", data}, {"b.bin", data}}), Options{})
+	drain(z)
+	feedReceiver(t, z,
+		BuildZRINITFrame(CANFDX|CANOVIO|CANFC32),
+		BuildZRPOSFrame(0),
+		BuildZRPOSFrame(30000),
+		BuildZSKIPFrame(),
+		BuildZRPOSFrame(0),
+		BuildZRPOSFrame(40000),
+	)
+	z.Abort(ErrCancelled)
+
+	results := z.Results()
+	if len(results) != 2 {
+		t.Fatalf("传输结果 = %+v，期望 2 个文件", results)
+	}
+	if r := results[0]; !r.Skipped || r.Transferred != 30000 {
+		t.Errorf("被跳过的文件: %+v，期望已传输 30000 字节", r)
+	}
+	if r := results[1]; !errors.Is(r.Err, ErrCancelled) || r.Transferred != 40000 {
+		t.Errorf("中止的文件: %+v，期望已传输 40000 字节", r)
+	}
+}
+
+// TestSenderZCRC 发送方按 ZCRC 位置字段中的长度计算文件前 N 字节的 CRC，0 或超出文件大小时计算整个文件
+func TestSenderZCRC(t *testing.T) {
+	data := testPayload(10000)
+	tests := []struct {
+		name string
+		n    uint32
+		want uint32
+	}{
+		{"partial", 4096, crc32.ChecksumIEEE(data[:4096])},
+		{"whole file", 0, crc32.ChecksumIEEE(data)},
+		{"beyond end", 20000, crc32.ChecksumIEEE(data)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := NewSender(memorySources([]loopFile{{"a.bin", data}}), Options{})
+			drain(z)
+			feedReceiver(t, z, BuildZRINITFrame(CANFDX|CANOVIO|CANFC32))
+			if err := z.FeedData(BuildZCRCFrame(tt.n)); err != nil {
+				t.Fatalf("输入 ZCRC 失败: %v", err)
+			}
+
+			p := NewFrameParser()
+			p.AddData(drain(z))
+			frame, err := p.ParseFrame()
+			if err != nil || frame == nil || frame.Type != FrameZCRC {
+				t.Fatalf("期望 ZCRC，实际为 %+v, %v", frame, err)
+			}
+			if got := frame.Position(); got != tt.want {
+				t.Errorf("CRC = 0x%08x，期望 0x%08x", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSenderClobber Clobber 时 ZFILE 的 ZF1 为 ZMCLOB，默认为 0
+func TestSenderClobber(t *testing.T) {
+	for _, clobber := range []bool{false, true} {
+		z := NewSender(memorySources([]loopFile{{"a.bin", testPayload(100)}}), Options{Clobber: clobber})
+		drain(z)
+		if err := z.FeedData(BuildZRINITFrame(CANFDX | CANOVIO | CANFC32)); err != nil {
+			t.Fatalf("输入 ZRINIT 失败: %v", err)
+		}
+
+		p := NewFrameParser()
+		p.AddData(drain(z))
+		frame, err := p.ParseFrame()
+		if err != nil || frame == nil || frame.Type != FrameZFILE {
+			t.Fatalf("期望 ZFILE，实际为 %+v, %v", frame, err)
+		}
+		want := uint8(0)
+		if clobber {
+			want = ZMCLOB
+		}
+		if frame.F1 != want {
+			t.Errorf("Clobber=%v 时 ZF1 = %d，期望 %d", clobber, frame.F1, want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ import { join } from 'path'
 import { electronApp, optimizer, is } from '@electron-toolkit/utils'
 import icon from '../../resources/icon.png?asset'
 import { registerIPCHandlers } from './ipc'
+import { getNativeLibManager } from './services/NativeLibManager'
 
 function createWindow(): void {
   const { width: workWidth, height: workHeight } = screen.getPrimaryDisplay().workAreaSize
@@ -79,5 +80,10 @@ app.on('window-all-closed', () => {
   }
 })
 
+// 退出前清理所有 ZMODEM 会话，关闭传输中打开的文件并删除未完成的临时文件
+app.on('will-quit', () => {
+  getNativeLibManager().zmodemCleanupAll()
+})
+
 // In this file you can include the rest of your app's specific main process
 // code. You can also put them in separate files and require them here.
@@ -18,8 +18,69 @@ interface ZmodemProgress {
 interface ZmodemStatus {
   status: number // 0=idle, 1=active, 2=completed, 3=error
   message: string | null
+  code?: number // 错误码（status=3 时有效），见 lib/README.md；旧版动态库没有该字段
 }
 
+// 传输统计（ZmodemGetStats 返回的 JSON），见 lib/README.md
+export interface ZmodemStats {
+  transferred: number
+  total: number
+  percent: number
+  bytes: number
+  elapsedMs: number
+  bytesPerSec: number
+  avgBytesPerSec: number
+  etaMs: number // -1 表示未知
+  retransmits: number
+  crcErrors: number
+  blockSize: number
+  paused?: boolean // 功能 pause 之前的动态库没有该字段
+  rateLimit?: number // 本会话的上传限速（字节/秒），0 表示不限速；功能 rate_limit 之前的动态库没有该字段
+}
+
+// 会话诊断信息（ZmodemListSessions 返回的 JSON 数组元素），见 lib/README.md
+export interface ZmodemSessionInfo {
+  id: number
+  mode: 'send' | 'receive'
+  filePath: string
+  state: string
+  file: string
+  transferred: number
+  total: number
+  paused: boolean
+  callbacks: boolean
+  idleMs: number
+  error?: string
+}
+
+// 会话数上限与空闲回收（ZmodemSetSessionLimits），0 或省略表示不限制
+export interface ZmodemSessionLimits {
+  maxSessions?: number
+  idleTimeoutMs?: number
+}
+
+// 空闲会话的回收时间：宿主异常丢下的会话超过该时间没有输入输出时，由动态库中止并释放文件
+const SESSION_IDLE_TIMEOUT_MS = 10 * 60 * 1000
+
+// 动态库能力描述（RollshellLibCapabilities 返回的 JSON）
+export interface LibCapabilities {
+  version: string
+  abi: number
+  protocols: string[]
+  features: string[]
+}
+
+// 动态库日志配置（RollshellSetLogConfig 的 JSON），见 lib/README.md
+export interface LibLogConfig {
+  level?: 'debug' | 'info' | 'warn' | 'error' | 'off'
+  sink?: 'off' | 'file' | 'stderr'
+  path?: string
+  redact?: boolean
+}
+
+// 宿主支持的 C ABI 版本，与 lib/main.go 中的 abiVersion 对应
+const SUPPORTED_ABI_VERSION = 1
+
 /**
  * NativeLibManager - 统一管理动态库调用
  * 单例模式，负责加载 Go 动态库并提供类型安全的 API
@@ -29,6 +90,7 @@ export class NativeLibManager {
   private lib: any = null
   private isLoaded: boolean = false
   private libPath: string | null = null
+  private capabilities: LibCapabilities | null = null
 
   // 结构体类型（用于 decode 指针返回值）
   private ZmodemProgressType: any = null
@@ -42,7 +104,14 @@ export class NativeLibManager {
   private ZmodemFreeProgress: ((progress: ZmodemProgress | null) => void) | null = null
   private ZmodemGetStatus: ((sessionId: number) => ZmodemStatus | null) | null = null
   private ZmodemFreeStatus: ((status: ZmodemStatus | null) => void) | null = null
-  private ZmodemCleanup: ((sessionId: number) => void) | null = null
+  private ZmodemCleanup: ((sessionId: number) => number) | null = null
+  private ZmodemGetStats: ((sessionId: number) => unknown) | null = null
+  private ZmodemFreeString: ((s: unknown) => void) | null = null
+  private ZmodemSetRateLimit: ((sessionId: number, bytesPerSec: number) => number) | null = null
+  private ZmodemSetGlobalRateLimit: ((bytesPerSec: number) => number) | null = null
+  private ZmodemSetSessionLimits: ((configJSON: string) => number) | null = null
+  private ZmodemListSessions: (() => unknown) | null = null
+  private ZmodemCleanupAll: (() => number) | null = null
 
   private constructor() {
     // 私有构造函数，确保单例
@@ -143,6 +212,12 @@ export class NativeLibManager {
 
       this.lib = koffi.load(libPath)
       this.isLoaded = true
+      this.capabilities = this.probeCapabilities()
+
+      // 设置 ZMODEM_DEBUG 时把动态库的调试日志输出到 stderr
+      if (process.env.ZMODEM_DEBUG) {
+        this.setLogConfig({ level: 'debug', sink: 'stderr', redact: true })
+      }
 
       // 注册结构体类型（需要在函数定义之前）
       this.ZmodemProgressType = koffi.struct('ZmodemProgress', {
@@ -151,10 +226,17 @@ export class NativeLibManager {
         percent: 'double'
       })
 
-      this.ZmodemStatusType = koffi.struct('ZmodemStatus', {
-        status: 'int',
-        message: 'str'
-      })
+      // 旧版动态库的 ZmodemStatus 末尾没有 code 字段，不能按新布局读取
+      this.ZmodemStatusType = this.hasFeature('error_codes')
+        ? koffi.struct('ZmodemStatus', {
+            status: 'int',
+            message: 'str',
+            code: 'int'
+          })
+        : koffi.struct('ZmodemStatusV0', {
+            status: 'int',
+            message: 'str'
+          })
 
       // 定义 C API 函数签名
       this.ZmodemInit = this.lib.func('ZmodemInit', 'int', ['int', 'str'])
@@ -164,7 +246,23 @@ export class NativeLibManager {
       this.ZmodemFreeProgress = this.lib.func('ZmodemFreeProgress', 'void', [koffi.pointer(this.ZmodemProgressType)])
       this.ZmodemGetStatus = this.lib.func('ZmodemGetStatus', koffi.pointer(this.ZmodemStatusType), ['int'])
       this.ZmodemFreeStatus = this.lib.func('ZmodemFreeStatus', 'void', [koffi.pointer(this.ZmodemStatusType)])
-      this.ZmodemCleanup = this.lib.func('ZmodemCleanup', 'void', ['int'])
+      this.ZmodemCleanup = this.lib.func('ZmodemCleanup', 'int', ['int'])
+      if (this.hasFeature('stats')) {
+        // 返回的字符串需要由动态库释放，按指针绑定
+        this.ZmodemGetStats = this.lib.func('ZmodemGetStats', 'void*', ['int'])
+        this.ZmodemFreeString = this.lib.func('ZmodemFreeString', 'void', ['void*'])
+      }
+      if (this.hasFeature('rate_limit')) {
+        this.ZmodemSetRateLimit = this.lib.func('ZmodemSetRateLimit', 'int', ['int', 'int64_t'])
+        this.ZmodemSetGlobalRateLimit = this.lib.func('ZmodemSetGlobalRateLimit', 'int', ['int64_t'])
+      }
+      if (this.hasFeature('session_admin')) {
+        this.ZmodemSetSessionLimits = this.lib.func('ZmodemSetSessionLimits', 'int', ['str'])
+        this.ZmodemListSessions = this.lib.func('ZmodemListSessions', 'void*', [])
+        this.ZmodemCleanupAll = this.lib.func('ZmodemCleanupAll', 'int', [])
+        this.ZmodemFreeString ??= this.lib.func('ZmodemFreeString', 'void', ['void*'])
+        this.zmodemSetSessionLimits({ idleTimeoutMs: SESSION_IDLE_TIMEOUT_MS })
+      }
 
       console.log(`[NativeLibManager] 动态库加载成功`)
     } catch (error) {
@@ -173,6 +271,67 @@ export class NativeLibManager {
     }
   }
 
+  /**
+   * 读取动态库的版本与能力，旧版动态库没有导出该函数时返回 null
+   */
+  private probeCapabilities(): LibCapabilities | null {
+    let json: string
+    try {
+      const getCapabilities = this.lib.func('RollshellLibCapabilities', 'str', [])
+      json = getCapabilities()
+    } catch (error) {
+      console.warn(`[NativeLibManager] 动态库未导出 RollshellLibCapabilities，按旧版动态库处理:`, error)
+      return null
+    }
+
+    try {
+      const capabilities = JSON.parse(json) as LibCapabilities
+      console.log(`[NativeLibManager] 动态库版本: ${capabilities.version}, ABI: ${capabilities.abi}`)
+      if (capabilities.abi !== SUPPORTED_ABI_VERSION) {
+        console.warn(
+          `[NativeLibManager] 动态库 ABI 版本 ${capabilities.abi} 与宿主支持的版本 ${SUPPORTED_ABI_VERSION} 不一致，只使用基础功能`
+        )
+        return { ...capabilities, features: [] }
+      }
+      return capabilities
+    } catch (error) {
+      console.error(`[NativeLibManager] 解析动态库能力失败:`, error)
+      return null
+    }
+  }
+
+  /**
+   * 获取动态库的版本与能力，旧版动态库返回 null
+   */
+  getLibCapabilities(): LibCapabilities | null {
+    this.ensureLoaded()
+    return this.capabilities
+  }
+
+  /**
+   * 判断动态库是否支持某项功能（如 resume、callbacks、events），旧版动态库总是返回 false
+   */
+  hasFeature(feature: string): boolean {
+    return this.capabilities?.features.includes(feature) ?? false
+  }
+
+  /**
+   * 设置动态库日志，旧版动态库不支持时返回 false
+   */
+  setLogConfig(config: LibLogConfig): boolean {
+    this.ensureLoaded()
+    if (!this.hasFeature('logging')) {
+      return false
+    }
+    const setLogConfig = this.lib.func('RollshellSetLogConfig', 'int', ['str', 'void*', 'void*'])
+    const result = setLogConfig(JSON.stringify(config), null, null)
+    if (result < 0) {
+      console.error(`[NativeLibManager] 设置动态库日志失败: ${result}`)
+      return false
+    }
+    return true
+  }
+
   /**
    * 确保库已加载
    */
@@ -287,10 +446,59 @@ export class NativeLibManager {
     }
   }
 
+  /**
+   * ZMODEM: 获取传输统计（速度、预计剩余时间等），旧版动态库或会话不存在时返回 null
+   */
+  zmodemGetStats(sessionId: number): ZmodemStats | null {
+    this.ensureLoaded()
+
+    if (!this.ZmodemGetStats || !this.ZmodemFreeString) {
+      return null
+    }
+
+    const ptr = this.ZmodemGetStats(sessionId)
+    if (!ptr) {
+      return null
+    }
+
+    try {
+      return JSON.parse(koffi.decode(ptr, 'char', -1) as string) as ZmodemStats
+    } catch (error) {
+      console.error(`[NativeLibManager] 获取传输统计失败:`, error)
+      return null
+    } finally {
+      this.ZmodemFreeString(ptr)
+    }
+  }
+
+  /**
+   * ZMODEM: 修改会话的上传限速（字节/秒，0 表示不限速），旧版动态库或会话不存在时返回 false
+   */
+  zmodemSetRateLimit(sessionId: number, bytesPerSec: number): boolean {
+    this.ensureLoaded()
+
+    if (!this.ZmodemSetRateLimit) {
+      return false
+    }
+    return this.ZmodemSetRateLimit(sessionId, bytesPerSec) === 0
+  }
+
+  /**
+   * ZMODEM: 设置所有会话共享的上传限速（字节/秒，0 表示不限速），旧版动态库返回 false
+   */
+  zmodemSetGlobalRateLimit(bytesPerSec: number): boolean {
+    this.ensureLoaded()
+
+    if (!this.ZmodemSetGlobalRateLimit) {
+      return false
+    }
+    return this.ZmodemSetGlobalRateLimit(bytesPerSec) === 0
+  }
+
   /**
    * ZMODEM: 获取会话状态
    */
-  zmodemGetStatus(sessionId: number): { status: number; message: string } | null {
+  zmodemGetStatus(sessionId: number): { status: number; message: string; code?: number } | null {
     this.ensureLoaded()
 
     if (!this.ZmodemGetStatus || !this.ZmodemFreeStatus) {
@@ -310,11 +518,13 @@ export class NativeLibManager {
       const decoded = koffi.decode(status, this.ZmodemStatusType) as {
         status: number
         message: string | null
+        code?: number
       }
 
       const result = {
         status: decoded.status,
-        message: decoded.message || ''
+        message: decoded.message || '',
+        code: decoded.code
       }
 
       // 释放 C 内存
@@ -331,17 +541,74 @@ export class NativeLibManager {
   }
 
   /**
-   * ZMODEM: 清理会话资源
+   * ZMODEM: 清理会话资源，返回 0 或错误码（旧版动态库没有返回值，返回值无意义）
    */
-  zmodemCleanup(sessionId: number): void {
+  zmodemCleanup(sessionId: number): number {
     this.ensureLoaded()
 
     if (!this.ZmodemCleanup) {
       throw new Error('ZmodemCleanup 函数未加载')
     }
 
-    this.ZmodemCleanup(sessionId)
-    console.log(`[NativeLibManager] ZMODEM 会话已清理: sessionId=${sessionId}`)
+    const result = this.ZmodemCleanup(sessionId)
+    if (result < 0) {
+      console.warn(`[NativeLibManager] ZMODEM 会话清理失败: sessionId=${sessionId}, code=${result}`)
+    } else {
+      console.log(`[NativeLibManager] ZMODEM 会话已清理: sessionId=${sessionId}`)
+    }
+    return result
+  }
+
+  /**
+   * ZMODEM: 清理所有会话（应用退出时调用），动态库尚未加载或为旧版时不做任何事，返回 0 或错误码
+   */
+  zmodemCleanupAll(): number {
+    if (!this.isLoaded || !this.ZmodemCleanupAll) {
+      return 0
+    }
+
+    const result = this.ZmodemCleanupAll()
+    if (result < 0) {
+      console.warn(`[NativeLibManager] ZMODEM 会话清理失败: code=${result}`)
+    }
+    return result
+  }
+
+  /**
+   * ZMODEM: 设置进行中的会话数上限和空闲会话的回收时间，旧版动态库或配置无效时返回 false
+   */
+  zmodemSetSessionLimits(limits: ZmodemSessionLimits): boolean {
+    this.ensureLoaded()
+
+    if (!this.ZmodemSetSessionLimits) {
+      return false
+    }
+    return this.ZmodemSetSessionLimits(JSON.stringify(limits)) === 0
+  }
+
+  /**
+   * ZMODEM: 列出所有未清理的会话（用于诊断），旧版动态库返回 null
+   */
+  zmodemListSessions(): ZmodemSessionInfo[] | null {
+    this.ensureLoaded()
+
+    if (!this.ZmodemListSessions || !this.ZmodemFreeString) {
+      return null
+    }
+
+    const ptr = this.ZmodemListSessions()
+    if (!ptr) {
+      return null
+    }
+
+    try {
+      return JSON.parse(koffi.decode(ptr, 'char', -1) as string) as ZmodemSessionInfo[]
+    } catch (error) {
+      console.error(`[NativeLibManager] 获取会话列表失败:`, error)
+      return null
+    } finally {
+      this.ZmodemFreeString(ptr)
+    }
   }
 }
 
@@ -120,6 +120,12 @@ export class ZMODEMManager {
             transferred: progress.transferred,
             total: progress.total
           }
+          // 新版动态库提供速度和预计剩余时间
+          const stats = this.nativeLib.zmodemGetStats(this.zmodemSessionId)
+          if (stats) {
+            zmodemProgress.bytesPerSec = stats.bytesPerSec
+            zmodemProgress.etaMs = stats.etaMs
+          }
           this.sendProgress(zmodemProgress)
         }
       } catch (error) {
@@ -150,6 +150,8 @@ export interface ZMODEMProgress {
   percent: number
   transferred: number // bytes
   total: number // bytes
+  bytesPerSec?: number // 最近 3 秒的速度（旧版动态库没有）
+  etaMs?: number // 当前文件预计剩余毫秒数，-1 表示未知
 }
 
 /**